@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	authSubjectKey = "auth_subject"
+	authRoleKey    = "auth_role"
+	roleAdmin      = "admin"
+)
+
+var (
+	errMissingToken = errors.New("missing bearer token")
+	errInvalidToken = errors.New("invalid token")
+	errNoSubject    = errors.New("token has no subject")
+)
+
+type authClaims struct {
+	Role string `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func authRequired(secret []byte) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := authenticate(c, secret); err != nil {
+			respondError(c, 401, codeUnauthorized, err.Error())
+			return
+		}
+		c.Next()
+	}
+}
+
+// authOptional identifies the caller when a bearer token is sent but lets
+// anonymous requests through; a token that is present but invalid is still
+// rejected.
+func authOptional(secret []byte) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := authenticate(c, secret); err != nil && !errors.Is(err, errMissingToken) {
+			respondError(c, 401, codeUnauthorized, err.Error())
+			return
+		}
+		c.Next()
+	}
+}
+
+func authenticate(c *gin.Context, secret []byte) error {
+	tokenString, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || tokenString == "" {
+		return errMissingToken
+	}
+
+	var claims authClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(*jwt.Token) (any, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return errInvalidToken
+	}
+	if claims.Subject == "" {
+		return errNoSubject
+	}
+
+	c.Set(authSubjectKey, claims.Subject)
+	c.Set(authRoleKey, claims.Role)
+	return nil
+}
+
+// adminOnly must run after authRequired.
+func adminOnly(c *gin.Context) {
+	if c.GetString(authRoleKey) != roleAdmin {
+		respondError(c, 403, codeForbidden, "admin role required")
+		return
+	}
+	c.Next()
+}
+
+func isSelfOrAdmin(c *gin.Context, userID string) bool {
+	return c.GetString(authSubjectKey) == userID || c.GetString(authRoleKey) == roleAdmin
+}
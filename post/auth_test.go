@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signed(t *testing.T, method jwt.SigningMethod, claims jwt.Claims, key any) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return "Bearer " + token
+}
+
+func TestAuthRequired(t *testing.T) {
+	r := gin.New()
+	r.POST("/", authRequired([]byte(testSecret)), func(c *gin.Context) {
+		c.String(200, c.GetString(authSubjectKey)+"/"+c.GetString(authRoleKey))
+	})
+
+	claims := func(subject string, expires time.Duration) authClaims {
+		return authClaims{Role: roleAdmin, RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expires)),
+		}}
+	}
+	valid := signed(t, jwt.SigningMethodHS256, claims("alice", time.Hour), []byte(testSecret))
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"valid", valid, 200},
+		{"missing", "", 401},
+		{"not bearer", "Basic YWxpY2U6c2VjcmV0", 401},
+		{"expired", signed(t, jwt.SigningMethodHS256, claims("alice", -time.Minute), []byte(testSecret)), 401},
+		{"tampered", valid[:len(valid)-2] + "xx", 401},
+		{"wrong secret", signed(t, jwt.SigningMethodHS256, claims("alice", time.Hour), []byte("other")), 401},
+		{"none alg", signed(t, jwt.SigningMethodNone, claims("alice", time.Hour), jwt.UnsafeAllowNoneSignatureType), 401},
+		{"no subject", signed(t, jwt.SigningMethodHS256, claims("", time.Hour), []byte(testSecret)), 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, "POST", "/", "", "Authorization", tt.header)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want == 401 && errorCode(t, w) != codeUnauthorized {
+				t.Errorf("code = %q, want %q", errorCode(t, w), codeUnauthorized)
+			}
+			if tt.want == 200 && w.Body.String() != "alice/admin" {
+				t.Errorf("context = %q, want alice/admin", w.Body)
+			}
+		})
+	}
+}
+
+func TestAuthOptional(t *testing.T) {
+	r := gin.New()
+	r.GET("/", authOptional([]byte(testSecret)), func(c *gin.Context) {
+		c.String(200, c.GetString(authSubjectKey))
+	})
+
+	if w := serve(r, "GET", "/", ""); w.Code != 200 || w.Body.String() != "" {
+		t.Errorf("anonymous: status = %d, body %q; want 200 with no subject", w.Code, w.Body)
+	}
+	if w := serve(r, "GET", "/", "", "Authorization", bearer(t, "alice", "")); w.Body.String() != "alice" {
+		t.Errorf("with token: body %q, want alice", w.Body)
+	}
+	if w := serve(r, "GET", "/", "", "Authorization", "Bearer garbage"); w.Code != 401 {
+		t.Errorf("bad token: status = %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const defaultTopAuthors = 10
+
+type topAuthor struct {
+	UserID    string `bson:"_id" json:"user_id"`
+	UserName  string `bson:"user_name" json:"user_name"`
+	PostCount int64  `bson:"post_count" json:"post_count"`
+}
+
+// getTopAuthors ranks users by live post count. Names come from the user
+// service where it answers, falling back to the copy stored on the posts.
+func getTopAuthors(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	limit := int64(defaultTopAuthors)
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			respondError(c, 400, codeBadRequest, "limit must be an integer")
+			return
+		}
+		limit = clampPageSize(v)
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: visibleFilter()}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        "$user_id",
+			"post_count": bson.M{"$sum": 1},
+			"user_name":  bson.M{"$max": "$user_name"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "post_count", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+
+	cursor, err := postCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	authors := []topAuthor{}
+	if err := cursor.All(ctx, &authors); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	fillAuthorNames(ctx, authors)
+	c.JSON(200, gin.H{"authors": authors})
+}
+
+func fillAuthorNames(ctx context.Context, authors []topAuthor) {
+	ids := make([]string, len(authors))
+	exists := make(map[string]bool, len(authors))
+	for i, a := range authors {
+		ids[i] = a.UserID
+		exists[a.UserID] = true
+	}
+	names := authorNames(ctx, ids, exists)
+	for i := range authors {
+		if name, ok := names[authors[i].UserID]; ok {
+			authors[i].UserName = name
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// evalTopAuthors runs the $group, $sort and $limit stages of pipeline over
+// docs, grouping on the single field the $group _id names.
+func evalTopAuthors(t *testing.T, pipeline bson.Raw, docs []bson.M) []any {
+	t.Helper()
+	stage := func(i int, name string) bson.RawValue {
+		return pipeline.Index(uint(i)).Value().Document().Lookup(name)
+	}
+
+	group := stage(1, "$group").Document()
+	key := strings.TrimPrefix(group.Lookup("_id").StringValue(), "$")
+	byKey := map[any][]bson.M{}
+	for _, doc := range docs {
+		byKey[doc[key]] = append(byKey[doc[key]], doc)
+	}
+	var out []bson.M
+	for id, members := range byKey {
+		row := evalGroup(t, group, members)
+		row["_id"] = id
+		out = append(out, row)
+	}
+
+	sortSpec, err := stage(2, "$sort").Document().Elements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(out, func(a, b bson.M) int {
+		for _, e := range sortSpec {
+			var c int
+			switch x := a[e.Key()].(type) {
+			case int64:
+				c = cmp.Compare(x, b[e.Key()].(int64))
+			case string:
+				c = cmp.Compare(x, b[e.Key()].(string))
+			}
+			if c != 0 {
+				return c * int(e.Value().AsInt64())
+			}
+		}
+		return 0
+	})
+
+	rows := make([]any, 0, len(out))
+	for _, row := range out[:min(len(out), int(stage(3, "$limit").AsInt64()))] {
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestGetTopAuthors(t *testing.T) {
+	const alice, bob, carol, dave = "64b000000000000000000001", "64b000000000000000000002", "64b000000000000000000003", "64b000000000000000000004"
+	posts := map[string]int{alice: 3, bob: 1, carol: 3, dave: 2}
+	var docs []bson.M
+	for id, n := range posts {
+		for range n {
+			docs = append(docs, bson.M{"user_id": id, "user_name": "stored " + id[len(id)-1:]})
+		}
+	}
+	admin := bearer(t, "64b0000000000000000000ad", roleAdmin)
+
+	// The user service knows everyone but dave, whose stored name is used.
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"names": map[string]string{alice: "Alice", bob: "Bob", carol: "Carol"}})
+	}))
+
+	t.Run("ranked by post count", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			// The first request shows the pipeline; the second is answered
+			// by running it over docs.
+			mt.AddMockResponses(findResponse(t))
+			if w := serve(r, "GET", "/admin/top-authors?limit=3", "", "Authorization", admin); w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			pipeline := startedCommand(t, mt, "aggregate").Lookup("pipeline").Array()
+			match := pipeline.Index(0).Value().Document().Lookup("$match").Document()
+			for _, key := range []string{"deleted_at", "hidden", "published"} {
+				if _, err := match.LookupErr(key); err != nil {
+					t.Errorf("$match = %s does not filter on %s", match, key)
+				}
+			}
+
+			mt.AddMockResponses(findResponse(t, evalTopAuthors(t, pipeline, docs)...))
+			w := serve(r, "GET", "/admin/top-authors?limit=3", "", "Authorization", admin)
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var body struct {
+				Authors []topAuthor `json:"authors"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			// Ties rank by user ID, and the limit drops bob.
+			want := []topAuthor{
+				{UserID: alice, UserName: "Alice", PostCount: 3},
+				{UserID: carol, UserName: "Carol", PostCount: 3},
+				{UserID: dave, UserName: "stored 4", PostCount: 2},
+			}
+			if !slices.Equal(body.Authors, want) {
+				t.Errorf("authors = %+v, want %+v", body.Authors, want)
+			}
+		})
+	})
+
+	t.Run("bad limit", func(t *testing.T) {
+		if w := serve(newTestRouter(t, nil), "GET", "/admin/top-authors?limit=ten", "", "Authorization", admin); w.Code != 400 {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("admins only", func(t *testing.T) {
+		r := newTestRouter(t, nil)
+		if w := serve(r, "GET", "/admin/top-authors", "", "Authorization", bearer(t, alice, "")); w.Code != 403 {
+			t.Errorf("non-admin: status = %d, want 403", w.Code)
+		}
+		if w := serve(r, "GET", "/admin/top-authors", ""); w.Code != 401 {
+			t.Errorf("anonymous: status = %d, want 401", w.Code)
+		}
+	})
+}
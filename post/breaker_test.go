@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	b := newCircuitBreaker(2, cooldown)
+	failure := errors.New("connection refused")
+
+	b.record(failure)
+	if got := b.currentState(); got != breakerClosed {
+		t.Fatalf("after one failure: state = %s, want closed", got)
+	}
+	b.record(failure)
+	if got := b.currentState(); got != breakerOpen {
+		t.Fatalf("after threshold: state = %s, want open", got)
+	}
+	if err := b.allow(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("allow while open = %v, want errCircuitOpen", err)
+	}
+
+	time.Sleep(cooldown + 5*time.Millisecond)
+	if got := b.currentState(); got != breakerHalfOpen {
+		t.Fatalf("after cooldown: state = %s, want half-open", got)
+	}
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe refused: %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("second call during probe = %v, want errCircuitOpen", err)
+	}
+
+	// A failed probe opens it again straight away.
+	b.record(failure)
+	if got := b.currentState(); got != breakerOpen {
+		t.Fatalf("after failed probe: state = %s, want open", got)
+	}
+
+	time.Sleep(cooldown + 5*time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("second probe refused: %v", err)
+	}
+	b.record(nil)
+	if got := b.currentState(); got != breakerClosed {
+		t.Errorf("after successful probe: state = %s, want closed", got)
+	}
+}
+
+func TestCircuitBreakerIgnoresCancellation(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute)
+	b.record(context.Canceled)
+	if got := b.currentState(); got != breakerClosed {
+		t.Errorf("state = %s, want closed", got)
+	}
+}
+
+func TestOpenBreakerFailsFast(t *testing.T) {
+	const user = "64b000000000000000000001"
+	var calls int
+	fakeUserServiceWith(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(503)
+	}), func(cfg *Config) {
+		cfg.UserServiceRetries = 1
+		cfg.BreakerThreshold = 2
+		cfg.BreakerCooldown = time.Minute
+	})
+	r := newTestRouter(t, nil)
+
+	for range 2 {
+		serve(r, "GET", "/posts/"+user, "")
+	}
+	w := serve(r, "GET", "/posts/"+user, "")
+	if w.Code != 503 || errorCode(t, w) != codeUnavailable {
+		t.Errorf("status = %d, body %s; want 503 unavailable", w.Code, w.Body)
+	}
+	if calls != 2 {
+		t.Errorf("user-service calls = %d, want 2", calls)
+	}
+
+	indexesReady.Store(true)
+	t.Cleanup(func() { indexesReady.Store(false) })
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		w := serve(r, "GET", "/healthz", "")
+		if !strings.Contains(w.Body.String(), `"user_service_breaker":"open"`) {
+			t.Errorf("healthz = %s, want the breaker reported open", w.Body)
+		}
+	})
+}
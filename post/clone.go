@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const cloneTitleSuffix = " (copy)"
+
+// clonePost copies a post's title, content and tags into a new post. The body
+// is optional; {"user_id": "..."} clones into another account, which the
+// caller must own or be an admin for. The copy starts fresh: new slug, no
+// likes, reports, schedule or expiry. Posts hidden by moderation can only be
+// cloned by an admin.
+func clonePost(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objID, ok := parseObjectID(c, "postID")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		respondBindError(c, err)
+		return
+	}
+
+	var source Post
+	err := postCollection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": nil}).Decode(&source)
+	if err == nil && !visibleTo(c, source) {
+		err = mongo.ErrNoDocuments
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondError(c, 404, codeNotFound, "post not found")
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	// The copy starts unhidden, so cloning would undo moderation.
+	if source.Hidden && c.GetString(authRoleKey) != roleAdmin {
+		respondError(c, 403, codeForbidden, "posts hidden by moderation can only be cloned by an admin")
+		return
+	}
+
+	userID := source.UserID
+	if input.UserID != "" {
+		userID, err = normalizeUserID(input.UserID)
+		if err != nil {
+			respondFieldErrors(c, map[string]string{"user_id": err.Error()})
+			return
+		}
+	}
+	if !isSelfOrAdmin(c, userID) {
+		respondError(c, 403, codeForbidden, "only the user or an admin can clone posts into this account")
+		return
+	}
+
+	userName, exists, err := userService.lookupUserName(ctx, userID)
+	if err != nil {
+		respondUserServiceError(c, err)
+		return
+	}
+	if !exists {
+		respondError(c, 404, codeNotFound, "user does not exist")
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	clone := Post{
+		UserID:    userID,
+		UserName:  userName,
+		Title:     cloneTitle(source.Title),
+		Content:   source.Content,
+		Tags:      source.Tags,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Version:   1,
+	}
+	schedulePost(&clone, now)
+
+	if err := insertPost(ctx, &clone); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.Header("Location", postLocation(clone.ID))
+	c.JSON(201, clone)
+}
+
+// cloneTitle appends cloneTitleSuffix, shortening the original title when the
+// result would exceed maxTitleLength.
+func cloneTitle(title string) string {
+	room := maxTitleLength - utf8.RuneCountInString(cloneTitleSuffix)
+	if runes := []rune(title); len(runes) > room {
+		title = string(runes[:room])
+	}
+	return title + cloneTitleSuffix
+}
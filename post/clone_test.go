@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestClonePost(t *testing.T) {
+	const owner, other = "64b000000000000000000001", "64b000000000000000000002"
+	admin := bearer(t, "64b0000000000000000000ad", roleAdmin)
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"Alice"}`))
+	}))
+	postID := primitive.NewObjectID()
+	path := "/posts/" + postID.Hex() + "/clone"
+	source := Post{ID: postID, UserID: owner, Title: "Hello", Content: "World", Tags: []string{"go"}, Slug: "hello", Likes: 7, ReportCount: 2, Published: true, Version: 4}
+	hidden := source
+	hidden.Hidden = true
+
+	t.Run("copies into the owner's account", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t, source), findResponse(t, source), writeResponse(1))
+
+			w := serve(r, "POST", path, "", "Authorization", bearer(t, owner, ""))
+			if w.Code != 201 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var clone Post
+			if err := json.Unmarshal(w.Body.Bytes(), &clone); err != nil {
+				t.Fatal(err)
+			}
+			if clone.ID == postID || clone.UserID != owner || clone.Title != "Hello"+cloneTitleSuffix || clone.Content != "World" {
+				t.Errorf("clone = %+v", clone)
+			}
+			if clone.Slug == source.Slug || clone.Likes != 0 || clone.ReportCount != 0 || clone.Version != 1 {
+				t.Errorf("clone kept slug %q, likes %d, reports %d or version %d", clone.Slug, clone.Likes, clone.ReportCount, clone.Version)
+			}
+			if w.Header().Get("Location") != postLocation(clone.ID) {
+				t.Errorf("Location = %q", w.Header().Get("Location"))
+			}
+		})
+	})
+
+	for _, tc := range []struct {
+		name, token, body string
+		post              Post
+		want              int
+	}{
+		{"into another account", bearer(t, owner, ""), `{"user_id":"` + other + `"}`, source, 403},
+		{"hidden, by its owner", bearer(t, owner, ""), "", hidden, 403},
+		{"hidden, by another user", bearer(t, other, ""), "", hidden, 404},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				r := newTestRouter(t, nil)
+				mt.AddMockResponses(findResponse(t, tc.post))
+
+				if w := serve(r, "POST", path, tc.body, "Authorization", tc.token); w.Code != tc.want {
+					t.Errorf("status = %d, want %d: %s", w.Code, tc.want, w.Body)
+				}
+				if n := len(commandsNamed(mt, "insert")); n != 0 {
+					t.Errorf("sent %d inserts", n)
+				}
+			})
+		})
+	}
+
+	t.Run("hidden, by an admin into another account", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t, hidden), findResponse(t), writeResponse(1))
+
+			w := serve(r, "POST", path, `{"user_id":"`+other+`"}`, "Authorization", admin)
+			if w.Code != 201 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if doc := startedCommand(t, mt, "insert").Lookup("documents", "0"); doc.Document().Lookup("user_id").StringValue() != other {
+				t.Errorf("inserted %s, want a post for %s", doc, other)
+			}
+		})
+	})
+}
+
+func TestCloneTitle(t *testing.T) {
+	if got := cloneTitle("Hello"); got != "Hello"+cloneTitleSuffix {
+		t.Errorf("cloneTitle = %q", got)
+	}
+	got := cloneTitle(strings.Repeat("é", maxTitleLength))
+	if n := utf8.RuneCountInString(got); n != maxTitleLength || !strings.HasSuffix(got, cloneTitleSuffix) {
+		t.Errorf("long title cloned to %d characters: %q", n, got)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	MongoURI            string
+	MongoDB             string
+	PostCollection      string
+	MongoConnectRetries int
+	MongoMaxPoolSize    int
+	MongoMinPoolSize    int
+	MongoTLSCAFile      string
+	MongoTLSCertFile    string
+	Port                string
+	ShutdownTimeout     time.Duration
+	OTLPEndpoint        string
+	EnablePprof         bool
+	ReadOnly            bool
+	RequestTimeout      time.Duration
+	BulkRequestTimeout  time.Duration
+	IndexTimeout        time.Duration
+	SlowRequest         time.Duration
+	DefaultPageSize     int
+	MaxPageSize         int
+	MaxBodyBytes        int
+	BulkMaxPosts        int
+	BulkMaxBodyBytes    int
+	ContentPolicy       string
+	PublishInterval     time.Duration
+	ReconcileInterval   time.Duration
+	ReportHideThreshold int
+	DuplicateWindow     time.Duration
+
+	UserServiceURL       string
+	UserServiceTimeout   time.Duration
+	UserServiceIdleConns int
+	UserServiceIdleTTL   time.Duration
+	UserServiceRetries   int
+	UserServiceBackoff   time.Duration
+	BreakerThreshold     int
+	BreakerCooldown      time.Duration
+	UserCacheTTL         time.Duration
+	UserCacheNegativeTTL time.Duration
+	StrictUserCheck      bool
+
+	JWTSecret          string
+	CORSAllowedOrigins []string
+	RateLimitRPS       float64
+	RateLimitBurst     int
+	TrustedProxies     []string
+
+	IdempotencyCollection string
+	IdempotencyTTL        time.Duration
+	HistoryCollection     string
+	ReportsCollection     string
+
+	BrokerURL          string
+	BrokerExchange     string
+	OutboxCollection   string
+	OutboxPollInterval time.Duration
+}
+
+func LoadConfig() (Config, error) {
+	var env envReader
+
+	cfg := Config{
+		MongoURI:            env.string("MONGO_URI", "mongodb://localhost:27017"),
+		MongoDB:             env.string("MONGO_DB", "TTTN"),
+		PostCollection:      env.string("POST_COLLECTION", "posts"),
+		MongoConnectRetries: env.int("MONGO_CONNECT_RETRIES", 5),
+		MongoMaxPoolSize:    env.int("MONGO_MAX_POOL_SIZE", 100),
+		MongoMinPoolSize:    env.int("MONGO_MIN_POOL_SIZE", 0),
+		MongoTLSCAFile:      env.string("MONGO_TLS_CA_FILE", ""),
+		MongoTLSCertFile:    env.string("MONGO_TLS_CERT_KEY_FILE", ""),
+		Port:                env.string("PORT", "8081"),
+		ShutdownTimeout:     env.duration("SHUTDOWN_TIMEOUT", 10*time.Second),
+		OTLPEndpoint:        env.string("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		EnablePprof:         env.bool("ENABLE_PPROF", false),
+		ReadOnly:            env.bool("READ_ONLY", false),
+		RequestTimeout:      env.duration("REQUEST_TIMEOUT", 5*time.Second),
+		BulkRequestTimeout:  env.duration("BULK_REQUEST_TIMEOUT", 30*time.Second),
+		IndexTimeout:        env.duration("INDEX_TIMEOUT", time.Minute),
+		SlowRequest:         time.Duration(env.int("SLOW_REQUEST_MS", 2000)) * time.Millisecond,
+		DefaultPageSize:     env.int("DEFAULT_PAGE_SIZE", 20),
+		MaxPageSize:         env.int("MAX_PAGE_SIZE", 100),
+		MaxBodyBytes:        env.int("MAX_BODY_BYTES", 1<<20),
+		BulkMaxPosts:        env.int("BULK_MAX_POSTS", 500),
+		BulkMaxBodyBytes:    env.int("BULK_MAX_BODY_BYTES", 8<<20),
+		ContentPolicy:       env.string("CONTENT_HTML_POLICY", contentPolicyStrict),
+		PublishInterval:     env.duration("PUBLISH_INTERVAL", 30*time.Second),
+		ReconcileInterval:   env.duration("ORPHAN_RECONCILE_INTERVAL", 0),
+		ReportHideThreshold: env.int("REPORT_HIDE_THRESHOLD", 5),
+		DuplicateWindow:     env.duration("DUPLICATE_POST_WINDOW", 0),
+
+		UserServiceURL:       env.string("USER_SERVICE_URL", "http://localhost:8080"),
+		UserServiceTimeout:   env.duration("USER_SERVICE_TIMEOUT", 3*time.Second),
+		UserServiceIdleConns: env.int("USER_SERVICE_MAX_IDLE_CONNS", 64),
+		UserServiceIdleTTL:   env.duration("USER_SERVICE_IDLE_CONN_TIMEOUT", 90*time.Second),
+		UserServiceRetries:   env.int("USER_SERVICE_RETRIES", 3),
+		UserServiceBackoff:   env.duration("USER_SERVICE_BACKOFF", 100*time.Millisecond),
+		BreakerThreshold:     env.int("USER_SERVICE_BREAKER_THRESHOLD", 5),
+		BreakerCooldown:      env.duration("USER_SERVICE_BREAKER_COOLDOWN", 30*time.Second),
+		UserCacheTTL:         env.duration("USER_CACHE_TTL", 30*time.Second),
+		UserCacheNegativeTTL: env.duration("USER_CACHE_NEGATIVE_TTL", 5*time.Second),
+		StrictUserCheck:      env.bool("STRICT_USER_CHECK", true),
+
+		JWTSecret:          env.string("JWT_SECRET", ""),
+		CORSAllowedOrigins: parseAllowedOrigins(env.string("CORS_ALLOWED_ORIGINS", "")),
+		RateLimitRPS:       env.float("RATE_LIMIT_RPS", 5),
+		RateLimitBurst:     env.int("RATE_LIMIT_BURST", 10),
+		TrustedProxies:     env.addresses("TRUSTED_PROXIES"),
+
+		IdempotencyCollection: env.string("IDEMPOTENCY_COLLECTION", "idempotency_keys"),
+		IdempotencyTTL:        env.duration("IDEMPOTENCY_TTL", 24*time.Hour),
+		HistoryCollection:     env.string("HISTORY_COLLECTION", "post_history"),
+		ReportsCollection:     env.string("REPORTS_COLLECTION", "reports"),
+
+		BrokerURL:          env.string("BROKER_URL", ""),
+		BrokerExchange:     env.string("BROKER_EXCHANGE", "posts"),
+		OutboxCollection:   env.string("OUTBOX_COLLECTION", "outbox"),
+		OutboxPollInterval: env.duration("OUTBOX_POLL_INTERVAL", time.Second),
+	}
+
+	if strings.TrimSpace(cfg.MongoDB) == "" {
+		env.fail("MONGO_DB must not be empty")
+	}
+	if strings.TrimSpace(cfg.PostCollection) == "" {
+		env.fail("POST_COLLECTION must not be empty")
+	}
+	if strings.TrimSpace(cfg.IdempotencyCollection) == "" {
+		env.fail("IDEMPOTENCY_COLLECTION must not be empty")
+	}
+	if cfg.BrokerURL != "" && strings.TrimSpace(cfg.OutboxCollection) == "" {
+		env.fail("OUTBOX_COLLECTION must not be empty")
+	}
+	if cfg.OutboxPollInterval <= 0 {
+		env.fail("OUTBOX_POLL_INTERVAL must be positive")
+	}
+	if strings.TrimSpace(cfg.HistoryCollection) == "" {
+		env.fail("HISTORY_COLLECTION must not be empty")
+	}
+	if strings.TrimSpace(cfg.ReportsCollection) == "" {
+		env.fail("REPORTS_COLLECTION must not be empty")
+	}
+	if cfg.DuplicateWindow < 0 {
+		env.fail("DUPLICATE_POST_WINDOW must not be negative")
+	}
+	if cfg.ReportHideThreshold < 1 {
+		env.fail("REPORT_HIDE_THRESHOLD must be at least 1")
+	}
+	if cfg.IdempotencyTTL < time.Second {
+		env.fail("IDEMPOTENCY_TTL must be at least 1s")
+	}
+	if cfg.MongoConnectRetries < 1 {
+		env.fail("MONGO_CONNECT_RETRIES must be at least 1")
+	}
+	if cfg.MongoMaxPoolSize < 1 {
+		env.fail("MONGO_MAX_POOL_SIZE must be at least 1")
+	}
+	if !strings.HasPrefix(cfg.MongoURI, "mongodb://") && !strings.HasPrefix(cfg.MongoURI, "mongodb+srv://") {
+		env.fail("MONGO_URI must start with mongodb:// or mongodb+srv://")
+	}
+	if cfg.MongoMinPoolSize < 0 {
+		env.fail("MONGO_MIN_POOL_SIZE must not be negative")
+	}
+	if cfg.MongoMinPoolSize > cfg.MongoMaxPoolSize {
+		env.fail("MONGO_MIN_POOL_SIZE (%d) must not exceed MONGO_MAX_POOL_SIZE (%d)", cfg.MongoMinPoolSize, cfg.MongoMaxPoolSize)
+	}
+	if cfg.BulkMaxPosts < 1 {
+		env.fail("BULK_MAX_POSTS must be at least 1")
+	}
+	if cfg.BulkMaxBodyBytes < 1 {
+		env.fail("BULK_MAX_BODY_BYTES must be at least 1")
+	}
+	if cfg.ContentPolicy != contentPolicyStrict && cfg.ContentPolicy != contentPolicyBasic {
+		env.fail("CONTENT_HTML_POLICY must be %q or %q, got %q", contentPolicyStrict, contentPolicyBasic, cfg.ContentPolicy)
+	}
+	if cfg.PublishInterval <= 0 {
+		env.fail("PUBLISH_INTERVAL must be positive")
+	}
+	if cfg.ReconcileInterval < 0 {
+		env.fail("ORPHAN_RECONCILE_INTERVAL must not be negative")
+	}
+	if cfg.MaxPageSize < 1 {
+		env.fail("MAX_PAGE_SIZE must be at least 1")
+	}
+	if cfg.DefaultPageSize < 1 || cfg.DefaultPageSize > cfg.MaxPageSize {
+		env.fail("DEFAULT_PAGE_SIZE must be between 1 and MAX_PAGE_SIZE (%d)", cfg.MaxPageSize)
+	}
+	if cfg.SlowRequest < 0 {
+		env.fail("SLOW_REQUEST_MS must not be negative")
+	}
+	if cfg.RequestTimeout <= 0 {
+		env.fail("REQUEST_TIMEOUT must be positive")
+	}
+	if cfg.BulkRequestTimeout <= 0 {
+		env.fail("BULK_REQUEST_TIMEOUT must be positive")
+	}
+	if cfg.IndexTimeout <= 0 {
+		env.fail("INDEX_TIMEOUT must be positive")
+	}
+	if cfg.MaxBodyBytes < 1 {
+		env.fail("MAX_BODY_BYTES must be at least 1")
+	}
+	if cfg.JWTSecret == "" {
+		env.fail("JWT_SECRET must be set")
+	}
+	if cfg.UserServiceTimeout <= 0 {
+		env.fail("USER_SERVICE_TIMEOUT must be positive")
+	}
+	if cfg.UserServiceIdleConns < 1 {
+		env.fail("USER_SERVICE_MAX_IDLE_CONNS must be at least 1")
+	}
+	if cfg.UserServiceIdleTTL <= 0 {
+		env.fail("USER_SERVICE_IDLE_CONN_TIMEOUT must be positive")
+	}
+	if cfg.UserServiceRetries < 1 {
+		env.fail("USER_SERVICE_RETRIES must be at least 1")
+	}
+	if cfg.UserServiceBackoff <= 0 {
+		env.fail("USER_SERVICE_BACKOFF must be positive")
+	}
+	if cfg.BreakerThreshold < 1 {
+		env.fail("USER_SERVICE_BREAKER_THRESHOLD must be at least 1")
+	}
+
+	return cfg, env.err
+}
+
+type envReader struct {
+	err error
+}
+
+func (r *envReader) fail(format string, args ...any) {
+	r.err = errors.Join(r.err, fmt.Errorf(format, args...))
+}
+
+func (r *envReader) string(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func (r *envReader) int(key string, fallback int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		r.fail("%s must be an integer, got %q", key, raw)
+		return fallback
+	}
+	return n
+}
+
+func (r *envReader) bool(key string, fallback bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		r.fail("%s must be true or false, got %q", key, raw)
+		return fallback
+	}
+	return b
+}
+
+func (r *envReader) float(key string, fallback float64) float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		r.fail("%s must be a number, got %q", key, raw)
+		return fallback
+	}
+	return f
+}
+
+func (r *envReader) duration(key string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		r.fail("%s must be a duration, got %q", key, raw)
+		return fallback
+	}
+	return d
+}
+
+// addresses reads a comma-separated list of IP addresses and CIDR ranges.
+func (r *envReader) addresses(key string) []string {
+	var out []string
+	for _, addr := range strings.Split(os.Getenv(key), ",") {
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+		if net.ParseIP(addr) == nil {
+			if _, _, err := net.ParseCIDR(addr); err != nil {
+				r.fail("%s must list IP addresses or CIDR ranges, got %q", key, addr)
+				continue
+			}
+		}
+		out = append(out, addr)
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// envelope decodes w's body, failing unless it is exactly
+// {"error": {"code": ..., "message": ...}}.
+func envelope(t *testing.T, w *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not JSON: %v: %q", err, w.Body)
+	}
+	if len(body) != 1 || body["error"] == nil {
+		t.Fatalf("body = %s, want only an error key", w.Body)
+	}
+	var apiErr APIError
+	if err := json.Unmarshal(body["error"], &apiErr); err != nil {
+		t.Fatalf("error is not an APIError: %v", err)
+	}
+	if apiErr.Code == "" || apiErr.Message == "" {
+		t.Fatalf("error = %+v, want code and message", apiErr)
+	}
+	return apiErr
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	r := newTestRouter(t, func(cfg *Config) { cfg.MaxBodyBytes = 64 })
+	token := bearer(t, "64b000000000000000000001", "")
+
+	tests := []struct {
+		name, method, path, body string
+		auth                     bool
+		status                   int
+		code                     string
+	}{
+		{"invalid id", "GET", "/posts/single/nope", "", false, 400, codeInvalidID},
+		{"missing query", "GET", "/posts/search", "", false, 400, codeBadRequest},
+		{"no token", "POST", "/posts", `{}`, false, 401, codeUnauthorized},
+		{"malformed json", "POST", "/posts", `{`, true, 400, codeBadRequest},
+		{"validation", "POST", "/posts", `{}`, true, 400, codeValidation},
+		{"body too large", "POST", "/posts", `{"title":"` + strings.Repeat("x", 100) + `"}`, true, 413, codePayloadTooLarge},
+		{"wrong method", "PUT", "/healthz", "", false, 405, codeMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header []string
+			if tt.auth {
+				header = []string{"Authorization", token}
+			}
+			w := serve(r, tt.method, tt.path, tt.body, header...)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if got := envelope(t, w); got.Code != tt.code {
+				t.Errorf("code = %q, want %q", got.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	r := newTestRouter(t, nil)
+
+	w := serve(r, "POST", "/posts/single/64b000000000000000000001", "")
+	if w.Code != 405 {
+		t.Fatalf("status = %d, want 405: %s", w.Code, w.Body)
+	}
+	if got := envelope(t, w); got.Code != codeMethodNotAllowed {
+		t.Errorf("code = %q, want %q", got.Code, codeMethodNotAllowed)
+	}
+	allow := strings.Split(w.Header().Get("Allow"), ", ")
+	slices.Sort(allow)
+	if want := []string{"GET"}; !slices.Equal(allow, want) {
+		t.Errorf("Allow = %v, want %v", allow, want)
+	}
+
+	if w := serve(r, "GET", "/nope", ""); w.Code != 404 {
+		t.Errorf("unknown path status = %d, want 404", w.Code)
+	}
+}
+
+func TestValidationErrorNamesFields(t *testing.T) {
+	r := newTestRouter(t, nil)
+	w := serve(r, "POST", "/posts", `{}`, "Authorization", bearer(t, "64b000000000000000000001", ""))
+
+	got := envelope(t, w)
+	for _, field := range []string{"title", "content"} {
+		if got.Fields[field] == "" {
+			t.Errorf("fields = %v, want a reason for %s", got.Fields, field)
+		}
+	}
+}
+
+func TestRespondInternalError(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{errors.New("disk on fire"), 500, codeInternal},
+		{context.DeadlineExceeded, 504, codeRequestTimeout},
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		respondInternalError(c, tc.err)
+
+		if w.Code != tc.status {
+			t.Errorf("%v: status = %d, want %d", tc.err, w.Code, tc.status)
+		}
+		got := envelope(t, w)
+		if got.Code != tc.code {
+			t.Errorf("%v: code = %q, want %q", tc.err, got.Code, tc.code)
+		}
+		if strings.Contains(got.Message, tc.err.Error()) {
+			t.Errorf("%v: message %q leaks the cause", tc.err, got.Message)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetPostByIDETag(t *testing.T) {
+	postID := primitive.NewObjectID()
+	path := "/posts/single/" + postID.Hex()
+	post := Post{ID: postID, UserID: "64b000000000000000000001", Title: "Hello", Content: "World", Version: 1}
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		edited := post
+		edited.Version = 2
+		mt.AddMockResponses(findResponse(t, post), findResponse(t, post), findResponse(t, edited))
+
+		first := serve(r, "GET", path, "")
+		if first.Code != 200 {
+			t.Fatalf("status = %d: %s", first.Code, first.Body)
+		}
+		etag := first.Header().Get("ETag")
+		if etag == "" {
+			t.Fatal("no ETag on a 200")
+		}
+
+		cached := serve(r, "GET", path, "", "If-None-Match", etag)
+		if cached.Code != 304 {
+			t.Fatalf("status = %d, want 304", cached.Code)
+		}
+		if cached.Body.Len() != 0 {
+			t.Errorf("304 carried a body: %s", cached.Body)
+		}
+		if got := cached.Header().Get("ETag"); got != etag {
+			t.Errorf("304 ETag = %q, want %q", got, etag)
+		}
+
+		changed := serve(r, "GET", path, "", "If-None-Match", etag)
+		if changed.Code != 200 {
+			t.Fatalf("status after an edit = %d, want 200", changed.Code)
+		}
+		if changed.Header().Get("ETag") == etag {
+			t.Error("ETag did not change with the post")
+		}
+	})
+}
+
+func TestETagMatches(t *testing.T) {
+	const etag = `W/"abc"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`W/"abc"`, true},
+		{`"abc"`, true},
+		{`W/"other", W/"abc"`, true},
+		{`W/"other"`, false},
+		{"*", true},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
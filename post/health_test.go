@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRunHealthChecks(t *testing.T) {
+	fixed := func(status string) healthCheck {
+		return func(ctx context.Context) string {
+			time.Sleep(50 * time.Millisecond)
+			return status
+		}
+	}
+
+	start := time.Now()
+	status, checks := runHealthChecks(context.Background(), map[string]healthCheck{
+		"a": fixed(healthOK),
+		"b": fixed(healthDegraded),
+		"c": fixed(healthOK),
+	})
+	if elapsed := time.Since(start); elapsed > 140*time.Millisecond {
+		t.Errorf("three 50ms checks took %v, want them run in parallel", elapsed)
+	}
+	if status != healthDegraded {
+		t.Errorf("status = %q, want the worst check's %q", status, healthDegraded)
+	}
+	if want := map[string]string{"a": healthOK, "b": healthDegraded, "c": healthOK}; !maps.Equal(checks, want) {
+		t.Errorf("checks = %v, want %v", checks, want)
+	}
+
+	status, _ = runHealthChecks(context.Background(), map[string]healthCheck{
+		"a": fixed(healthDegraded),
+		"b": fixed(healthUnavailable),
+	})
+	if status != healthUnavailable {
+		t.Errorf("status = %q, want %q", status, healthUnavailable)
+	}
+}
+
+func TestHealthzChecks(t *testing.T) {
+	indexesReady.Store(true)
+	t.Cleanup(func() { indexesReady.Store(false) })
+
+	pingFails := mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Name: "Unauthorized", Message: "not authorized"})
+	for _, tc := range []struct {
+		name        string
+		mongoDown   bool
+		serviceDown bool
+		code        int
+		status      string
+		checks      map[string]string
+	}{
+		{"all up", false, false, 200, healthOK,
+			map[string]string{"mongo": healthOK, "user_service": healthOK}},
+		{"user service down", false, true, 200, healthDegraded,
+			map[string]string{"mongo": healthOK, "user_service": healthDegraded}},
+		{"mongo down", true, false, 503, healthUnavailable,
+			map[string]string{"mongo": healthUnavailable, "user_service": healthOK}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/ping" {
+					t.Errorf("unexpected user-service call %s", r.URL.Path)
+				}
+			}))
+			if tc.serviceDown {
+				srv.Close()
+			}
+
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				if tc.mongoDown {
+					mt.AddMockResponses(pingFails)
+				} else {
+					mt.AddMockResponses(mtest.CreateSuccessResponse())
+				}
+
+				w := serve(newTestRouter(t, nil), "GET", "/healthz", "")
+				var body struct {
+					Status string            `json:"status"`
+					Checks map[string]string `json:"checks"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if w.Code != tc.code || body.Status != tc.status || !maps.Equal(body.Checks, tc.checks) {
+					t.Errorf("healthz = %d %s, want %d %q with checks %v", w.Code, w.Body, tc.code, tc.status, tc.checks)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+const testSecret = "test-secret"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// serve runs one request through h and returns the recorded response.
+func serve(h http.Handler, method, path, body string, header ...string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// errorCode returns the code of the standard error envelope in w's body.
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Error APIError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not an error envelope: %v: %q", err, w.Body.String())
+	}
+	return body.Error.Code
+}
+
+// testConfig is the default config with the test JWT secret.
+func testConfig(t testing.TB) Config {
+	t.Helper()
+	t.Setenv("JWT_SECRET", testSecret)
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return cfg
+}
+
+// fakeUserService points userService at an httptest server running h, with
+// retry backoff shortened so failing calls return quickly.
+func fakeUserService(t testing.TB, h http.Handler) *httptest.Server {
+	t.Helper()
+	return fakeUserServiceWith(t, h, nil)
+}
+
+// fakeUserServiceWith is fakeUserService with edit applied to the client
+// config first when it is non-nil.
+func fakeUserServiceWith(t testing.TB, h http.Handler, edit func(*Config)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	cfg := testConfig(t)
+	cfg.UserServiceURL = srv.URL
+	cfg.UserServiceBackoff = time.Millisecond
+	if edit != nil {
+		edit(&cfg)
+	}
+	userService = newUserServiceClient(cfg, newUserExistsCache(cfg.UserCacheTTL, cfg.UserCacheNegativeTTL))
+	return srv
+}
+
+// newTestRouter builds the real router from the default config, with edit
+// applied first when it is non-nil.
+func newTestRouter(t *testing.T, edit func(*Config)) *gin.Engine {
+	t.Helper()
+	cfg := testConfig(t)
+	if edit != nil {
+		edit(&cfg)
+	}
+	workers := newWorkerGroup()
+	t.Cleanup(func() { workers.stop(context.Background()) })
+	return newRouter(cfg, workers)
+}
+
+// bearer returns an Authorization header value for subject, signed with
+// testSecret and valid for an hour.
+func bearer(t *testing.T, subject, role string) string {
+	t.Helper()
+	claims := authClaims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return "Bearer " + token
+}
+
+// withMockMongo runs fn against a mock deployment with every collection the
+// handlers use pointed at it. Responses queued with mt.AddMockResponses are
+// consumed in the order the handler issues commands, whichever collection
+// they target. fn gets the subtest's t so failures are reported there.
+func withMockMongo(t *testing.T, fn func(t *testing.T, mt *mtest.T)) {
+	t.Helper()
+	mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock)).Run("mock", func(mt *mtest.T) {
+		mongoClient = mt.Client
+		postCollection = mt.Coll
+		historyCollection = mt.Coll
+		reportsCollection = mt.Coll
+		idempotencyCollection = mt.Coll
+		outboxCollection = nil
+		fn(mt.T, mt)
+	})
+}
+
+// docs converts values to the documents a mock cursor returns.
+func docs(t *testing.T, values ...any) []bson.D {
+	t.Helper()
+	out := make([]bson.D, len(values))
+	for i, v := range values {
+		raw, err := bson.Marshal(v)
+		if err != nil {
+			t.Fatalf("marshal %T: %v", v, err)
+		}
+		if err := bson.Unmarshal(raw, &out[i]); err != nil {
+			t.Fatalf("unmarshal %T: %v", v, err)
+		}
+	}
+	return out
+}
+
+// findResponse is the reply to a find or aggregate returning values.
+func findResponse(t *testing.T, values ...any) bson.D {
+	t.Helper()
+	return mtest.CreateCursorResponse(0, "test.posts", mtest.FirstBatch, docs(t, values...)...)
+}
+
+// countResponse is the reply to CountDocuments.
+func countResponse(n int) bson.D {
+	return mtest.CreateCursorResponse(0, "test.posts", mtest.FirstBatch, bson.D{{Key: "n", Value: n}})
+}
+
+// writeResponse is the reply to an insert, update or delete touching n
+// documents.
+func writeResponse(n int) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+}
+
+// findAndModifyResponse is the reply to FindOneAndUpdate; a nil value means
+// nothing matched.
+func findAndModifyResponse(t *testing.T, value any) bson.D {
+	t.Helper()
+	if value == nil {
+		return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil})
+	}
+	return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: docs(t, value)[0]})
+}
+
+// startedCommand returns the last command named name that the handler sent,
+// failing the test when there was none.
+func startedCommand(t *testing.T, mt *mtest.T, name string) bson.Raw {
+	t.Helper()
+	var found bson.Raw
+	for _, ev := range mt.GetAllStartedEvents() {
+		if ev.CommandName == name {
+			found = ev.Command
+		}
+	}
+	if found == nil {
+		t.Fatalf("no %s command was sent", name)
+	}
+	return found
+}
+
+// commandsNamed returns every command named name, in the order sent.
+func commandsNamed(mt *mtest.T, name string) []bson.Raw {
+	var out []bson.Raw
+	for _, ev := range mt.GetAllStartedEvents() {
+		if ev.CommandName == name {
+			out = append(out, ev.Command)
+		}
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var historyCollection *mongo.Collection
+
+type historyEntry struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PostID     primitive.ObjectID `bson:"post_id" json:"post_id"`
+	Action     string             `bson:"action" json:"action"`
+	EditedBy   string             `bson:"edited_by" json:"edited_by"`
+	RecordedAt time.Time          `bson:"recorded_at" json:"recorded_at"`
+	Snapshot   Post               `bson:"snapshot" json:"snapshot"`
+}
+
+// recordHistory appends the state of post as it was before action. A failed
+// write is logged rather than failing an edit that already succeeded.
+func recordHistory(ctx context.Context, c *gin.Context, action string, before Post) {
+	if err := insertHistory(ctx, c, action, before); err != nil {
+		slog.ErrorContext(ctx, "cannot record post history", "error", err, "post_id", before.ID.Hex(), "action", action)
+	}
+}
+
+func insertHistory(ctx context.Context, c *gin.Context, action string, before Post) error {
+	entry := historyEntry{
+		PostID:     before.ID,
+		Action:     action,
+		EditedBy:   c.GetString(authSubjectKey),
+		RecordedAt: time.Now().UTC(),
+		Snapshot:   before,
+	}
+	_, err := historyCollection.InsertOne(ctx, entry)
+	return err
+}
+
+func getPostHistory(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objID, ok := parseObjectID(c, "postID")
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondError(c, 400, codeBadRequest, err.Error())
+		return
+	}
+
+	// Admins can still read the history of a hard-deleted post; it holds the
+	// only copy.
+	var post Post
+	err = postCollection.FindOne(ctx, bson.M{"_id": objID}, options.FindOne().SetProjection(bson.M{"user_id": 1})).Decode(&post)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments) && c.GetString(authRoleKey) == roleAdmin:
+	case errors.Is(err, mongo.ErrNoDocuments):
+		respondError(c, 404, codeNotFound, "post not found")
+		return
+	case err != nil:
+		respondInternalError(c, err)
+		return
+	}
+	if !isSelfOrAdmin(c, post.UserID) {
+		respondError(c, 403, codeForbidden, "only the author or an admin can see post history")
+		return
+	}
+
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "recorded_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit).
+		SetSkip(offset)
+
+	cursor, err := historyCollection.Find(ctx, bson.M{"post_id": objID}, findOpts)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	entries := []historyEntry{}
+	if err = cursor.All(ctx, &entries); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"post_id": objID,
+		"history": entries,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestHistorySnapshots(t *testing.T) {
+	const owner = "64b000000000000000000001"
+	token := bearer(t, owner, "")
+	existing := func() Post {
+		return Post{ID: primitive.NewObjectID(), UserID: owner, Title: "Before", Content: "old", Version: 3}
+	}
+
+	// snapshot returns the history entry the handler wrote, failing unless
+	// there was exactly one.
+	snapshot := func(t *testing.T, mt *mtest.T) bson.Raw {
+		t.Helper()
+		var entries []bson.Raw
+		for _, cmd := range commandsNamed(mt, "insert") {
+			entries = append(entries, cmd.Lookup("documents", "0").Document())
+		}
+		if len(entries) != 1 {
+			t.Fatalf("wrote %d history entries, want 1", len(entries))
+		}
+		return entries[0]
+	}
+	check := func(t *testing.T, entry bson.Raw, before Post, action, editor string) {
+		t.Helper()
+		if got := entry.Lookup("action").StringValue(); got != action {
+			t.Errorf("action = %q, want %q", got, action)
+		}
+		if got := entry.Lookup("edited_by").StringValue(); got != editor {
+			t.Errorf("edited_by = %q, want %q", got, editor)
+		}
+		if got := entry.Lookup("post_id").ObjectID(); got != before.ID {
+			t.Errorf("post_id = %s, want %s", got.Hex(), before.ID.Hex())
+		}
+		if d := time.Since(entry.Lookup("recorded_at").Time()); d < 0 || d > time.Minute {
+			t.Errorf("recorded_at %v ago, want just now", d)
+		}
+		if title, version := entry.Lookup("snapshot", "title").StringValue(), entry.Lookup("snapshot", "version").Int32(); title != before.Title || int(version) != before.Version {
+			t.Errorf("snapshot = %q v%d, want the post before the change %q v%d", title, version, before.Title, before.Version)
+		}
+	}
+
+	t.Run("update", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			before := existing()
+			after := before
+			after.Title, after.Version = "After", 4
+			mt.AddMockResponses(findResponse(t, before), writeResponse(1), writeResponse(1), findResponse(t, after))
+
+			body := `{"title":"After","content":"new","version":3}`
+			if w := serve(r, "PUT", "/posts/"+before.ID.Hex(), body, "Authorization", token); w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			check(t, snapshot(t, mt), before, "update", owner)
+		})
+	})
+
+	t.Run("soft delete", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			before := existing()
+			mt.AddMockResponses(findResponse(t, before), writeResponse(1), writeResponse(1))
+
+			if w := serve(r, "DELETE", "/posts/"+before.ID.Hex(), "", "Authorization", token); w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			check(t, snapshot(t, mt), before, "delete", owner)
+		})
+	})
+
+	t.Run("hard delete", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			const admin = "64b0000000000000000000ad"
+			before := existing()
+			mt.AddMockResponses(findResponse(t, before), writeResponse(1), writeResponse(1), writeResponse(0))
+
+			w := serve(r, "DELETE", "/posts/"+before.ID.Hex()+"?hard=true", "", "Authorization", bearer(t, admin, roleAdmin))
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			check(t, snapshot(t, mt), before, "hard_delete", admin)
+		})
+	})
+
+	t.Run("failed update writes nothing", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			before := existing()
+			mt.AddMockResponses(findResponse(t, before))
+
+			body := `{"title":"After","content":"new","version":2}`
+			if w := serve(r, "PUT", "/posts/"+before.ID.Hex(), body, "Authorization", token); w.Code != 409 {
+				t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+			}
+			if n := len(commandsNamed(mt, "insert")); n != 0 {
+				t.Errorf("wrote %d history entries for a rejected update", n)
+			}
+		})
+	})
+}
+
+func TestGetPostHistory(t *testing.T) {
+	const owner = "64b000000000000000000001"
+	postID := primitive.NewObjectID()
+	path := "/posts/" + postID.Hex() + "/history"
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	entries := []any{
+		historyEntry{ID: primitive.NewObjectID(), PostID: postID, Action: "delete", EditedBy: owner, RecordedAt: now},
+		historyEntry{ID: primitive.NewObjectID(), PostID: postID, Action: "update", EditedBy: owner, RecordedAt: now.Add(-time.Hour)},
+	}
+
+	t.Run("newest first for the author", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t, Post{ID: postID, UserID: owner}), findResponse(t, entries...))
+
+			w := serve(r, "GET", path, "", "Authorization", bearer(t, owner, ""))
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var body struct {
+				PostID  primitive.ObjectID `json:"post_id"`
+				History []historyEntry     `json:"history"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.PostID != postID || len(body.History) != 2 || body.History[0].Action != "delete" {
+				t.Errorf("body = %s", w.Body)
+			}
+
+			find := startedCommand(t, mt, "find")
+			if got := find.Lookup("filter", "post_id").ObjectID(); got != postID {
+				t.Errorf("history filter post_id = %s, want %s", got.Hex(), postID.Hex())
+			}
+			if sort := find.Lookup("sort").Document().String(); sort != `{"recorded_at": {"$numberInt":"-1"},"_id": {"$numberInt":"-1"}}` {
+				t.Errorf("sort = %s, want newest first", sort)
+			}
+		})
+	})
+
+	t.Run("other users are refused", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t, Post{ID: postID, UserID: owner}))
+
+			w := serve(r, "GET", path, "", "Authorization", bearer(t, primitive.NewObjectID().Hex(), ""))
+			if w.Code != 403 {
+				t.Errorf("status = %d, want 403", w.Code)
+			}
+		})
+	})
+
+	t.Run("admin reads a hard-deleted post", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t), findResponse(t, entries...))
+
+			w := serve(r, "GET", path, "", "Authorization", bearer(t, primitive.NewObjectID().Hex(), roleAdmin))
+			if w.Code != 200 {
+				t.Errorf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+		})
+	})
+
+	t.Run("unknown post", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t))
+
+			w := serve(r, "GET", path, "", "Authorization", bearer(t, owner, ""))
+			if w.Code != 404 {
+				t.Errorf("status = %d, want 404", w.Code)
+			}
+		})
+	})
+}
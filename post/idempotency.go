@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+)
+
+var (
+	errIdempotencyInFlight = errors.New("a request with this Idempotency-Key is still in progress")
+	errIdempotencyMismatch = errors.New("Idempotency-Key was already used with a different request body")
+)
+
+var idempotencyCollection *mongo.Collection
+
+type idempotencyRecord struct {
+	Key         string             `bson:"_id"`
+	Fingerprint string             `bson:"fingerprint"`
+	PostID      primitive.ObjectID `bson:"post_id,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at"`
+}
+
+// idempotencyKey scopes the client-supplied key to the caller so two users
+// cannot collide on (or replay) each other's keys.
+func idempotencyKey(c *gin.Context) (string, error) {
+	key := strings.TrimSpace(c.GetHeader(idempotencyKeyHeader))
+	if key == "" {
+		return "", nil
+	}
+	if len(key) > maxIdempotencyKeyLen {
+		return "", errors.New("Idempotency-Key must be at most 255 characters")
+	}
+	return c.GetString(authSubjectKey) + ":" + key, nil
+}
+
+func postFingerprint(post Post) string {
+	h := sha256.New()
+	for _, part := range []string{post.UserID, post.Title, post.Content, strings.Join(post.Tags, ",")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// reserveIdempotencyKey claims key for a new request. If the key was already
+// used for the same request and finished, it returns the stored post ID.
+func reserveIdempotencyKey(ctx context.Context, key, fingerprint string) (primitive.ObjectID, error) {
+	record := idempotencyRecord{Key: key, Fingerprint: fingerprint, CreatedAt: time.Now().UTC()}
+	_, err := idempotencyCollection.InsertOne(ctx, record)
+	if err == nil {
+		return primitive.NilObjectID, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return primitive.NilObjectID, err
+	}
+
+	var existing idempotencyRecord
+	err = idempotencyCollection.FindOne(ctx, bson.M{"_id": key}).Decode(&existing)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// The holder released or expired the key between our insert and
+		// this read; a retry will be able to reserve it.
+		return primitive.NilObjectID, errIdempotencyInFlight
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if existing.Fingerprint != fingerprint {
+		return primitive.NilObjectID, errIdempotencyMismatch
+	}
+	if existing.PostID.IsZero() {
+		return primitive.NilObjectID, errIdempotencyInFlight
+	}
+	return existing.PostID, nil
+}
+
+func completeIdempotencyKey(ctx context.Context, key string, postID primitive.ObjectID) error {
+	_, err := idempotencyCollection.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"post_id": postID}})
+	return err
+}
+
+// releaseIdempotencyKey drops a reservation whose request failed so the
+// client can retry with the same key.
+func releaseIdempotencyKey(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	idempotencyCollection.DeleteOne(ctx, bson.M{"_id": key, "post_id": bson.M{"$exists": false}})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCreatePostIdempotencyKey(t *testing.T) {
+	const author = "64b000000000000000000001"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"Alice"}`))
+	}))
+	token := bearer(t, author, "")
+	body := `{"user_id":"` + author + `","title":"Hello","content":"World"}`
+	fingerprint := postFingerprint(Post{UserID: author, Title: "Hello", Content: "World"})
+	duplicate := mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "duplicate key"})
+	original := Post{ID: primitive.NewObjectID(), UserID: author, Title: "Hello", Content: "World"}
+
+	create := func(t *testing.T, mt *mtest.T, key string) (int, Post, http.Header) {
+		t.Helper()
+		r := newTestRouter(t, nil)
+		w := serve(r, "POST", "/posts", body, "Authorization", token, idempotencyKeyHeader, key)
+		var post Post
+		if w.Code < 300 {
+			if err := json.Unmarshal(w.Body.Bytes(), &post); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, post, w.Header()
+	}
+
+	t.Run("new key creates a post", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			// Reserve the key, look up the slug, insert, then record the post.
+			mt.AddMockResponses(writeResponse(1), findResponse(t), writeResponse(1), writeResponse(1))
+
+			status, post, header := create(t, mt, "retry-1")
+			if status != 201 || post.ID.IsZero() {
+				t.Fatalf("status = %d, post %+v; want a new post", status, post)
+			}
+			if header.Get("Idempotent-Replayed") != "" {
+				t.Error("a first request was marked as replayed")
+			}
+			inserts := commandsNamed(mt, "insert")
+			if len(inserts) != 2 {
+				t.Fatalf("sent %d inserts, want the key and the post", len(inserts))
+			}
+			if reserved := inserts[0].Lookup("documents", "0", "_id").StringValue(); reserved != author+":retry-1" {
+				t.Errorf("reserved key %q, want it scoped to the caller", reserved)
+			}
+			recorded := startedCommand(t, mt, "update").Lookup("updates", "0", "u", "$set", "post_id").ObjectID()
+			if recorded != post.ID {
+				t.Errorf("recorded post %s, want %s", recorded.Hex(), post.ID.Hex())
+			}
+		})
+	})
+
+	t.Run("repeated key returns the same post", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			mt.AddMockResponses(
+				duplicate,
+				findResponse(t, bson.M{"_id": author + ":retry-1", "fingerprint": fingerprint, "post_id": original.ID}),
+				findResponse(t, original),
+			)
+
+			status, post, header := create(t, mt, "retry-1")
+			if status != 201 || post.ID != original.ID {
+				t.Fatalf("status = %d, post %s; want the original %s", status, post.ID.Hex(), original.ID.Hex())
+			}
+			if header.Get("Idempotent-Replayed") != "true" {
+				t.Error("replay is not marked Idempotent-Replayed")
+			}
+			if n := len(commandsNamed(mt, "insert")); n != 1 {
+				t.Errorf("sent %d inserts, want only the key reservation", n)
+			}
+		})
+	})
+
+	t.Run("key still in flight", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			mt.AddMockResponses(duplicate, findResponse(t, bson.M{"_id": author + ":retry-1", "fingerprint": fingerprint}))
+
+			if status, _, _ := create(t, mt, "retry-1"); status != 409 {
+				t.Errorf("status = %d, want 409", status)
+			}
+		})
+	})
+
+	t.Run("key reused with another body", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			mt.AddMockResponses(duplicate, findResponse(t, bson.M{"_id": author + ":retry-1", "fingerprint": "other", "post_id": original.ID}))
+
+			if status, _, _ := create(t, mt, "retry-1"); status != 422 {
+				t.Errorf("status = %d, want 422", status)
+			}
+		})
+	})
+}
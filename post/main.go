@@ -1,177 +1,2063 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 type Post struct {
-	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	UserID  string             `bson:"user_id" json:"user_id"`
-	Title   string             `bson:"title" json:"title"`
-	Content string             `bson:"content" json:"content"`
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" xml:"id,omitempty"`
+	UserID    string             `bson:"user_id" json:"user_id" xml:"user_id"` // hex form of the owning user's ObjectID
+	UserName  string             `bson:"user_name,omitempty" json:"user_name,omitempty" xml:"user_name,omitempty"`
+	Title     string             `bson:"title" json:"title" xml:"title"`
+	Content   string             `bson:"content" json:"content" xml:"content"`
+	Slug      string             `bson:"slug,omitempty" json:"slug,omitempty" xml:"slug,omitempty"`
+	Tags      []string           `bson:"tags,omitempty" json:"tags,omitempty" xml:"tags>tag,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at" xml:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at" xml:"updated_at"`
+	Likes     int                `bson:"likes" json:"likes" xml:"likes"`
+	Version   int                `bson:"version" json:"version" xml:"version"`
+	PublishAt *time.Time         `bson:"publish_at,omitempty" json:"publish_at,omitempty" xml:"publish_at,omitempty"`
+	Published bool               `bson:"published" json:"published" xml:"published"`
+	DeletedAt *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" xml:"deleted_at,omitempty"`
+	ExpiresAt *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty" xml:"expires_at,omitempty"`
+
+	ReportCount   int    `bson:"report_count,omitempty" json:"report_count,omitempty" xml:"report_count,omitempty"`
+	Hidden        bool   `bson:"hidden,omitempty" json:"hidden,omitempty" xml:"hidden,omitempty"`
+	DeletedReason string `bson:"deleted_reason,omitempty" json:"deleted_reason,omitempty" xml:"deleted_reason,omitempty"` // set when a moderator or the orphan reconciler deleted the post
+
+	TTLSeconds int64 `bson:"-" json:"ttl_seconds,omitempty" xml:"-"`
 }
 
-var postCollection *mongo.Collection
+var (
+	mongoClient    *mongo.Client
+	postCollection *mongo.Collection
+
+	// requestTimeout bounds each handler's work; newRouter sets it from
+	// REQUEST_TIMEOUT.
+	requestTimeout = 5 * time.Second
+
+	// bulkRequestTimeout bounds handlers that work through a whole batch;
+	// newRouter sets it from BULK_REQUEST_TIMEOUT.
+	bulkRequestTimeout = 30 * time.Second
+
+	// defaultPageSize and maxPageSize bound list endpoints; newRouter sets
+	// them from DEFAULT_PAGE_SIZE and MAX_PAGE_SIZE.
+	defaultPageSize int64 = 20
+	maxPageSize     int64 = 100
+
+	// strictUserCheck makes reads fail when the user service cannot confirm
+	// the user exists; newRouter sets it from STRICT_USER_CHECK.
+	strictUserCheck = true
+
+	// duplicateWindow is how far back createPost looks for an identical post
+	// by the same user; newRouter sets it from DUPLICATE_POST_WINDOW. Zero
+	// turns the check off.
+	duplicateWindow time.Duration
+
+	// indexesReady flips once ensureIndexes succeeds; healthz reports 503
+	// until then.
+	indexesReady atomic.Bool
+)
+
+const (
+	maxFeedUsers = 100
+	maxPostIDs   = 100
+)
+
+// Values of Post.DeletedReason. Owners cannot restore posts deleted for these
+// reasons; admins can.
+const (
+	deletedByModeration = "moderation"
+	deletedAsOrphan     = "orphaned_user"
+)
 
 func main() {
-	r := gin.Default()
+	slog.SetDefault(newLogger())
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		panic(err)
+	}
 
-	mongoURI := os.Getenv("MONGO_URI")
-	if mongoURI == "" {
-		mongoURI = "mongodb://localhost:27017"
+	shutdownTracing, err := setupTracing(context.Background(), "post-service", cfg.OTLPEndpoint)
+	if err != nil {
+		panic(err)
 	}
 
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(mongoURI))
+	client, err := connectMongo(cfg)
 	if err != nil {
 		panic(err)
 	}
-	defer client.Disconnect(context.TODO())
 
-	postCollection = client.Database("TTTN").Collection("posts")
+	mongoClient = client
+	postCollection = client.Database(cfg.MongoDB).Collection(cfg.PostCollection)
+	idempotencyCollection = client.Database(cfg.MongoDB).Collection(cfg.IdempotencyCollection)
+	historyCollection = client.Database(cfg.MongoDB).Collection(cfg.HistoryCollection)
+	reportsCollection = client.Database(cfg.MongoDB).Collection(cfg.ReportsCollection)
+	if cfg.BrokerURL != "" {
+		outboxCollection = client.Database(cfg.MongoDB).Collection(cfg.OutboxCollection)
+	}
+	slog.Info("using mongo collection", "database", cfg.MongoDB, "collection", cfg.PostCollection)
+	if err := prepareIndexes(cfg); err != nil {
+		panic(err)
+	}
+
+	userService = newUserServiceClient(cfg, newUserExistsCache(cfg.UserCacheTTL, cfg.UserCacheNegativeTTL))
+
+	// Workers outlive the signal context: they are stopped only after the
+	// server has drained, so work queued by the last requests still runs.
+	workers := newWorkerGroup()
+
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: newRouter(cfg, workers),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	workers.start("scheduled-publisher", func(ctx context.Context) {
+		runScheduledPublisher(ctx, cfg.PublishInterval)
+	})
+	if cfg.ReconcileInterval > 0 {
+		workers.start("orphan-reconciler", func(ctx context.Context) {
+			runOrphanReconciler(ctx, cfg.ReconcileInterval)
+		})
+	}
+	if outboxCollection != nil {
+		workers.start("outbox-publisher", newOutboxPublisher(cfg).run)
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("listen failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	slog.Info("shutting down post-service")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("server shutdown failed", "error", err)
+	}
+	if err := workers.stop(shutdownCtx); err != nil {
+		slog.Error("background workers did not stop", "error", err)
+	}
+	if err := client.Disconnect(shutdownCtx); err != nil {
+		slog.Error("mongo disconnect failed", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("tracing shutdown failed", "error", err)
+	}
+}
+
+func newRouter(cfg Config, workers *workerGroup) *gin.Engine {
+	registerJSONFieldNames()
+	contentPolicy = newContentPolicy(cfg.ContentPolicy)
+	contentAllowsHTML = cfg.ContentPolicy == contentPolicyBasic
+
+	requestTimeout = cfg.RequestTimeout
+	bulkRequestTimeout = cfg.BulkRequestTimeout
+	defaultPageSize = int64(cfg.DefaultPageSize)
+	maxPageSize = int64(cfg.MaxPageSize)
+	strictUserCheck = cfg.StrictUserCheck
+	duplicateWindow = cfg.DuplicateWindow
+	readOnly.Store(cfg.ReadOnly)
+
+	r := gin.New()
+	// Only proxies listed in TRUSTED_PROXIES may name the client in
+	// X-Forwarded-For or X-Real-IP; from anyone else those headers are
+	// ignored, so clients cannot pick their own rate-limit bucket.
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		slog.Error("ignoring TRUSTED_PROXIES", "error", err)
+		r.SetTrustedProxies(nil)
+	}
+	r.HandleMethodNotAllowed = true
+	r.NoMethod(methodNotAllowed)
+	r.Use(
+		otelgin.Middleware("post-service"),
+		requestID(),
+		requestLogger(cfg.SlowRequest, pprofPrefix),
+		metricsMiddleware(),
+		jsonRecovery(),
+		cors(cfg.CORSAllowedOrigins),
+		gzipCompression("/metrics", pprofPrefix),
+		bodyLimit(int64(cfg.MaxBodyBytes), map[string]int64{
+			"/posts/bulk": int64(cfg.BulkMaxBodyBytes),
+		}),
+		readOnlyGuard(map[string]bool{
+			"/posts/by-ids":   true,
+			"/posts/feed":     true,
+			"/posts/validate": true,
+		}),
+	)
+
+	auth := authRequired([]byte(cfg.JWTSecret))
+
+	limiter := newIPRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst)
+	workers.start("rate-limit-eviction", func(ctx context.Context) {
+		limiter.runEviction(ctx, time.Minute, 10*time.Minute)
+	})
+	rateLimit := limiter.middleware()
 
 	r.GET("/ping", func(c *gin.Context) {
 		c.String(200, "post pong")
 	})
+	r.GET("/healthz", healthz)
+	r.GET("/version", versionInfo)
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	if cfg.EnablePprof {
+		registerPprof(r, auth, adminOnly)
+	}
+
+	r.GET("/posts", auth, adminOnly, listAllPosts)
+	optionalAuth := authOptional([]byte(cfg.JWTSecret))
+	r.GET("/posts/:userID", optionalAuth, getPostsByUserID)
+	r.GET("/posts/:userID/history", auth, paramAlias("userID", "postID"), getPostHistory)
+	r.GET("/posts/:userID/exists", paramAlias("userID", "postID"), checkPostExists)
+	r.GET("/posts/search", searchPosts)
+	r.GET("/posts/recent", getRecentPosts)
+	r.GET("/posts/single/:postID", optionalAuth, getPostByID)
+	r.GET("/posts/slug/:slug", optionalAuth, getPostBySlug)
+	r.GET("/posts/count/:userID", countPostsByUserID)
+	r.GET("/posts/stats/:userID", getPostStats)
+	r.GET("/users/:userID/posts", getUserPosts)
+	r.POST("/posts", rateLimit, auth, createPost)
+	r.POST("/posts/bulk", rateLimit, auth, bulkCreatePosts(cfg.BulkMaxPosts))
+	r.POST("/posts/validate", rateLimit, auth, validatePostPreview)
+	r.POST("/posts/feed", getFeed)
+	r.POST("/posts/by-ids", getPostsByIDs)
+	r.PUT("/posts/:postID", auth, updatePost)
+	r.PATCH("/posts/:postID", auth, patchPost)
+	r.DELETE("/posts/:postID", auth, deletePost)
+	r.POST("/posts/:postID/restore", auth, restorePost)
+	r.POST("/posts/:postID/like", auth, likePost)
+	r.POST("/posts/:postID/unlike", auth, unlikePost)
+	r.POST("/posts/:postID/report", rateLimit, auth, reportPost(cfg.ReportHideThreshold))
+	r.POST("/posts/:postID/clone", rateLimit, auth, clonePost)
+	r.POST("/posts/:postID/transfer", auth, adminOnly, transferPost)
+	r.DELETE("/posts/by-user/:userID", auth, deletePostsByUserID)
+	r.POST("/posts/by-user/:userID/refresh-name", auth, refreshUserName)
+	r.POST("/admin/reconcile-orphans", auth, adminOnly, reconcileOrphans)
+	r.GET("/admin/reports", auth, adminOnly, listReportedPosts)
+	r.GET("/admin/top-authors", auth, adminOnly, getTopAuthors)
+	r.GET("/admin/read-only", auth, adminOnly, getReadOnly)
+	r.PUT("/admin/read-only", auth, adminOnly, setReadOnly)
+	r.POST("/admin/posts/:postID/moderate", auth, adminOnly, moderatePost)
+
+	return r
+}
+
+func connectMongo(cfg Config) (*mongo.Client, error) {
+	clientOpts := options.Client().
+		ApplyURI(cfg.MongoURI).
+		SetMaxPoolSize(uint64(cfg.MongoMaxPoolSize)).
+		SetMinPoolSize(uint64(cfg.MongoMinPoolSize)).
+		SetPoolMonitor(mongoPoolMonitor()).
+		SetMonitor(mongoTracingMonitor())
+	if cfg.MongoTLSCAFile != "" || cfg.MongoTLSCertFile != "" {
+		tlsConfig, err := mongoTLSConfig(cfg.MongoTLSCAFile, cfg.MongoTLSCertFile)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts.SetTLSConfig(tlsConfig)
+	}
+	slog.Info("mongo connection pool configured",
+		"max_pool_size", cfg.MongoMaxPoolSize,
+		"min_pool_size", cfg.MongoMinPoolSize,
+	)
+
+	client, err := mongo.Connect(context.TODO(), clientOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := cfg.MongoConnectRetries
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		err = client.Ping(ctx, nil)
+		cancel()
+		if err == nil {
+			return client, nil
+		}
+		if attempt >= attempts {
+			client.Disconnect(context.TODO())
+			return nil, fmt.Errorf("cannot ping mongo after %d attempts: %w", attempt, err)
+		}
+
+		slog.Warn("mongo ping failed, retrying",
+			"attempt", attempt,
+			"max_attempts", attempts,
+			"retry_in", backoff.String(),
+			"error", err,
+		)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// prepareIndexes builds every index and only then marks the service ready.
+// main opens its port after this returns, so no request is served, and
+// healthz stays "starting", while an index is missing.
+func prepareIndexes(cfg Config) error {
+	if err := ensureIndexes(cfg); err != nil {
+		return err
+	}
+	indexesReady.Store(true)
+	return nil
+}
 
-	r.GET("/posts/:userID", getPostsByUserID)
-	r.POST("/posts", createPost)
-	r.DELETE("/posts/:postID", deletePost)
+func ensureIndexes(cfg Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.IndexTimeout)
+	defer cancel()
+
+	var errs []error
+
+	textIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "title", Value: "text"}, {Key: "content", Value: "text"}},
+		Options: options.Index().SetName("posts_text"),
+	}
+	errs = append(errs, createIndex(ctx, postCollection, textIndex))
+
+	feedIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("posts_user_created"),
+	}
+	errs = append(errs, createIndex(ctx, postCollection, feedIndex))
+
+	tagsIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "tags", Value: 1}},
+		Options: options.Index().SetName("posts_tags"),
+	}
+	errs = append(errs, createIndex(ctx, postCollection, tagsIndex))
+
+	recentIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+		Options: options.Index().SetName("posts_created"),
+	}
+	errs = append(errs, createIndex(ctx, postCollection, recentIndex))
+
+	slugIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "slug", Value: 1}},
+		Options: options.Index().
+			SetName("posts_slug").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"slug": bson.M{"$type": "string"}}),
+	}
+	errs = append(errs, createIndex(ctx, postCollection, slugIndex))
+
+	scheduledIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "publish_at", Value: 1}},
+		Options: options.Index().
+			SetName("posts_scheduled").
+			SetPartialFilterExpression(bson.M{"published": false}),
+	}
+	errs = append(errs, createIndex(ctx, postCollection, scheduledIndex))
+
+	ttlIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetName("posts_expires_at").SetExpireAfterSeconds(0),
+	}
+	errs = append(errs, createIndex(ctx, postCollection, ttlIndex))
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8081"
+	idempotencyIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().
+			SetName("idempotency_keys_ttl").
+			SetExpireAfterSeconds(int32(cfg.IdempotencyTTL.Seconds())),
 	}
-	r.Run(":" + port)
+	errs = append(errs, createIndex(ctx, idempotencyCollection, idempotencyIndex))
+
+	historyIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "post_id", Value: 1}, {Key: "recorded_at", Value: -1}},
+		Options: options.Index().SetName("post_history_post"),
+	}
+	errs = append(errs, createIndex(ctx, historyCollection, historyIndex))
+
+	reportIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "post_id", Value: 1}, {Key: "reporter", Value: 1}},
+		Options: options.Index().SetName("reports_post_reporter").SetUnique(true),
+	}
+	errs = append(errs, createIndex(ctx, reportsCollection, reportIndex))
+
+	reportedIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "report_count", Value: -1}, {Key: "_id", Value: -1}},
+		Options: options.Index().
+			SetName("posts_reported").
+			SetPartialFilterExpression(bson.M{"report_count": bson.M{"$gt": 0}}),
+	}
+	errs = append(errs, createIndex(ctx, postCollection, reportedIndex))
+
+	if outboxCollection != nil {
+		outboxIndex := mongo.IndexModel{
+			Keys:    bson.D{{Key: "sent_at", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("outbox_unsent"),
+		}
+		errs = append(errs, createIndex(ctx, outboxCollection, outboxIndex))
+	}
+
+	return errors.Join(errs...)
+}
+
+func createIndex(ctx context.Context, coll *mongo.Collection, model mongo.IndexModel) error {
+	name, err := coll.Indexes().CreateOne(ctx, model)
+	if err != nil {
+		return fmt.Errorf("cannot create index on %s: %w", coll.Name(), err)
+	}
+	slog.Info("index ready", "collection", coll.Name(), "index", name)
+	return nil
 }
 
 func getPostsByUserID(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
 	defer cancel()
 
-	userID := c.Param("userID")
+	userID, err := normalizeUserID(c.Param("userID"))
+	if err != nil {
+		respondError(c, 400, codeInvalidID, err.Error())
+		return
+	}
+
+	sortDirection := -1
+	switch c.DefaultQuery("order", "desc") {
+	case "desc":
+	case "asc":
+		sortDirection = 1
+	default:
+		respondError(c, 400, codeBadRequest, "order must be asc or desc")
+		return
+	}
 
-	exists, err := checkUserExists(userID)
+	limit, offset, err := parsePagination(c)
 	if err != nil {
-		c.JSON(502, gin.H{"error": "cannot connect to user-service"})
+		respondError(c, 400, codeBadRequest, err.Error())
 		return
 	}
-	if !exists {
-		c.JSON(404, gin.H{"error": "user does not exist"})
+
+	page, err := parseCursor(c)
+	if err != nil {
+		respondError(c, 400, codeBadRequest, err.Error())
+		return
+	}
+	if page.set && offset > 0 {
+		respondError(c, 400, codeBadRequest, "offset cannot be combined with after or before")
+		return
+	}
+
+	fields, projection, err := parseFields(c.Query("fields"))
+	if err != nil {
+		respondError(c, 400, codeBadRequest, err.Error())
+		return
+	}
+
+	includeDeleted, err := strconv.ParseBool(c.DefaultQuery("includeDeleted", "false"))
+	if err != nil {
+		respondError(c, 400, codeBadRequest, "includeDeleted must be true or false")
+		return
+	}
+
+	includeScheduled, err := strconv.ParseBool(c.DefaultQuery("includeScheduled", "false"))
+	if err != nil {
+		respondError(c, 400, codeBadRequest, "includeScheduled must be true or false")
+		return
+	}
+	if includeScheduled {
+		if c.GetString(authSubjectKey) == "" {
+			respondError(c, 401, codeUnauthorized, "includeScheduled requires a bearer token")
+			return
+		}
+		if !isSelfOrAdmin(c, userID) {
+			respondError(c, 403, codeForbidden, "only the user or an admin can see scheduled posts")
+			return
+		}
+	}
+
+	exists, err := userService.checkUserExists(ctx, userID)
+	switch {
+	case err != nil && strictUserCheck:
+		respondUserServiceError(c, err)
+		return
+	case err != nil:
+		slog.WarnContext(ctx, "serving posts without user check", "user_id", userID, "error", err)
+	case !exists:
+		respondError(c, 404, codeNotFound, "user does not exist")
+		return
+	}
+
+	filter := bson.M{"user_id": userID}
+	if !includeDeleted {
+		filter["deleted_at"] = nil
+	}
+	if !includeScheduled {
+		filter["published"] = bson.M{"$ne": false}
+	}
+	if !isSelfOrAdmin(c, userID) {
+		filter["hidden"] = bson.M{"$ne": true}
+	}
+	if tag := strings.ToLower(strings.TrimSpace(c.Query("tag"))); tag != "" {
+		filter["tags"] = tag
+	}
+
+	total, err := postCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		respondInternalError(c, err)
 		return
 	}
 
-	cursor, err := postCollection.Find(ctx, bson.M{"user_id": userID})
+	// Fetch one extra post to learn whether another page exists.
+	findOpts := options.Find().SetLimit(limit + 1)
+	if page.set {
+		direction := sortDirection
+		if page.backward {
+			direction = -direction
+		}
+		op := "$gt"
+		if direction < 0 {
+			op = "$lt"
+		}
+		filter["_id"] = bson.M{op: page.id}
+		findOpts.SetSort(bson.D{{Key: "_id", Value: direction}})
+	} else {
+		findOpts.
+			SetSort(bson.D{{Key: "created_at", Value: sortDirection}, {Key: "_id", Value: sortDirection}}).
+			SetSkip(offset)
+	}
+
+	if projection != nil {
+		findOpts.SetProjection(projection)
+	}
+
+	cursor, err := postCollection.Find(ctx, filter, findOpts)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondInternalError(c, err)
 		return
 	}
 	defer cursor.Close(ctx)
 
-	var posts []Post
+	posts := []Post{}
 	if err = cursor.All(ctx, &posts); err != nil {
-		c.JSON(500, gin.H{"error": "cannot decode posts"})
+		respondInternalError(c, err)
 		return
 	}
 
-	c.JSON(200, gin.H{
-		"user_id": userID,
-		"posts":   posts,
+	hasMore := int64(len(posts)) > limit
+	if hasMore {
+		posts = posts[:limit]
+	}
+	if page.backward {
+		slices.Reverse(posts)
+	}
+
+	var nextCursor, prevCursor string
+	if len(posts) > 0 {
+		first, last := posts[0].ID.Hex(), posts[len(posts)-1].ID.Hex()
+		if page.backward {
+			nextCursor = last
+			if hasMore {
+				prevCursor = first
+			}
+		} else {
+			if hasMore {
+				nextCursor = last
+			}
+			if page.set || offset > 0 {
+				prevCursor = first
+			}
+		}
+	}
+
+	var body any = posts
+	if fields != nil {
+		if body, err = projectPosts(posts, fields); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+	}
+
+	respondNegotiated(c, 200, gin.H{
+		"user_id":     userID,
+		"posts":       body,
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
+		"next_cursor": nextCursor,
+		"prev_cursor": prevCursor,
+	}, postPageXML{
+		UserID:     userID,
+		Total:      total,
+		Limit:      limit,
+		Offset:     offset,
+		NextCursor: nextCursor,
+		PrevCursor: prevCursor,
+		Posts:      posts,
 	})
 }
 
-func createPost(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// postPageXML is the XML form of a post listing. ?fields= is applied by the
+// Mongo projection alone, so unrequested fields come back empty rather than
+// absent.
+type postPageXML struct {
+	XMLName    xml.Name `xml:"posts"`
+	UserID     string   `xml:"user_id,attr"`
+	Total      int64    `xml:"total,attr"`
+	Limit      int64    `xml:"limit,attr"`
+	Offset     int64    `xml:"offset,attr"`
+	NextCursor string   `xml:"next_cursor,attr,omitempty"`
+	PrevCursor string   `xml:"prev_cursor,attr,omitempty"`
+	Posts      []Post   `xml:"post"`
+}
+
+type pageCursor struct {
+	id       primitive.ObjectID
+	backward bool
+	set      bool
+}
+
+func parseCursor(c *gin.Context) (pageCursor, error) {
+	after, before := c.Query("after"), c.Query("before")
+	if after != "" && before != "" {
+		return pageCursor{}, errors.New("after and before cannot be combined")
+	}
+
+	raw := cmp.Or(after, before)
+	if raw == "" {
+		return pageCursor{}, nil
+	}
+
+	id, err := primitive.ObjectIDFromHex(raw)
+	if err != nil {
+		return pageCursor{}, errors.New("cursor must be a post ID")
+	}
+	return pageCursor{id: id, backward: before != "", set: true}, nil
+}
+
+func listAllPosts(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
 	defer cancel()
 
-	var newPost Post
-	if err := c.ShouldBindJSON(&newPost); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondError(c, 400, codeBadRequest, err.Error())
 		return
 	}
 
-	exists, err := checkUserExists(newPost.UserID)
+	includeDeleted, err := strconv.ParseBool(c.DefaultQuery("includeDeleted", "false"))
 	if err != nil {
-		c.JSON(502, gin.H{"error": "cannot connect to user-service"})
+		respondError(c, 400, codeBadRequest, "includeDeleted must be true or false")
 		return
 	}
-	if !exists {
-		c.JSON(404, gin.H{"error": "user does not exist"})
+
+	filter := bson.M{}
+	if !includeDeleted {
+		filter["deleted_at"] = nil
+	}
+	if raw := c.Query("user_id"); raw != "" {
+		userID, err := normalizeUserID(raw)
+		if err != nil {
+			respondError(c, 400, codeInvalidID, err.Error())
+			return
+		}
+		filter["user_id"] = userID
+	}
+	if tag := strings.ToLower(strings.TrimSpace(c.Query("tag"))); tag != "" {
+		filter["tags"] = tag
+	}
+	if raw := c.Query("created_after"); raw != "" {
+		createdAfter, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			respondError(c, 400, codeBadRequest, "created_after must be an RFC 3339 timestamp")
+			return
+		}
+		filter["created_at"] = bson.M{"$gt": createdAfter.UTC()}
+	}
+
+	total, err := postCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		respondInternalError(c, err)
 		return
 	}
 
-	result, err := postCollection.InsertOne(ctx, newPost)
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit).
+		SetSkip(offset)
+
+	cursor, err := postCollection.Find(ctx, filter, findOpts)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondInternalError(c, err)
 		return
 	}
+	defer cursor.Close(ctx)
 
-	newPost.ID = result.InsertedID.(primitive.ObjectID)
-	c.JSON(201, newPost)
+	posts := []Post{}
+	if err = cursor.All(ctx, &posts); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"posts":  posts,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
 }
 
-func deletePost(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func getUserPosts(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
 	defer cancel()
 
-	postID := c.Param("postID")
-	objID, err := primitive.ObjectIDFromHex(postID)
+	userID, err := normalizeUserID(c.Param("userID"))
 	if err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		respondError(c, 400, codeInvalidID, err.Error())
 		return
 	}
 
-	res, err := postCollection.DeleteOne(ctx, bson.M{"_id": objID})
+	limit, offset, err := parsePagination(c)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondError(c, 400, codeBadRequest, err.Error())
 		return
 	}
 
-	if res.DeletedCount == 0 {
-		c.JSON(404, gin.H{"error": "post not found"})
+	name, found, err := userService.lookupUserName(ctx, userID)
+	if err != nil {
+		respondUserServiceError(c, err)
+		return
+	}
+	if !found {
+		respondError(c, 404, codeNotFound, "user does not exist")
 		return
 	}
 
-	c.JSON(200, gin.H{"message": "post deleted"})
+	filter := visibleFilter()
+	filter["user_id"] = userID
+
+	total, err := postCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit).
+		SetSkip(offset)
+
+	cursor, err := postCollection.Find(ctx, filter, findOpts)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	posts := []Post{}
+	if err = cursor.All(ctx, &posts); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"user_id":   userID,
+		"user_name": name,
+		"posts":     posts,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+func parsePagination(c *gin.Context) (int64, int64, error) {
+	limit := defaultPageSize
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return 0, 0, errors.New("limit must be an integer")
+		}
+		limit = clampPageSize(v)
+	}
+
+	var offset int64
+	if raw := c.Query("offset"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+		offset = v
+	}
+
+	return limit, offset, nil
+}
+
+func clampPageSize(limit int64) int64 {
+	return min(max(limit, 1), maxPageSize)
 }
 
-func checkUserExists(userID string) (bool, error) {
-	userServiceURL := os.Getenv("USER_SERVICE_URL")
-	if userServiceURL == "" {
-		userServiceURL = "http://localhost:8080"
+func getFeed(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	var body struct {
+		UserIDs []string `json:"user_ids" binding:"required"`
+		Limit   int64    `json:"limit"`
+		Offset  int64    `json:"offset"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if len(body.UserIDs) == 0 {
+		respondError(c, 400, codeBadRequest, "user_ids must not be empty")
+		return
+	}
+	if len(body.UserIDs) > maxFeedUsers {
+		respondError(c, 400, codeBadRequest, fmt.Sprintf("user_ids must contain at most %d entries", maxFeedUsers))
+		return
+	}
+	if body.Offset < 0 {
+		respondError(c, 400, codeBadRequest, "offset must be a non-negative integer")
+		return
+	}
+
+	limit := defaultPageSize
+	if body.Limit != 0 {
+		limit = clampPageSize(body.Limit)
+	}
+
+	seen := make(map[string]bool, len(body.UserIDs))
+	userIDs := make([]string, 0, len(body.UserIDs))
+	for _, raw := range body.UserIDs {
+		id, err := normalizeUserID(raw)
+		if err != nil {
+			respondError(c, 400, codeInvalidID, err.Error())
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			userIDs = append(userIDs, id)
+		}
+	}
+
+	exists, err := userService.checkUsersExist(ctx, userIDs)
+	if err != nil {
+		respondUserServiceError(c, err)
+		return
+	}
+	var unknown []string
+	for _, id := range userIDs {
+		if !exists[id] {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) > 0 {
+		respondError(c, 404, codeNotFound, "users do not exist: "+strings.Join(unknown, ", "))
+		return
 	}
 
-	url := fmt.Sprintf("%s/users/exists/%s", userServiceURL, userID)
+	filter := visibleFilter()
+	filter["user_id"] = bson.M{"$in": userIDs}
 
-	client := &http.Client{
-		Timeout: 3 * time.Second,
+	total, err := postCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		respondInternalError(c, err)
+		return
 	}
 
-	resp, err := client.Get(url)
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit).
+		SetSkip(body.Offset)
+
+	cursor, err := postCollection.Find(ctx, filter, findOpts)
 	if err != nil {
-		return false, err
+		respondInternalError(c, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	posts := []Post{}
+	if err = cursor.All(ctx, &posts); err != nil {
+		respondInternalError(c, err)
+		return
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		ID     string `json:"id"`
-		Exists bool   `json:"exists"`
+	c.JSON(200, gin.H{
+		"user_ids": userIDs,
+		"posts":    posts,
+		"total":    total,
+		"limit":    limit,
+		"offset":   body.Offset,
+	})
+}
+
+func countPostsByUserID(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	userID, err := normalizeUserID(c.Param("userID"))
+	if err != nil {
+		respondError(c, 400, codeInvalidID, err.Error())
+		return
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return false, err
+	filter := visibleFilter()
+	filter["user_id"] = userID
+	count, err := postCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		respondInternalError(c, err)
+		return
 	}
 
-	return result.Exists, nil
+	c.JSON(200, gin.H{
+		"user_id": userID,
+		"count":   count,
+	})
+}
+
+type postStats struct {
+	TotalPosts  int64      `bson:"total_posts"`
+	TotalLikes  int64      `bson:"total_likes"`
+	FirstPostAt *time.Time `bson:"first_post_at"`
+	LastPostAt  *time.Time `bson:"last_post_at"`
 }
 
+func getPostStats(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	userID, err := normalizeUserID(c.Param("userID"))
+	if err != nil {
+		respondError(c, 400, codeInvalidID, err.Error())
+		return
+	}
+
+	filter := visibleFilter()
+	filter["user_id"] = userID
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":           nil,
+			"total_posts":   bson.M{"$sum": 1},
+			"total_likes":   bson.M{"$sum": "$likes"},
+			"first_post_at": bson.M{"$min": "$created_at"},
+			"last_post_at":  bson.M{"$max": "$created_at"},
+		}}},
+	}
+
+	cursor, err := postCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	// $group emits nothing when no posts match, which leaves the zero stats.
+	var stats postStats
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&stats); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"user_id":       userID,
+		"total_posts":   stats.TotalPosts,
+		"total_likes":   stats.TotalLikes,
+		"first_post_at": stats.FirstPostAt,
+		"last_post_at":  stats.LastPostAt,
+	})
+}
+
+// getRecentPosts is the global timeline: the newest live posts from every
+// user.
+func getRecentPosts(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondError(c, 400, codeBadRequest, err.Error())
+		return
+	}
+
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit).
+		SetSkip(offset)
+
+	cursor, err := postCollection.Find(ctx, visibleFilter(), findOpts)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	posts := []Post{}
+	if err = cursor.All(ctx, &posts); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"posts":  posts,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func searchPosts(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		respondError(c, 400, codeBadRequest, "q is required")
+		return
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondError(c, 400, codeBadRequest, err.Error())
+		return
+	}
+
+	filter := visibleFilter()
+	filter["$text"] = bson.M{"$search": q}
+	if raw := c.Query("userID"); raw != "" {
+		userID, err := normalizeUserID(raw)
+		if err != nil {
+			respondError(c, 400, codeInvalidID, err.Error())
+			return
+		}
+		filter["user_id"] = userID
+	}
+
+	score := bson.M{"score": bson.M{"$meta": "textScore"}}
+	findOpts := options.Find().
+		SetProjection(score).
+		SetSort(score).
+		SetLimit(limit).
+		SetSkip(offset)
+
+	cursor, err := postCollection.Find(ctx, filter, findOpts)
+	if err != nil {
+		var serverErr mongo.ServerError
+		if errors.As(err, &serverErr) && serverErr.HasErrorCode(27) {
+			respondError(c, 503, codeUnavailable, "search index is not ready")
+			return
+		}
+		respondInternalError(c, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	posts := []Post{}
+	if err = cursor.All(ctx, &posts); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"query":  q,
+		"posts":  posts,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func getPostByID(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objID, ok := parseObjectID(c, "postID")
+	if !ok {
+		return
+	}
+
+	var post Post
+	err := postCollection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": nil}).Decode(&post)
+	if err == nil && !visibleTo(c, post) {
+		err = mongo.ErrNoDocuments
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondError(c, 404, codeNotFound, "post not found")
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	respondWithETag(c, post)
+}
+
+// getPostsByIDs fetches visible posts in one query and returns them in the
+// order requested. IDs that are malformed or match no visible post are listed
+// under missing.
+func getPostsByIDs(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	var body struct {
+		IDs []string `json:"ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if len(body.IDs) > maxPostIDs {
+		respondError(c, 400, codeBadRequest, fmt.Sprintf("ids must contain at most %d entries", maxPostIDs))
+		return
+	}
+
+	seen := make(map[string]bool, len(body.IDs))
+	var ids []string
+	var objIDs []primitive.ObjectID
+	for _, id := range body.IDs {
+		id = strings.TrimSpace(id)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		if objID, err := primitive.ObjectIDFromHex(id); err == nil {
+			objIDs = append(objIDs, objID)
+		}
+	}
+
+	found := make(map[string]Post, len(objIDs))
+	if len(objIDs) > 0 {
+		filter := visibleFilter()
+		filter["_id"] = bson.M{"$in": objIDs}
+		cursor, err := postCollection.Find(ctx, filter)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		defer cursor.Close(ctx)
+
+		var posts []Post
+		if err := cursor.All(ctx, &posts); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		for _, post := range posts {
+			found[post.ID.Hex()] = post
+		}
+	}
+
+	posts := make([]Post, 0, len(ids))
+	missing := []string{}
+	for _, id := range ids {
+		objID, err := primitive.ObjectIDFromHex(id)
+		post, ok := found[objID.Hex()]
+		if err != nil || !ok {
+			missing = append(missing, id)
+			continue
+		}
+		posts = append(posts, post)
+	}
+
+	c.JSON(200, gin.H{"posts": posts, "missing": missing})
+}
+
+// checkPostExists answers without loading the document. Soft-deleted posts
+// count as missing.
+func checkPostExists(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objID, ok := parseObjectID(c, "postID")
+	if !ok {
+		return
+	}
+
+	count, err := postCollection.CountDocuments(ctx, bson.M{"_id": objID, "deleted_at": nil}, options.Count().SetLimit(1))
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"id":     objID.Hex(),
+		"exists": count > 0,
+	})
+}
+
+func getPostBySlug(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	var post Post
+	err := postCollection.FindOne(ctx, bson.M{"slug": c.Param("slug"), "deleted_at": nil}).Decode(&post)
+	if err == nil && !visibleTo(c, post) {
+		err = mongo.ErrNoDocuments
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondError(c, 404, codeNotFound, "post not found")
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	respondWithETag(c, post)
+}
+
+func createPost(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	newPost, ok := bindNewPost(ctx, c)
+	if !ok {
+		return
+	}
+
+	key, err := idempotencyKey(c)
+	if err != nil {
+		respondError(c, 400, codeBadRequest, err.Error())
+		return
+	}
+	if key != "" {
+		postID, err := reserveIdempotencyKey(ctx, key, postFingerprint(newPost))
+		switch {
+		case errors.Is(err, errIdempotencyInFlight):
+			respondError(c, 409, codeConflict, err.Error())
+			return
+		case errors.Is(err, errIdempotencyMismatch):
+			respondError(c, 422, codeConflict, err.Error())
+			return
+		case err != nil:
+			respondInternalError(c, err)
+			return
+		case !postID.IsZero():
+			replayCreatedPost(ctx, c, postID)
+			return
+		}
+	}
+
+	// Only a key seen for the first time gets here, so a retry is answered by
+	// its stored response above rather than by the duplicate guard.
+	if duplicateWindow > 0 {
+		existing, found, err := findRecentDuplicate(ctx, newPost)
+		if err != nil {
+			if key != "" {
+				releaseIdempotencyKey(key)
+			}
+			respondInternalError(c, err)
+			return
+		}
+		if found {
+			if key != "" {
+				if err := completeIdempotencyKey(ctx, key, existing.ID); err != nil {
+					slog.ErrorContext(ctx, "cannot record idempotency key", "error", err)
+				}
+			}
+			c.Header("Location", postLocation(existing.ID))
+			c.JSON(200, existing)
+			return
+		}
+	}
+
+	if err := insertPost(ctx, &newPost); err != nil {
+		if key != "" {
+			releaseIdempotencyKey(key)
+		}
+		respondInternalError(c, err)
+		return
+	}
+	if key != "" {
+		if err := completeIdempotencyKey(ctx, key, newPost.ID); err != nil {
+			slog.ErrorContext(ctx, "cannot record idempotency key", "error", err)
+		}
+	}
+
+	c.Header("Location", postLocation(newPost.ID))
+	c.JSON(201, newPost)
+}
+
+// findRecentDuplicate looks for a live post by the same user with the same
+// title and content created within duplicateWindow, so a double submit
+// returns the first post instead of creating a second.
+func findRecentDuplicate(ctx context.Context, post Post) (Post, bool, error) {
+	filter := bson.M{
+		"user_id":    post.UserID,
+		"title":      post.Title,
+		"content":    post.Content,
+		"deleted_at": nil,
+		"created_at": bson.M{"$gte": post.CreatedAt.Add(-duplicateWindow)},
+	}
+	var existing Post
+	err := postCollection.FindOne(ctx, filter,
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})).Decode(&existing)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Post{}, false, nil
+	}
+	if err != nil {
+		return Post{}, false, err
+	}
+	return existing, true, nil
+}
+
+func postLocation(id primitive.ObjectID) string {
+	return "/posts/single/" + id.Hex()
+}
+
+// bindNewPost decodes and validates a create request and fills in the fields
+// the server owns. It writes the error response itself when it returns false.
+func bindNewPost(ctx context.Context, c *gin.Context) (Post, bool) {
+	var newPost Post
+	if err := c.ShouldBindJSON(&newPost); err != nil {
+		respondBindError(c, err)
+		return Post{}, false
+	}
+	fieldErrors := validatePost(&newPost)
+	userID, err := normalizeUserID(newPost.UserID)
+	if err != nil {
+		fieldErrors["user_id"] = err.Error()
+	}
+	tags, err := normalizeTags(newPost.Tags)
+	if err != nil {
+		fieldErrors["tags"] = err.Error()
+	}
+	if len(fieldErrors) > 0 {
+		respondFieldErrors(c, fieldErrors)
+		return Post{}, false
+	}
+	newPost.UserID = userID
+	newPost.Tags = tags
+	if !isSelfOrAdmin(c, newPost.UserID) {
+		respondError(c, 403, codeForbidden, "you can only create posts as yourself")
+		return Post{}, false
+	}
+
+	userName, exists, err := userService.lookupUserName(ctx, newPost.UserID)
+	if err != nil {
+		respondUserServiceError(c, err)
+		return Post{}, false
+	}
+	if !exists {
+		respondError(c, 404, codeNotFound, "user does not exist")
+		return Post{}, false
+	}
+	newPost.UserName = userName
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	newPost.CreatedAt = now
+	newPost.UpdatedAt = now
+	newPost.Likes = 0
+	newPost.Version = 1
+	newPost.DeletedAt = nil
+	newPost.ReportCount = 0
+	newPost.Hidden = false
+	newPost.DeletedReason = ""
+	schedulePost(&newPost, now)
+	setExpiry(&newPost, now)
+	return newPost, true
+}
+
+// validatePostPreview runs createPost's checks and returns the post it would
+// store, slug included, without writing anything. The slug is only a
+// preview: another post can take it before the real create.
+func validatePostPreview(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	post, ok := bindNewPost(ctx, c)
+	if !ok {
+		return
+	}
+
+	slugs, err := allocateSlugs(ctx, []string{post.Title})
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	post.Slug = slugs[0]
+
+	c.JSON(200, gin.H{"valid": true, "post": post})
+}
+
+// insertPost assigns a slug and inserts post, setting its ID. Another request
+// can claim the same slug between allocation and insert, so it picks a fresh
+// one and retries a few times on a duplicate key.
+func insertPost(ctx context.Context, post *Post) error {
+	for attempt := 1; ; attempt++ {
+		slugs, err := allocateSlugs(ctx, []string{post.Title})
+		if err != nil {
+			return err
+		}
+		post.Slug = slugs[0]
+
+		if outboxCollection != nil {
+			err = insertWithOutbox(ctx, post)
+		} else {
+			var result *mongo.InsertOneResult
+			result, err = postCollection.InsertOne(ctx, post)
+			if err == nil {
+				post.ID = result.InsertedID.(primitive.ObjectID)
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) || attempt == 3 {
+			return err
+		}
+	}
+}
+
+func replayCreatedPost(ctx context.Context, c *gin.Context, postID primitive.ObjectID) {
+	var post Post
+	err := postCollection.FindOne(ctx, bson.M{"_id": postID}).Decode(&post)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondError(c, 404, codeNotFound, "post created for this Idempotency-Key no longer exists")
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Header("Location", postLocation(post.ID))
+	c.JSON(201, post)
+}
+
+type bulkResult struct {
+	Index  int                `json:"index"`
+	Status string             `json:"status"`
+	ID     primitive.ObjectID `json:"id,omitzero"`
+	Errors map[string]string  `json:"errors,omitempty"`
+}
+
+func bulkCreatePosts(maxBatch int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), bulkRequestTimeout)
+		defer cancel()
+
+		var batch []Post
+		if err := json.NewDecoder(c.Request.Body).Decode(&batch); err != nil {
+			if respondBodyTooLarge(c, err) {
+				return
+			}
+			respondError(c, 400, codeBadRequest, "body must be a JSON array of posts")
+			return
+		}
+		if len(batch) == 0 {
+			respondError(c, 400, codeBadRequest, "batch must not be empty")
+			return
+		}
+		if len(batch) > maxBatch {
+			respondError(c, 400, codeBadRequest, fmt.Sprintf("batch must contain at most %d posts", maxBatch))
+			return
+		}
+
+		results := make([]bulkResult, len(batch))
+		var userIDs []string
+		seen := map[string]bool{}
+		for i := range batch {
+			post := &batch[i]
+			results[i] = bulkResult{Index: i, Status: "failed"}
+
+			fieldErrors := validatePost(post)
+			userID, err := normalizeUserID(post.UserID)
+			if err != nil {
+				fieldErrors["user_id"] = err.Error()
+			}
+			tags, err := normalizeTags(post.Tags)
+			if err != nil {
+				fieldErrors["tags"] = err.Error()
+			}
+			if len(fieldErrors) > 0 {
+				results[i].Errors = fieldErrors
+				continue
+			}
+			post.UserID = userID
+			post.Tags = tags
+			if !isSelfOrAdmin(c, userID) {
+				respondError(c, 403, codeForbidden, fmt.Sprintf("post %d: you can only create posts as yourself", i))
+				return
+			}
+			if !seen[userID] {
+				seen[userID] = true
+				userIDs = append(userIDs, userID)
+			}
+		}
+
+		var exists map[string]bool
+		if len(userIDs) > 0 {
+			var err error
+			exists, err = userService.checkUsersExist(ctx, userIDs)
+			if err != nil {
+				respondUserServiceError(c, err)
+				return
+			}
+		}
+
+		var accepted []int
+		var titles []string
+		for i := range batch {
+			if results[i].Errors != nil {
+				continue
+			}
+			if !exists[batch[i].UserID] {
+				results[i].Errors = map[string]string{"user_id": "user does not exist"}
+				continue
+			}
+			accepted = append(accepted, i)
+			titles = append(titles, batch[i].Title)
+		}
+
+		slugs, err := allocateSlugs(ctx, titles)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		names := authorNames(ctx, userIDs, exists)
+
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		var posts []*Post
+		var docIndexes []int
+		for n, i := range accepted {
+			post := &batch[i]
+			post.Slug = slugs[n]
+			post.UserName = names[post.UserID]
+			post.ID = primitive.NewObjectID()
+			post.CreatedAt = now
+			post.UpdatedAt = now
+			post.Likes = 0
+			post.Version = 1
+			post.DeletedAt = nil
+			post.ReportCount = 0
+			post.Hidden = false
+			post.DeletedReason = ""
+			schedulePost(post, now)
+			setExpiry(post, now)
+			posts = append(posts, post)
+			docIndexes = append(docIndexes, i)
+		}
+
+		if len(posts) > 0 {
+			var failed map[int]string
+			if outboxCollection != nil {
+				failed = insertEachWithOutbox(ctx, posts)
+			} else {
+				failed = map[int]string{}
+				docs := make([]any, len(posts))
+				for n, post := range posts {
+					docs[n] = post
+				}
+				_, err := postCollection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+				var bulkErr mongo.BulkWriteException
+				switch {
+				case errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0:
+					for _, we := range bulkErr.WriteErrors {
+						failed[we.Index] = we.Message
+					}
+				case err != nil:
+					respondInternalError(c, err)
+					return
+				}
+			}
+
+			for n, i := range docIndexes {
+				if msg, ok := failed[n]; ok {
+					results[i].Errors = map[string]string{"insert": msg}
+					continue
+				}
+				results[i].Status = "created"
+				results[i].ID = batch[i].ID
+			}
+		}
+
+		created := 0
+		for _, r := range results {
+			if r.Status == "created" {
+				created++
+			}
+		}
+
+		status := 201
+		if created < len(results) {
+			status = 207
+		}
+		c.JSON(status, gin.H{
+			"created": created,
+			"failed":  len(results) - created,
+			"results": results,
+		})
+	}
+}
+
+func setExpiry(post *Post, now time.Time) {
+	post.ExpiresAt = nil
+	if post.TTLSeconds > 0 {
+		expiresAt := now.Add(time.Duration(post.TTLSeconds) * time.Second)
+		post.ExpiresAt = &expiresAt
+	}
+}
+
+func updatePost(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objID, ok := parseObjectID(c, "postID")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Post
+		Version *int `json:"version"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	fieldErrors := validatePost(&input.Post)
+	if input.Version == nil {
+		fieldErrors["version"] = "version is required"
+	}
+	if len(fieldErrors) > 0 {
+		respondFieldErrors(c, fieldErrors)
+		return
+	}
+
+	existing, ok := loadOwnedPost(ctx, c, objID)
+	if !ok {
+		return
+	}
+	if input.UserID != "" && input.UserID != existing.UserID {
+		respondError(c, 400, codeBadRequest, "user_id cannot be changed")
+		return
+	}
+	if existing.Version != *input.Version {
+		respondVersionConflict(c, existing.Version)
+		return
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"title":      input.Title,
+			"content":    input.Content,
+			"updated_at": time.Now().UTC(),
+		},
+		"$inc": bson.M{"version": 1},
+	}
+	res, err := postCollection.UpdateOne(ctx, versionFilter(objID, existing.Version), update)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	if res.MatchedCount == 0 {
+		respondLostUpdate(ctx, c, objID)
+		return
+	}
+	recordHistory(ctx, c, "update", existing)
+
+	var updated Post
+	err = postCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondError(c, 404, codeNotFound, "post not found")
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, updated)
+}
+
+func patchPost(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objID, ok := parseObjectID(c, "postID")
+	if !ok {
+		return
+	}
+
+	var patch struct {
+		Title   *string   `json:"title"`
+		Content *string   `json:"content"`
+		Tags    *[]string `json:"tags"`
+		Version *int      `json:"version"`
+	}
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if patch.Version == nil {
+		respondFieldErrors(c, map[string]string{"version": "version is required"})
+		return
+	}
+	if patch.Title == nil && patch.Content == nil && patch.Tags == nil {
+		respondError(c, 400, codeBadRequest, "at least one of title, content or tags is required")
+		return
+	}
+
+	existing, ok := loadOwnedPost(ctx, c, objID)
+	if !ok {
+		return
+	}
+	if existing.Version != *patch.Version {
+		respondVersionConflict(c, existing.Version)
+		return
+	}
+
+	merged := existing
+	if patch.Title != nil {
+		merged.Title = *patch.Title
+	}
+	if patch.Content != nil {
+		merged.Content = *patch.Content
+	}
+	fieldErrors := validatePost(&merged)
+	if patch.Tags != nil {
+		tags, err := normalizeTags(*patch.Tags)
+		if err != nil {
+			fieldErrors["tags"] = err.Error()
+		}
+		merged.Tags = tags
+	}
+	if len(fieldErrors) > 0 {
+		respondFieldErrors(c, fieldErrors)
+		return
+	}
+
+	set := bson.M{"updated_at": time.Now().UTC()}
+	if patch.Title != nil {
+		set["title"] = merged.Title
+	}
+	if patch.Content != nil {
+		set["content"] = merged.Content
+	}
+	if patch.Tags != nil {
+		set["tags"] = merged.Tags
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	var updated Post
+	err := postCollection.FindOneAndUpdate(ctx, versionFilter(objID, existing.Version), update, opts).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondLostUpdate(ctx, c, objID)
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	recordHistory(ctx, c, "patch", existing)
+
+	c.JSON(200, updated)
+}
+
+// versionFilter matches a live post at exactly version. Posts written before
+// versioning have no version field and count as version 0.
+func versionFilter(id primitive.ObjectID, version int) bson.M {
+	filter := bson.M{"_id": id, "deleted_at": nil, "version": version}
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	return filter
+}
+
+func respondVersionConflict(c *gin.Context, current int) {
+	respondError(c, 409, codeConflict, fmt.Sprintf("post has been modified (current version %d); reload and retry", current))
+}
+
+// respondLostUpdate handles a versioned write that matched nothing: either the
+// post was deleted or someone else updated it first.
+func respondLostUpdate(ctx context.Context, c *gin.Context, id primitive.ObjectID) {
+	var current Post
+	err := postCollection.FindOne(ctx, bson.M{"_id": id, "deleted_at": nil},
+		options.FindOne().SetProjection(bson.M{"version": 1})).Decode(&current)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondError(c, 404, codeNotFound, "post not found")
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	respondVersionConflict(c, current.Version)
+}
+
+func deletePost(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objID, ok := parseObjectID(c, "postID")
+	if !ok {
+		return
+	}
+
+	hard, err := strconv.ParseBool(c.DefaultQuery("hard", "false"))
+	if err != nil {
+		respondError(c, 400, codeBadRequest, "hard must be true or false")
+		return
+	}
+	if hard {
+		hardDeletePost(ctx, c, objID)
+		return
+	}
+
+	existing, ok := loadOwnedPost(ctx, c, objID)
+	if !ok {
+		return
+	}
+
+	update := bson.M{"$set": bson.M{"deleted_at": time.Now().UTC()}}
+	res, err := postCollection.UpdateOne(ctx, bson.M{"_id": objID, "deleted_at": nil}, update)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	if res.MatchedCount == 0 {
+		respondError(c, 404, codeNotFound, "post not found")
+		return
+	}
+	recordHistory(ctx, c, "delete", existing)
+
+	c.JSON(200, gin.H{"message": "post deleted"})
+}
+
+// hardDeletePost removes a post for good, soft-deleted or not. The history
+// snapshot is then the only copy left, so the delete is refused if it cannot
+// be written.
+func hardDeletePost(ctx context.Context, c *gin.Context, objID primitive.ObjectID) {
+	if c.GetString(authRoleKey) != roleAdmin {
+		respondError(c, 403, codeForbidden, "hard delete requires the admin role")
+		return
+	}
+
+	var existing Post
+	err := postCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&existing)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondError(c, 404, codeNotFound, "post not found")
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	if err := insertHistory(ctx, c, "hard_delete", existing); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	res, err := postCollection.DeleteOne(ctx, bson.M{"_id": objID})
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if res.DeletedCount == 0 {
+		respondError(c, 404, codeNotFound, "post not found")
+		return
+	}
+	if _, err := reportsCollection.DeleteMany(ctx, bson.M{"post_id": objID}); err != nil {
+		slog.ErrorContext(ctx, "cannot delete reports of hard-deleted post", "error", err, "post_id", objID.Hex())
+	}
+
+	c.JSON(200, gin.H{"message": "post permanently deleted"})
+}
+
+func loadOwnedPost(ctx context.Context, c *gin.Context, objID primitive.ObjectID) (Post, bool) {
+	var post Post
+	err := postCollection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": nil}).Decode(&post)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondError(c, 404, codeNotFound, "post not found")
+		return Post{}, false
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return Post{}, false
+	}
+
+	if post.UserID != c.GetString(authSubjectKey) {
+		respondError(c, 403, codeForbidden, "you do not own this post")
+		return Post{}, false
+	}
+	return post, true
+}
+
+func restorePost(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objID, ok := parseObjectID(c, "postID")
+	if !ok {
+		return
+	}
+
+	filter := bson.M{"_id": objID, "deleted_at": bson.M{"$ne": nil}}
+	var post Post
+	err := postCollection.FindOne(ctx, filter).Decode(&post)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondError(c, 404, codeNotFound, "deleted post not found")
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if !isSelfOrAdmin(c, post.UserID) {
+		respondError(c, 403, codeForbidden, "you do not own this post")
+		return
+	}
+	if post.DeletedReason != "" && c.GetString(authRoleKey) != roleAdmin {
+		respondError(c, 403, codeForbidden, "only an admin can restore a post removed by moderation or orphan cleanup")
+		return
+	}
+
+	res, err := postCollection.UpdateOne(ctx, filter, bson.M{"$unset": bson.M{"deleted_at": "", "deleted_reason": ""}})
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	if res.MatchedCount == 0 {
+		respondError(c, 404, codeNotFound, "deleted post not found")
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "post restored"})
+}
+
+func likePost(c *gin.Context) {
+	adjustLikes(c, 1)
+}
+
+func unlikePost(c *gin.Context) {
+	adjustLikes(c, -1)
+}
+
+func adjustLikes(c *gin.Context, delta int) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objID, ok := parseObjectID(c, "postID")
+	if !ok {
+		return
+	}
+
+	filter := bson.M{"_id": objID, "deleted_at": nil}
+	if delta < 0 {
+		filter["likes"] = bson.M{"$gt": 0}
+	}
+
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"likes": 1})
+
+	var post Post
+	err := postCollection.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"likes": delta}}, opts).Decode(&post)
+	if errors.Is(err, mongo.ErrNoDocuments) && delta < 0 {
+		// Nothing to decrement: either the post is gone or it is already at zero.
+		err = postCollection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": nil},
+			options.FindOne().SetProjection(bson.M{"likes": 1})).Decode(&post)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondError(c, 404, codeNotFound, "post not found")
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"id": objID, "likes": post.Likes})
+}
+
+func deletePostsByUserID(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	userID, err := normalizeUserID(c.Param("userID"))
+	if err != nil {
+		respondError(c, 400, codeInvalidID, err.Error())
+		return
+	}
+	if !isSelfOrAdmin(c, userID) {
+		respondError(c, 403, codeForbidden, "only the user or an admin can delete these posts")
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+	if err != nil {
+		respondError(c, 400, codeBadRequest, "dryRun must be true or false")
+		return
+	}
+
+	filter := bson.M{"user_id": userID}
+	if dryRun {
+		count, err := postCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		c.JSON(200, gin.H{
+			"user_id":            userID,
+			"dry_run":            true,
+			"would_delete_count": count,
+		})
+		return
+	}
+
+	res, err := postCollection.DeleteMany(ctx, filter)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	// This may be the user service's cascade after deleting the user, or the
+	// user clearing their own posts; forget what is cached either way so the
+	// next check asks the user service and new posts cannot recreate orphans.
+	userService.cache.delete(userID)
+	userService.names.delete(userID)
+
+	c.JSON(200, gin.H{
+		"user_id":       userID,
+		"deleted_count": res.DeletedCount,
+	})
+}
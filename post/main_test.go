@@ -0,0 +1,1823 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRestorePostPermissions(t *testing.T) {
+	const owner = "64b000000000000000000001"
+	postID := primitive.NewObjectID()
+	deletedAt := time.Now().UTC()
+	path := "/posts/" + postID.Hex() + "/restore"
+
+	tests := []struct {
+		name   string
+		reason string
+		caller string
+		role   string
+		want   int
+	}{
+		{"owner restores own delete", "", owner, "", 200},
+		{"other user", "", "64b000000000000000000002", "", 403},
+		{"owner after moderation", deletedByModeration, owner, "", 403},
+		{"owner after orphan cleanup", deletedAsOrphan, owner, "", 403},
+		{"admin after moderation", deletedByModeration, "64b0000000000000000000ad", roleAdmin, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				r := newTestRouter(t, nil)
+				mt.AddMockResponses(
+					findResponse(t, Post{ID: postID, UserID: owner, DeletedAt: &deletedAt, DeletedReason: tt.reason}),
+					writeResponse(1),
+				)
+				w := serve(r, "POST", path, "", "Authorization", bearer(t, tt.caller, tt.role))
+				if w.Code != tt.want {
+					t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+				}
+			})
+		})
+	}
+}
+
+func TestCreatePostRequiresOwnUserID(t *testing.T) {
+	r := newTestRouter(t, nil)
+	const author = "64b000000000000000000001"
+	other := bearer(t, "64b000000000000000000002", "")
+	post := `{"user_id":"` + author + `","title":"Hello","content":"World"}`
+
+	w := serve(r, "POST", "/posts", post, "Authorization", other)
+	if w.Code != 403 {
+		t.Errorf("single: status = %d, want 403", w.Code)
+	}
+	w = serve(r, "POST", "/posts/bulk", "["+post+"]", "Authorization", other)
+	if w.Code != 403 {
+		t.Errorf("bulk: status = %d, want 403", w.Code)
+	}
+}
+
+func TestCreatePostLocation(t *testing.T) {
+	const author = "64b000000000000000000001"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"Alice"}`))
+	}))
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(findResponse(t), writeResponse(1))
+
+		body := `{"user_id":"` + author + `","title":"Hello","content":"World"}`
+		w := serve(r, "POST", "/posts", body, "Authorization", bearer(t, author, ""))
+		if w.Code != 201 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var created Post
+		if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+			t.Fatal(err)
+		}
+		location := w.Header().Get("Location")
+		if want := "/posts/single/" + created.ID.Hex(); location != want {
+			t.Fatalf("Location = %q, want %q", location, want)
+		}
+
+		// Following the header reaches the new post.
+		mt.AddMockResponses(findResponse(t, created))
+		if w := serve(r, "GET", location, ""); w.Code != 200 || !strings.Contains(w.Body.String(), created.ID.Hex()) {
+			t.Errorf("GET %s = %d %s, want the created post", location, w.Code, w.Body)
+		}
+	})
+}
+
+func TestDeletePostsByUserIDForgetsUser(t *testing.T) {
+	const userID = "64b000000000000000000001"
+	checks := 0
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checks++
+		w.Write([]byte(`{"exists":true}`))
+	}))
+	userService.cache.set(userID, true)
+	userService.names.set(userID, "Alice", time.Minute)
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(writeResponse(3))
+		w := serve(r, "DELETE", "/posts/by-user/"+userID, "", "Authorization", bearer(t, userID, ""))
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+
+		if _, ok := userService.cache.get(userID); ok {
+			t.Error("existence still cached")
+		}
+		if _, ok := userService.names.get(userID); ok {
+			t.Error("name still cached")
+		}
+
+		// The user still exists, so their listing keeps working and the
+		// answer comes from the user service rather than the old entry.
+		mt.AddMockResponses(countResponse(0), findResponse(t))
+		if w := serve(r, "GET", "/posts/"+userID, ""); w.Code != 200 {
+			t.Errorf("listing after clearing posts = %d, want 200: %s", w.Code, w.Body)
+		}
+		if checks != 1 {
+			t.Errorf("user service asked %d times, want 1", checks)
+		}
+	})
+}
+
+func TestGetPostsByIDsKeepsOrderAndReportsMissing(t *testing.T) {
+	first, second, gone := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		// Mongo returns matches in its own order.
+		mt.AddMockResponses(findResponse(t, Post{ID: first, Title: "first"}, Post{ID: second, Title: "second"}))
+
+		body := `{"ids":["` + second.Hex() + `","not-an-id","` + gone.Hex() + `","` + first.Hex() + `","` + second.Hex() + `"]}`
+		w := serve(r, "POST", "/posts/by-ids", body)
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+
+		var resp struct {
+			Posts   []Post   `json:"posts"`
+			Missing []string `json:"missing"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Posts) != 2 || resp.Posts[0].ID != second || resp.Posts[1].ID != first {
+			t.Errorf("posts = %+v, want second then first", resp.Posts)
+		}
+		if want := []string{"not-an-id", gone.Hex()}; !slices.Equal(resp.Missing, want) {
+			t.Errorf("missing = %v, want %v", resp.Missing, want)
+		}
+	})
+}
+
+func TestGetPostsByIDsCapsBatch(t *testing.T) {
+	r := newTestRouter(t, nil)
+	ids := make([]string, maxPostIDs+1)
+	for i := range ids {
+		ids[i] = `"` + primitive.NewObjectID().Hex() + `"`
+	}
+	w := serve(r, "POST", "/posts/by-ids", `{"ids":[`+strings.Join(ids, ",")+`]}`)
+	if w.Code != 400 {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestGetFeedClampsLimit(t *testing.T) {
+	const user = "64b000000000000000000001"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"results": map[string]bool{user: true}})
+	}))
+
+	for _, tc := range []struct {
+		limit int64
+		want  int64
+	}{
+		{0, defaultPageSize},
+		{-5, 1},
+		{7, 7},
+		{maxPageSize + 1, maxPageSize},
+	} {
+		t.Run(fmt.Sprint(tc.limit), func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				r := newTestRouter(t, nil)
+				mt.AddMockResponses(countResponse(0), findResponse(t))
+
+				body := fmt.Sprintf(`{"user_ids":[%q],"limit":%d}`, user, tc.limit)
+				w := serve(r, "POST", "/posts/feed", body)
+				if w.Code != 200 {
+					t.Fatalf("status = %d: %s", w.Code, w.Body)
+				}
+				var resp struct {
+					Limit int64 `json:"limit"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp.Limit != tc.want {
+					t.Errorf("limit = %d, want %d", resp.Limit, tc.want)
+				}
+			})
+		})
+	}
+}
+
+func TestSearchPosts(t *testing.T) {
+	t.Run("empty q", func(t *testing.T) {
+		r := newTestRouter(t, nil)
+		if w := serve(r, "GET", "/posts/search?q=+", ""); w.Code != 400 {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t))
+
+			w := serve(r, "GET", "/posts/search?q=nothing", "")
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Posts json.RawMessage `json:"posts"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if string(resp.Posts) != "[]" {
+				t.Errorf("posts = %s, want []", resp.Posts)
+			}
+		})
+	})
+
+	t.Run("index not ready", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+				Code: 27, Name: "IndexNotFound", Message: "text index required for $text query",
+			}))
+
+			w := serve(r, "GET", "/posts/search?q=go", "")
+			if w.Code != 503 {
+				t.Errorf("status = %d, want 503", w.Code)
+			}
+		})
+	})
+}
+
+func TestGetPostsByUserIDOrder(t *testing.T) {
+	const user = "64b000000000000000000001"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"exists":true}`))
+	}))
+
+	for _, tc := range []struct {
+		query string
+		want  int32
+	}{
+		{"", -1},
+		{"?order=desc", -1},
+		{"?order=asc", 1},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				r := newTestRouter(t, nil)
+				oldest := Post{ID: primitive.NewObjectID(), UserID: user, CreatedAt: time.Now().Add(-2 * time.Hour)}
+				middle := Post{ID: primitive.NewObjectID(), UserID: user, CreatedAt: time.Now().Add(-time.Hour)}
+				newest := Post{ID: primitive.NewObjectID(), UserID: user, CreatedAt: time.Now()}
+				page := []any{newest, middle, oldest}
+				if tc.want == 1 {
+					page = []any{oldest, middle, newest}
+				}
+				mt.AddMockResponses(countResponse(3), findResponse(t, page...))
+
+				w := serve(r, "GET", "/posts/"+user+tc.query, "")
+				if w.Code != 200 {
+					t.Fatalf("status = %d: %s", w.Code, w.Body)
+				}
+
+				sort := startedCommand(t, mt, "find").Lookup("sort").Document()
+				for _, key := range []string{"created_at", "_id"} {
+					if got := sort.Lookup(key).Int32(); got != tc.want {
+						t.Errorf("sort %s = %d, want %d", key, got, tc.want)
+					}
+				}
+
+				var resp struct {
+					Posts []Post `json:"posts"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				for i, p := range page {
+					if resp.Posts[i].ID != p.(Post).ID {
+						t.Errorf("posts[%d] = %s, want %s", i, resp.Posts[i].ID.Hex(), p.(Post).ID.Hex())
+					}
+				}
+			})
+		})
+	}
+
+	t.Run("unknown order", func(t *testing.T) {
+		r := newTestRouter(t, nil)
+		if w := serve(r, "GET", "/posts/"+user+"?order=sideways", ""); w.Code != 400 {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+	})
+}
+
+func TestCountPostsByUserID(t *testing.T) {
+	const user = "64b000000000000000000001"
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(countResponse(4))
+
+		w := serve(r, "GET", "/posts/count/"+user, "")
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var resp struct {
+			UserID string `json:"user_id"`
+			Count  int64  `json:"count"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.UserID != user || resp.Count != 4 {
+			t.Errorf("response = %+v, want %s with 4", resp, user)
+		}
+
+		// CountDocuments runs as an aggregate whose first stage is the filter.
+		match := startedCommand(t, mt, "aggregate").Lookup("pipeline", "0", "$match").Document()
+		if got := match.Lookup("user_id").StringValue(); got != user {
+			t.Errorf("filter user_id = %q, want %q", got, user)
+		}
+		if _, err := match.LookupErr("deleted_at"); err != nil {
+			t.Errorf("filter %s does not exclude deleted posts", match)
+		}
+	})
+
+	t.Run("bad id", func(t *testing.T) {
+		r := newTestRouter(t, nil)
+		if w := serve(r, "GET", "/posts/count/nope", ""); w.Code != 400 {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+	})
+}
+
+func TestDeletePostIsSoft(t *testing.T) {
+	const owner = "64b000000000000000000001"
+	postID := primitive.NewObjectID()
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(
+			findResponse(t, Post{ID: postID, UserID: owner}),
+			writeResponse(1),
+			writeResponse(1), // history
+		)
+
+		w := serve(r, "DELETE", "/posts/"+postID.Hex(), "", "Authorization", bearer(t, owner, ""))
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		for _, ev := range mt.GetAllStartedEvents() {
+			if ev.CommandName == "delete" {
+				t.Fatalf("sent a delete command: %s", ev.Command)
+			}
+		}
+		update := startedCommand(t, mt, "update").Lookup("updates", "0", "u", "$set").Document()
+		if _, err := update.LookupErr("deleted_at"); err != nil {
+			t.Errorf("update %s does not set deleted_at", update)
+		}
+	})
+}
+
+func TestHardDeletePost(t *testing.T) {
+	const owner = "64b000000000000000000001"
+	postID := primitive.NewObjectID()
+	path := "/posts/" + postID.Hex() + "?hard=true"
+	admin := bearer(t, "64b0000000000000000000ad", roleAdmin)
+	deletedAt := time.Now().UTC()
+	post := Post{ID: postID, UserID: owner, Title: "Old", DeletedAt: &deletedAt}
+
+	t.Run("admin", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t, post), writeResponse(1), writeResponse(1), writeResponse(0))
+
+			w := serve(r, "DELETE", path, "", "Authorization", admin)
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+
+			// A soft-deleted post can still be removed for good.
+			if _, err := startedCommand(t, mt, "find").Lookup("filter").Document().LookupErr("deleted_at"); err == nil {
+				t.Error("find filter skips soft-deleted posts")
+			}
+			var order []string
+			for _, ev := range mt.GetAllStartedEvents() {
+				order = append(order, ev.CommandName)
+			}
+			if want := []string{"find", "insert", "delete", "delete"}; !slices.Equal(order, want) {
+				t.Errorf("commands = %v, want %v", order, want)
+			}
+			if action := startedCommand(t, mt, "insert").Lookup("documents", "0", "action").StringValue(); action != "hard_delete" {
+				t.Errorf("history action = %q, want hard_delete", action)
+			}
+		})
+	})
+
+	t.Run("history write fails", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t, post), mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}))
+
+			if w := serve(r, "DELETE", path, "", "Authorization", admin); w.Code != 500 {
+				t.Errorf("status = %d, want 500", w.Code)
+			}
+			if n := len(commandsNamed(mt, "delete")); n != 0 {
+				t.Errorf("sent %d deletes without a history snapshot", n)
+			}
+		})
+	})
+
+	t.Run("owner without admin role", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+
+			if w := serve(r, "DELETE", path, "", "Authorization", bearer(t, owner, "")); w.Code != 403 {
+				t.Errorf("status = %d, want 403", w.Code)
+			}
+			if n := len(mt.GetAllStartedEvents()); n != 0 {
+				t.Errorf("sent %d commands for a refused hard delete", n)
+			}
+		})
+	})
+}
+
+func TestGetPostsByUserIDExcludesDeleted(t *testing.T) {
+	const user = "64b000000000000000000001"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"exists":true}`))
+	}))
+
+	for _, tc := range []struct {
+		query       string
+		wantDeleted bool
+	}{
+		{"", false},
+		{"?includeDeleted=true", true},
+	} {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(countResponse(0), findResponse(t))
+
+			if w := serve(r, "GET", "/posts/"+user+tc.query, ""); w.Code != 200 {
+				t.Fatalf("%q: status = %d: %s", tc.query, w.Code, w.Body)
+			}
+			filter := startedCommand(t, mt, "find").Lookup("filter").Document()
+			_, err := filter.LookupErr("deleted_at")
+			if filtered := err == nil; filtered == tc.wantDeleted {
+				t.Errorf("%q: filter %s, want deleted posts included=%t", tc.query, filter, tc.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestGetPostsByUserIDFiltersByTag(t *testing.T) {
+	const user = "64b000000000000000000001"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"exists":true}`))
+	}))
+	tagged := Post{ID: primitive.NewObjectID(), UserID: user, Title: "Compose", Tags: []string{"docker", "go"}}
+
+	for _, tc := range []struct {
+		name, query, want string
+		posts             []any
+	}{
+		{"match", "?tag=docker", "docker", []any{tagged}},
+		{"normalized", "?tag=%20Docker%20", "docker", []any{tagged}},
+		{"no match", "?tag=rust", "rust", nil},
+		{"no filter", "", "", []any{tagged}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				r := newTestRouter(t, nil)
+				mt.AddMockResponses(countResponse(len(tc.posts)), findResponse(t, tc.posts...))
+
+				w := serve(r, "GET", "/posts/"+user+tc.query, "")
+				if w.Code != 200 {
+					t.Fatalf("status = %d: %s", w.Code, w.Body)
+				}
+				tag, err := startedCommand(t, mt, "find").Lookup("filter").Document().LookupErr("tags")
+				switch {
+				case tc.want == "" && err == nil:
+					t.Errorf("filter on tags %s without ?tag=", tag)
+				case tc.want != "" && tag.StringValue() != tc.want:
+					t.Errorf("filter tags = %s, want %q", tag, tc.want)
+				}
+
+				var body struct {
+					Posts []Post `json:"posts"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if len(body.Posts) != len(tc.posts) {
+					t.Errorf("got %d posts, want %d", len(body.Posts), len(tc.posts))
+				}
+			})
+		})
+	}
+}
+
+func TestRestorePostClearsDeletedAt(t *testing.T) {
+	const owner = "64b000000000000000000001"
+	postID := primitive.NewObjectID()
+	deletedAt := time.Now().UTC()
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(
+			findResponse(t, Post{ID: postID, UserID: owner, DeletedAt: &deletedAt}),
+			writeResponse(1),
+		)
+
+		w := serve(r, "POST", "/posts/"+postID.Hex()+"/restore", "", "Authorization", bearer(t, owner, ""))
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		unset := startedCommand(t, mt, "update").Lookup("updates", "0", "u", "$unset").Document()
+		if _, err := unset.LookupErr("deleted_at"); err != nil {
+			t.Errorf("update %s does not clear deleted_at", unset)
+		}
+	})
+
+	t.Run("not deleted", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t))
+
+			w := serve(r, "POST", "/posts/"+postID.Hex()+"/restore", "", "Authorization", bearer(t, owner, ""))
+			if w.Code != 404 {
+				t.Errorf("status = %d, want 404", w.Code)
+			}
+		})
+	})
+}
+
+func TestPostOwnership(t *testing.T) {
+	const owner = "64b000000000000000000001"
+	postID := primitive.NewObjectID()
+	path := "/posts/" + postID.Hex()
+	update := `{"title":"New","content":"Body","version":1}`
+	post := Post{ID: postID, UserID: owner, Title: "Old", Content: "Body", Version: 1}
+
+	// Replies after the ownership lookup when the owner's change goes through.
+	for _, route := range []struct {
+		method, body string
+		replies      func(t *testing.T) []bson.D
+	}{
+		{"DELETE", "", func(t *testing.T) []bson.D {
+			return []bson.D{writeResponse(1), writeResponse(1)}
+		}},
+		{"PUT", update, func(t *testing.T) []bson.D {
+			return []bson.D{writeResponse(1), writeResponse(1), findResponse(t, post)}
+		}},
+		{"PATCH", update, func(t *testing.T) []bson.D {
+			return []bson.D{findAndModifyResponse(t, post), writeResponse(1)}
+		}},
+	} {
+		t.Run(route.method, func(t *testing.T) {
+			tests := []struct {
+				name   string
+				caller string
+				found  bool
+				want   int
+			}{
+				{"owner", owner, true, 200},
+				{"non-owner", "64b000000000000000000002", true, 403},
+				{"missing", owner, false, 404},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+						r := newTestRouter(t, nil)
+						if !tt.found {
+							mt.AddMockResponses(findResponse(t))
+						} else {
+							mt.AddMockResponses(findResponse(t, post))
+							mt.AddMockResponses(route.replies(t)...)
+						}
+
+						w := serve(r, route.method, path, route.body, "Authorization", bearer(t, tt.caller, ""))
+						if w.Code != tt.want {
+							t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+						}
+					})
+				})
+			}
+		})
+	}
+}
+
+func TestUpdatePostVersionConflict(t *testing.T) {
+	const owner = "64b000000000000000000001"
+	postID := primitive.NewObjectID()
+	path := "/posts/" + postID.Hex()
+	token := bearer(t, owner, "")
+	read := Post{ID: postID, UserID: owner, Title: "Old", Content: "Body", Version: 1}
+	written := Post{ID: postID, UserID: owner, Title: "First", Content: "Body", Version: 2}
+
+	t.Run("second of two concurrent updates", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			// Both writers read version 1; the first update lands and the
+			// second one's filter no longer matches.
+			mt.AddMockResponses(findResponse(t, read), writeResponse(1), writeResponse(1), findResponse(t, written))
+			mt.AddMockResponses(findResponse(t, read), writeResponse(0), findResponse(t, written))
+
+			first := serve(r, "PUT", path, `{"title":"First","content":"Body","version":1}`, "Authorization", token)
+			if first.Code != 200 {
+				t.Fatalf("first status = %d: %s", first.Code, first.Body)
+			}
+			second := serve(r, "PUT", path, `{"title":"Second","content":"Body","version":1}`, "Authorization", token)
+			if second.Code != 409 {
+				t.Fatalf("second status = %d, want 409: %s", second.Code, second.Body)
+			}
+			if code := errorCode(t, second); code != codeConflict {
+				t.Errorf("code = %q, want %q", code, codeConflict)
+			}
+
+			update := startedCommand(t, mt, "update").Lookup("updates", "0")
+			if v := update.Document().Lookup("q", "version").Int32(); v != 1 {
+				t.Errorf("filter version = %d, want 1", v)
+			}
+			if inc := update.Document().Lookup("u", "$inc", "version").Int32(); inc != 1 {
+				t.Errorf("$inc version = %d, want 1", inc)
+			}
+		})
+	})
+
+	t.Run("stale version", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t, written))
+
+			w := serve(r, "PUT", path, `{"title":"Second","content":"Body","version":1}`, "Authorization", token)
+			if w.Code != 409 {
+				t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+			}
+			if n := len(commandsNamed(mt, "update")); n != 0 {
+				t.Errorf("sent %d updates for a stale version", n)
+			}
+		})
+	})
+
+	t.Run("missing version", func(t *testing.T) {
+		r := newTestRouter(t, nil)
+		w := serve(r, "PUT", path, `{"title":"New","content":"Body"}`, "Authorization", token)
+		if w.Code != 400 {
+			t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+		}
+	})
+}
+
+func TestLikes(t *testing.T) {
+	postID := primitive.NewObjectID()
+	base := "/posts/" + postID.Hex()
+	token := bearer(t, "64b000000000000000000002", "")
+
+	likes := func(t *testing.T, w *httptest.ResponseRecorder) int {
+		t.Helper()
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var resp struct {
+			Likes int `json:"likes"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Likes
+	}
+
+	t.Run("like", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findAndModifyResponse(t, Post{ID: postID, Likes: 4}))
+
+			if got := likes(t, serve(r, "POST", base+"/like", "", "Authorization", token)); got != 4 {
+				t.Errorf("likes = %d, want 4", got)
+			}
+			inc := startedCommand(t, mt, "findAndModify").Lookup("update", "$inc", "likes").Int32()
+			if inc != 1 {
+				t.Errorf("$inc likes = %d, want 1", inc)
+			}
+		})
+	})
+
+	t.Run("unlike", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findAndModifyResponse(t, Post{ID: postID, Likes: 2}))
+
+			if got := likes(t, serve(r, "POST", base+"/unlike", "", "Authorization", token)); got != 2 {
+				t.Errorf("likes = %d, want 2", got)
+			}
+			cmd := startedCommand(t, mt, "findAndModify")
+			if inc := cmd.Lookup("update", "$inc", "likes").Int32(); inc != -1 {
+				t.Errorf("$inc likes = %d, want -1", inc)
+			}
+			if _, err := cmd.LookupErr("query", "likes", "$gt"); err != nil {
+				t.Errorf("query %s does not guard against going below zero", cmd.Lookup("query"))
+			}
+		})
+	})
+
+	t.Run("unlike at zero", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findAndModifyResponse(t, nil), findResponse(t, Post{ID: postID, Likes: 0}))
+
+			if got := likes(t, serve(r, "POST", base+"/unlike", "", "Authorization", token)); got != 0 {
+				t.Errorf("likes = %d, want 0", got)
+			}
+		})
+	})
+
+	for _, action := range []string{"like", "unlike"} {
+		t.Run(action+" missing post", func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				r := newTestRouter(t, nil)
+				mt.AddMockResponses(findAndModifyResponse(t, nil), findResponse(t))
+
+				if w := serve(r, "POST", base+"/"+action, "", "Authorization", token); w.Code != 404 {
+					t.Errorf("status = %d, want 404", w.Code)
+				}
+			})
+		})
+	}
+}
+
+func TestCreatePostDuplicateGuard(t *testing.T) {
+	const author = "64b000000000000000000001"
+	const window = 10 * time.Second
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"Alice"}`))
+	}))
+	token := bearer(t, author, "")
+	body := `{"user_id":"` + author + `","title":"Hello","content":"World"}`
+
+	create := func(t *testing.T, edit func(*Config)) *httptest.ResponseRecorder {
+		t.Helper()
+		return serve(newTestRouter(t, edit), "POST", "/posts", body, "Authorization", token)
+	}
+	withWindow := func(cfg *Config) { cfg.DuplicateWindow = window }
+
+	t.Run("resubmit inside the window", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			first := Post{ID: primitive.NewObjectID(), UserID: author, Title: "Hello", Content: "World", CreatedAt: time.Now().Add(-2 * time.Second)}
+			mt.AddMockResponses(findResponse(t, first))
+
+			w := create(t, withWindow)
+			if w.Code != 200 {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+			var got Post
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != first.ID || w.Header().Get("Location") != postLocation(first.ID) {
+				t.Errorf("returned %s at %q, want the first post", got.ID.Hex(), w.Header().Get("Location"))
+			}
+			if n := len(commandsNamed(mt, "insert")); n != 0 {
+				t.Errorf("sent %d inserts for a duplicate", n)
+			}
+
+			filter := startedCommand(t, mt, "find").Lookup("filter").Document()
+			for key, want := range map[string]string{"user_id": author, "title": "Hello", "content": "World"} {
+				if got := filter.Lookup(key).StringValue(); got != want {
+					t.Errorf("filter %s = %q, want %q", key, got, want)
+				}
+			}
+			since := filter.Lookup("created_at", "$gte").Time()
+			if d := time.Until(since) + window; d < -time.Second || d > time.Second {
+				t.Errorf("filter created_at >= %v, want about %v ago", since, window)
+			}
+			if !since.Before(first.CreatedAt) {
+				t.Errorf("window starting %v excludes a post from %v", since, first.CreatedAt)
+			}
+		})
+	})
+
+	t.Run("resubmit outside the window", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			// Mongo finds nothing: the earlier post is older than the window.
+			mt.AddMockResponses(findResponse(t), findResponse(t), writeResponse(1))
+
+			if w := create(t, withWindow); w.Code != 201 {
+				t.Fatalf("status = %d, want 201: %s", w.Code, w.Body)
+			}
+			earlier := time.Now().Add(-3 * window)
+			if since := commandsNamed(mt, "find")[0].Lookup("filter", "created_at", "$gte").Time(); !since.After(earlier) {
+				t.Errorf("window starting %v still covers a post from %v", since, earlier)
+			}
+			if n := len(commandsNamed(mt, "insert")); n != 1 {
+				t.Errorf("sent %d inserts, want 1", n)
+			}
+		})
+	})
+
+	t.Run("retry with a used idempotency key", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			original := Post{ID: primitive.NewObjectID(), UserID: author, Title: "Hello", Content: "World"}
+			fingerprint := postFingerprint(Post{UserID: author, Title: "Hello", Content: "World"})
+			mt.AddMockResponses(
+				mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "duplicate key"}),
+				findResponse(t, bson.M{"_id": author + ":retry-1", "fingerprint": fingerprint, "post_id": original.ID}),
+				findResponse(t, original),
+			)
+
+			w := serve(newTestRouter(t, withWindow), "POST", "/posts", body, "Authorization", token, idempotencyKeyHeader, "retry-1")
+			if w.Code != 201 || w.Header().Get("Idempotent-Replayed") != "true" {
+				t.Fatalf("status = %d, replayed %q; want the stored 201: %s", w.Code, w.Header().Get("Idempotent-Replayed"), w.Body)
+			}
+			for _, find := range commandsNamed(mt, "find") {
+				if _, err := find.Lookup("filter").Document().LookupErr("content"); err == nil {
+					t.Error("ran the duplicate guard for a replayed key")
+				}
+			}
+		})
+	})
+
+	t.Run("new idempotency key matching a recent post", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			first := Post{ID: primitive.NewObjectID(), UserID: author, Title: "Hello", Content: "World", CreatedAt: time.Now()}
+			mt.AddMockResponses(writeResponse(1), findResponse(t, first), writeResponse(1))
+
+			w := serve(newTestRouter(t, withWindow), "POST", "/posts", body, "Authorization", token, idempotencyKeyHeader, "retry-2")
+			if w.Code != 200 {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+			if got := commandsNamed(mt, "insert")[0].Lookup("documents", "0", "_id").StringValue(); got != author+":retry-2" {
+				t.Errorf("reserved %q, want the key", got)
+			}
+			set := startedCommand(t, mt, "update").Lookup("updates", "0", "u", "$set", "post_id").ObjectID()
+			if set != first.ID {
+				t.Errorf("key recorded against %s, want the existing post %s", set.Hex(), first.ID.Hex())
+			}
+			if n := len(commandsNamed(mt, "insert")); n != 1 {
+				t.Errorf("sent %d inserts, want only the key reservation", n)
+			}
+		})
+	})
+
+	t.Run("guard disabled", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			mt.AddMockResponses(findResponse(t), writeResponse(1))
+
+			if w := create(t, nil); w.Code != 201 {
+				t.Fatalf("status = %d, want 201: %s", w.Code, w.Body)
+			}
+			if _, err := startedCommand(t, mt, "find").Lookup("filter").Document().LookupErr("content"); err == nil {
+				t.Error("looked for a duplicate with the guard off")
+			}
+		})
+	})
+}
+
+func TestBulkCreatePosts(t *testing.T) {
+	const alice, ghost = "64b000000000000000000001", "64b000000000000000000002"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/exists":
+			json.NewEncoder(w).Encode(map[string]any{"results": map[string]bool{alice: true, ghost: false}})
+		case "/users/names":
+			json.NewEncoder(w).Encode(map[string]any{"names": map[string]string{alice: "Alice"}})
+		default:
+			t.Errorf("unexpected call %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	admin := bearer(t, "64b0000000000000000000ad", roleAdmin)
+
+	type result struct {
+		Status string            `json:"status"`
+		Errors map[string]string `json:"errors"`
+	}
+	var resp struct {
+		Created int      `json:"created"`
+		Failed  int      `json:"failed"`
+		Results []result `json:"results"`
+	}
+
+	t.Run("all valid", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			// One slug lookup per distinct title, then the insert.
+			mt.AddMockResponses(findResponse(t), findResponse(t), writeResponse(2))
+
+			body := `[{"user_id":"` + alice + `","title":"First","content":"a"},
+				{"user_id":"` + alice + `","title":"Second","content":"b"}]`
+			w := serve(r, "POST", "/posts/bulk", body, "Authorization", admin)
+			if w.Code != 201 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Created != 2 || resp.Failed != 0 {
+				t.Errorf("created/failed = %d/%d, want 2/0", resp.Created, resp.Failed)
+			}
+			inserted, err := startedCommand(t, mt, "insert").Lookup("documents").Array().Values()
+			if err != nil || len(inserted) != 2 {
+				t.Errorf("inserted %d documents (%v), want 2 in one insert", len(inserted), err)
+			}
+		})
+	})
+
+	t.Run("mixed", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t), writeResponse(1))
+
+			body := `[{"user_id":"` + alice + `","title":"Fine","content":"a"},
+				{"user_id":"` + alice + `","content":"no title"},
+				{"user_id":"` + ghost + `","title":"Nobody","content":"c"}]`
+			w := serve(r, "POST", "/posts/bulk", body, "Authorization", admin)
+			if w.Code != 207 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			resp.Results = nil
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Created != 1 || resp.Failed != 2 {
+				t.Errorf("created/failed = %d/%d, want 1/2", resp.Created, resp.Failed)
+			}
+			want := []string{"created", "failed", "failed"}
+			for i, res := range resp.Results {
+				if res.Status != want[i] {
+					t.Errorf("results[%d] = %+v, want %s", i, res, want[i])
+				}
+			}
+			if resp.Results[1].Errors["title"] == "" || resp.Results[2].Errors["user_id"] == "" {
+				t.Errorf("results = %+v, want title and user_id errors", resp.Results)
+			}
+		})
+	})
+
+	t.Run("over the cap", func(t *testing.T) {
+		r := newTestRouter(t, func(cfg *Config) { cfg.BulkMaxPosts = 1 })
+		body := `[{"user_id":"` + alice + `","title":"a","content":"a"},{"user_id":"` + alice + `","title":"b","content":"b"}]`
+		if w := serve(r, "POST", "/posts/bulk", body, "Authorization", admin); w.Code != 400 {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+	})
+}
+
+func TestDeletePostsByUserID(t *testing.T) {
+	const user = "64b000000000000000000001"
+	path := "/posts/by-user/" + user
+	fakeUserService(t, http.NotFoundHandler())
+
+	t.Run("removes every post", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(writeResponse(3))
+
+			w := serve(r, "DELETE", path, "", "Authorization", bearer(t, user, ""))
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var resp struct {
+				DeletedCount int64 `json:"deleted_count"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.DeletedCount != 3 {
+				t.Errorf("deleted_count = %d, want 3", resp.DeletedCount)
+			}
+			q := startedCommand(t, mt, "delete").Lookup("deletes", "0", "q").Document()
+			if got := q.Lookup("user_id").StringValue(); got != user {
+				t.Errorf("delete filter user_id = %q, want %q", got, user)
+			}
+			if _, err := q.LookupErr("deleted_at"); err == nil {
+				t.Errorf("delete filter %s skips soft-deleted posts", q)
+			}
+		})
+	})
+
+	t.Run("dry run counts only", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(countResponse(3))
+
+			w := serve(r, "DELETE", path+"?dryRun=true", "", "Authorization", bearer(t, user, ""))
+			if w.Code != 200 || !strings.Contains(w.Body.String(), `"would_delete_count":3`) {
+				t.Errorf("status = %d, body %s; want would_delete_count 3", w.Code, w.Body)
+			}
+			if n := len(commandsNamed(mt, "delete")); n != 0 {
+				t.Errorf("dry run sent %d deletes", n)
+			}
+			// CountDocuments wraps the filter in a $match stage.
+			match := startedCommand(t, mt, "aggregate").Lookup("pipeline", "0", "$match").Document()
+			if got := match.Lookup("user_id").StringValue(); got != user {
+				t.Errorf("count filter user_id = %q, want %q", got, user)
+			}
+		})
+	})
+
+	for _, tc := range []struct {
+		name, subject, role string
+		want                int
+	}{
+		{"admin", "64b0000000000000000000ad", roleAdmin, 200},
+		{"other user", "64b000000000000000000002", "", 403},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				r := newTestRouter(t, nil)
+				mt.AddMockResponses(writeResponse(0))
+
+				if w := serve(r, "DELETE", path, "", "Authorization", bearer(t, tc.subject, tc.role)); w.Code != tc.want {
+					t.Errorf("status = %d, want %d", w.Code, tc.want)
+				}
+			})
+		})
+	}
+
+	t.Run("no token", func(t *testing.T) {
+		r := newTestRouter(t, nil)
+		if w := serve(r, "DELETE", path, ""); w.Code != 401 {
+			t.Errorf("status = %d, want 401", w.Code)
+		}
+	})
+}
+
+func TestGetPostsByUserIDCursorPages(t *testing.T) {
+	const user = "64b000000000000000000001"
+	const limit = 2
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"exists":true}`))
+	}))
+
+	// Five posts, newest first, the order the handler asks Mongo for.
+	var all []Post
+	for i := range 5 {
+		all = append(all, Post{ID: primitive.NewObjectIDFromTimestamp(time.Unix(int64(1000-i), 0)), UserID: user})
+	}
+	// page is what Mongo returns for _id < after, newest first, with the
+	// extra post the handler fetches to detect another page.
+	page := func(after primitive.ObjectID) []any {
+		var out []any
+		for _, p := range all {
+			if (after.IsZero() || p.ID.Hex() < after.Hex()) && len(out) < limit+1 {
+				out = append(out, p)
+			}
+		}
+		return out
+	}
+
+	var seen []primitive.ObjectID
+	var after primitive.ObjectID
+	for pages := 0; ; pages++ {
+		if pages > len(all) {
+			t.Fatal("pagination did not terminate")
+		}
+		var next string
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(countResponse(len(all)), findResponse(t, page(after)...))
+
+			path := fmt.Sprintf("/posts/%s?limit=%d", user, limit)
+			if !after.IsZero() {
+				path += "&after=" + after.Hex()
+			}
+			w := serve(r, "GET", path, "")
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Posts      []Post `json:"posts"`
+				NextCursor string `json:"next_cursor"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Posts) > limit {
+				t.Fatalf("got %d posts, want at most %d", len(resp.Posts), limit)
+			}
+			for _, p := range resp.Posts {
+				seen = append(seen, p.ID)
+			}
+			next = resp.NextCursor
+
+			if !after.IsZero() {
+				lt := startedCommand(t, mt, "find").Lookup("filter", "_id", "$lt").ObjectID()
+				if lt != after {
+					t.Errorf("filter _id $lt = %s, want %s", lt.Hex(), after.Hex())
+				}
+			}
+		})
+		if next == "" {
+			break
+		}
+		var err error
+		if after, err = primitive.ObjectIDFromHex(next); err != nil {
+			t.Fatalf("next_cursor %q: %v", next, err)
+		}
+	}
+
+	if len(seen) != len(all) {
+		t.Fatalf("walked %d posts, want %d", len(seen), len(all))
+	}
+	for i, p := range all {
+		if seen[i] != p.ID {
+			t.Errorf("post %d = %s, want %s (duplicate or skip)", i, seen[i].Hex(), p.ID.Hex())
+		}
+	}
+}
+
+func TestPatchPostSetsOnlyPresentFields(t *testing.T) {
+	const owner = "64b000000000000000000001"
+	postID := primitive.NewObjectID()
+	existing := Post{ID: postID, UserID: owner, Title: "Old title", Content: "Old content", Version: 3}
+
+	for _, tc := range []struct {
+		name, body   string
+		set, omitted string
+	}{
+		{"title only", `{"title":"New title","version":3}`, "title", "content"},
+		{"content only", `{"content":"New content","version":3}`, "content", "title"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				r := newTestRouter(t, nil)
+				mt.AddMockResponses(findResponse(t, existing), findAndModifyResponse(t, existing), writeResponse(1))
+
+				w := serve(r, "PATCH", "/posts/"+postID.Hex(), tc.body, "Authorization", bearer(t, owner, ""))
+				if w.Code != 200 {
+					t.Fatalf("status = %d: %s", w.Code, w.Body)
+				}
+				set := startedCommand(t, mt, "findAndModify").Lookup("update", "$set").Document()
+				if _, err := set.LookupErr(tc.set); err != nil {
+					t.Errorf("$set %s does not update %s", set, tc.set)
+				}
+				if _, err := set.LookupErr(tc.omitted); err == nil {
+					t.Errorf("$set %s touches %s, which was not sent", set, tc.omitted)
+				}
+			})
+		})
+	}
+
+	t.Run("no fields", func(t *testing.T) {
+		r := newTestRouter(t, nil)
+		w := serve(r, "PATCH", "/posts/"+postID.Hex(), `{"version":3}`, "Authorization", bearer(t, owner, ""))
+		if w.Code != 400 {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("empty title is a value, not absent", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t, existing))
+
+			w := serve(r, "PATCH", "/posts/"+postID.Hex(), `{"title":"","version":3}`, "Authorization", bearer(t, owner, ""))
+			if w.Code != 400 || errorCode(t, w) != codeValidation {
+				t.Errorf("status = %d, body %s; want a title validation error", w.Code, w.Body)
+			}
+		})
+	})
+}
+
+func TestCreatePostTTLSeconds(t *testing.T) {
+	const author = "64b000000000000000000001"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"Alice"}`))
+	}))
+	token := bearer(t, author, "")
+	body := func(ttl string) string {
+		return `{"user_id":"` + author + `","title":"Hello","content":"World"` + ttl + `}`
+	}
+
+	t.Run("sets expires_at", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t), writeResponse(1))
+
+			if w := serve(r, "POST", "/posts", body(`,"ttl_seconds":3600`), "Authorization", token); w.Code != 201 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			doc := startedCommand(t, mt, "insert").Lookup("documents", "0").Document()
+			created, expires := doc.Lookup("created_at").Time(), doc.Lookup("expires_at").Time()
+			if d := expires.Sub(created); d != time.Hour {
+				t.Errorf("expires_at - created_at = %v, want 1h", d)
+			}
+			if _, err := doc.LookupErr("ttl_seconds"); err == nil {
+				t.Error("ttl_seconds stored on the post")
+			}
+		})
+	})
+
+	t.Run("no ttl never expires", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t), writeResponse(1))
+
+			if w := serve(r, "POST", "/posts", body(""), "Authorization", token); w.Code != 201 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if v, err := startedCommand(t, mt, "insert").LookupErr("documents", "0", "expires_at"); err == nil {
+				t.Errorf("expires_at = %s, want unset", v)
+			}
+		})
+	})
+
+	r := newTestRouter(t, nil)
+	for _, ttl := range []string{"-1", strconv.Itoa(maxTTLSeconds + 1)} {
+		w := serve(r, "POST", "/posts", body(`,"ttl_seconds":`+ttl), "Authorization", token)
+		if w.Code != 400 || errorCode(t, w) != codeValidation || !strings.Contains(w.Body.String(), `"ttl_seconds"`) {
+			t.Errorf("ttl_seconds %s: status = %d, body %s; want 400 naming ttl_seconds", ttl, w.Code, w.Body)
+		}
+	}
+}
+
+func TestEnsureIndexesCreatesTTLIndex(t *testing.T) {
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		for range 20 {
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+		}
+		if err := ensureIndexes(testConfig(t)); err != nil {
+			t.Fatalf("ensureIndexes: %v", err)
+		}
+
+		var ttl bson.Raw
+		for _, cmd := range commandsNamed(mt, "createIndexes") {
+			index := cmd.Lookup("indexes", "0").Document()
+			if index.Lookup("name").StringValue() == "posts_expires_at" {
+				ttl = index
+			}
+		}
+		if ttl == nil {
+			t.Fatal("no posts_expires_at index created")
+		}
+		if key := ttl.Lookup("key").Document().String(); key != `{"expires_at": {"$numberInt":"1"}}` {
+			t.Errorf("key = %s, want expires_at ascending", key)
+		}
+		if after, ok := ttl.Lookup("expireAfterSeconds").AsInt64OK(); !ok || after != 0 {
+			t.Errorf("expireAfterSeconds = %s, want 0", ttl.Lookup("expireAfterSeconds"))
+		}
+	})
+}
+
+func TestStrictUserCheck(t *testing.T) {
+	const author = "64b000000000000000000001"
+	// serviceDown points the client at a user service that has gone away,
+	// optionally tripping the breaker after the first failure.
+	serviceDown := func(t *testing.T, breakerThreshold int) {
+		t.Helper()
+		srv := fakeUserServiceWith(t, http.NotFoundHandler(), func(cfg *Config) {
+			cfg.UserServiceRetries = 1
+			cfg.BreakerThreshold = breakerThreshold
+		})
+		srv.Close()
+	}
+	lenient := func(cfg *Config) { cfg.StrictUserCheck = false }
+
+	t.Run("strict refuses reads", func(t *testing.T) {
+		for _, tc := range []struct {
+			name             string
+			breakerThreshold int
+			want             int
+		}{
+			{"connection refused", 5, 502},
+			{"breaker open", 1, 503},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				serviceDown(t, tc.breakerThreshold)
+				r := newTestRouter(t, nil)
+				if tc.breakerThreshold == 1 {
+					serve(r, "GET", "/posts/"+author, "")
+				}
+				if w := serve(r, "GET", "/posts/"+author, ""); w.Code != tc.want {
+					t.Errorf("status = %d, want %d: %s", w.Code, tc.want, w.Body)
+				}
+			})
+		}
+	})
+
+	t.Run("lenient serves stored posts", func(t *testing.T) {
+		serviceDown(t, 5)
+		var logs bytes.Buffer
+		previous := slog.Default()
+		slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+		t.Cleanup(func() { slog.SetDefault(previous) })
+
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			mt.AddMockResponses(countResponse(1), findResponse(t, Post{ID: primitive.NewObjectID(), UserID: author, Title: "Kept"}))
+
+			w := serve(newTestRouter(t, lenient), "GET", "/posts/"+author, "")
+			if w.Code != 200 {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+			var body struct {
+				Posts []Post `json:"posts"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Posts) != 1 || body.Posts[0].Title != "Kept" {
+				t.Errorf("posts = %+v, want the stored post", body.Posts)
+			}
+		})
+		if out := logs.String(); !strings.Contains(out, "level=WARN") || !strings.Contains(out, "serving posts without user check") {
+			t.Errorf("logs = %q, want a warning about the skipped check", out)
+		}
+	})
+
+	t.Run("lenient still guards writes", func(t *testing.T) {
+		serviceDown(t, 5)
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			body := `{"user_id":"` + author + `","title":"Hello","content":"World"}`
+			w := serve(newTestRouter(t, lenient), "POST", "/posts", body, "Authorization", bearer(t, author, ""))
+			if w.Code != 502 {
+				t.Errorf("status = %d, want 502: %s", w.Code, w.Body)
+			}
+			if n := len(commandsNamed(mt, "insert")); n != 0 {
+				t.Errorf("inserted %d documents without a user check", n)
+			}
+		})
+	})
+}
+
+func TestGetUserPosts(t *testing.T) {
+	const user = "64b000000000000000000001"
+	lookups := 0
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users/"+user {
+			http.NotFound(w, r)
+			return
+		}
+		lookups++
+		w.Write([]byte(`{"name":"Alice"}`))
+	}))
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		posts := []any{
+			Post{ID: primitive.NewObjectID(), UserID: user, Title: "Third"},
+			Post{ID: primitive.NewObjectID(), UserID: user, Title: "Fourth"},
+		}
+		mt.AddMockResponses(countResponse(5), findResponse(t, posts...))
+
+		w := serve(r, "GET", "/users/"+user+"/posts?limit=2&offset=2", "")
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var body struct {
+			UserID   string `json:"user_id"`
+			UserName string `json:"user_name"`
+			Posts    []Post `json:"posts"`
+			Total    int64  `json:"total"`
+			Limit    int64  `json:"limit"`
+			Offset   int64  `json:"offset"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.UserID != user || body.UserName != "Alice" {
+			t.Errorf("user = %q/%q, want %s/Alice", body.UserID, body.UserName, user)
+		}
+		if len(body.Posts) != 2 || body.Total != 5 || body.Limit != 2 || body.Offset != 2 {
+			t.Errorf("page = %d posts, total %d, limit %d, offset %d", len(body.Posts), body.Total, body.Limit, body.Offset)
+		}
+		find := startedCommand(t, mt, "find")
+		if limit, skip := find.Lookup("limit").AsInt64(), find.Lookup("skip").AsInt64(); limit != 2 || skip != 2 {
+			t.Errorf("find limit/skip = %d/%d, want 2/2", limit, skip)
+		}
+
+		// The name is cached, so the next page does not ask again.
+		mt.AddMockResponses(countResponse(5), findResponse(t))
+		if w := serve(r, "GET", "/users/"+user+"/posts?limit=2&offset=4", ""); w.Code != 200 {
+			t.Fatalf("second page status = %d: %s", w.Code, w.Body)
+		}
+		if lookups != 1 {
+			t.Errorf("user service asked %d times, want 1", lookups)
+		}
+	})
+
+	r := newTestRouter(t, nil)
+	w := serve(r, "GET", "/users/"+primitive.NewObjectID().Hex()+"/posts", "")
+	if w.Code != 404 || errorCode(t, w) != codeNotFound {
+		t.Errorf("unknown user: status = %d, body %s; want 404", w.Code, w.Body)
+	}
+	if w := serve(r, "GET", "/users/"+user+"/posts?limit=abc", ""); w.Code != 400 {
+		t.Errorf("bad limit: status = %d, want 400", w.Code)
+	}
+}
+
+func TestCheckPostExists(t *testing.T) {
+	postID := primitive.NewObjectID()
+	path := "/posts/" + postID.Hex() + "/exists"
+
+	for _, tc := range []struct {
+		name  string
+		count int
+		want  string
+	}{
+		{"existing", 1, `{"exists":true,"id":"` + postID.Hex() + `"}`},
+		{"missing", 0, `{"exists":false,"id":"` + postID.Hex() + `"}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				mt.AddMockResponses(countResponse(tc.count))
+
+				w := serve(newTestRouter(t, nil), "GET", path, "")
+				if w.Code != 200 || w.Body.String() != tc.want {
+					t.Fatalf("got %d %s, want 200 %s", w.Code, w.Body, tc.want)
+				}
+
+				pipeline := startedCommand(t, mt, "aggregate").Lookup("pipeline").Array()
+				match := pipeline.Index(0).Value().Document().Lookup("$match").Document()
+				if got := match.Lookup("_id").ObjectID(); got != postID {
+					t.Errorf("$match _id = %s, want %s", got.Hex(), postID.Hex())
+				}
+				if v, err := match.LookupErr("deleted_at"); err != nil || v.Type != bson.TypeNull {
+					t.Errorf("$match %s counts deleted posts", match)
+				}
+				if limit := pipeline.Index(1).Value().Document().Lookup("$limit").AsInt64(); limit != 1 {
+					t.Errorf("$limit = %d, want 1", limit)
+				}
+			})
+		})
+	}
+
+	t.Run("invalid ID", func(t *testing.T) {
+		w := serve(newTestRouter(t, nil), "GET", "/posts/not-an-id/exists", "")
+		if w.Code != 400 || errorCode(t, w) != codeInvalidID {
+			t.Errorf("got %d %s, want 400 %s", w.Code, w.Body, codeInvalidID)
+		}
+	})
+}
+
+func TestListAllPosts(t *testing.T) {
+	admin := bearer(t, primitive.NewObjectID().Hex(), roleAdmin)
+
+	// list runs GET /posts with query as an admin and returns the filter sent
+	// with the find.
+	list := func(t *testing.T, query string) bson.Raw {
+		t.Helper()
+		var filter bson.Raw
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(countResponse(1), findResponse(t, Post{ID: primitive.NewObjectID(), Title: "Hi"}))
+
+			w := serve(r, "GET", "/posts"+query, "", "Authorization", admin)
+			if w.Code != 200 {
+				t.Fatalf("%q: status = %d: %s", query, w.Code, w.Body)
+			}
+			var body struct {
+				Posts []Post `json:"posts"`
+				Total int64  `json:"total"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Posts) != 1 || body.Total != 1 {
+				t.Errorf("%q: %d posts, total %d", query, len(body.Posts), body.Total)
+			}
+
+			find := startedCommand(t, mt, "find")
+			if sort := find.Lookup("sort").Document().String(); !strings.HasPrefix(sort, `{"created_at": {"$numberInt":"-1"}`) {
+				t.Errorf("%q: sort = %s, want created_at descending", query, sort)
+			}
+			filter = find.Lookup("filter").Document()
+		})
+		return filter
+	}
+
+	t.Run("unfiltered", func(t *testing.T) {
+		filter := list(t, "")
+		for _, key := range []string{"user_id", "tags", "created_at"} {
+			if _, err := filter.LookupErr(key); err == nil {
+				t.Errorf("filter %s has %s", filter, key)
+			}
+		}
+		if v, err := filter.LookupErr("deleted_at"); err != nil || v.Type != bson.TypeNull {
+			t.Errorf("filter %s does not exclude deleted posts", filter)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		const user = "64b000000000000000000001"
+		filter := list(t, "?user_id="+user+"&tag=Go&created_after=2024-05-01T07:00:00%2B07:00")
+		if got := filter.Lookup("user_id").StringValue(); got != user {
+			t.Errorf("user_id = %q, want %s", got, user)
+		}
+		if got := filter.Lookup("tags").StringValue(); got != "go" {
+			t.Errorf("tags = %q, want go", got)
+		}
+		if got, want := filter.Lookup("created_at", "$gt").Time(), time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+			t.Errorf("created_at > %v, want %v", got, want)
+		}
+	})
+
+	r := newTestRouter(t, nil)
+	for _, query := range []string{"?created_after=yesterday", "?user_id=alice"} {
+		if w := serve(r, "GET", "/posts"+query, "", "Authorization", admin); w.Code != 400 {
+			t.Errorf("%q: status = %d, want 400", query, w.Code)
+		}
+	}
+	if w := serve(r, "GET", "/posts", "", "Authorization", bearer(t, primitive.NewObjectID().Hex(), "")); w.Code != 403 {
+		t.Errorf("non-admin: status = %d, want 403", w.Code)
+	}
+	if w := serve(r, "GET", "/posts", ""); w.Code != 401 {
+		t.Errorf("anonymous: status = %d, want 401", w.Code)
+	}
+}
+
+func TestGetRecentPosts(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	// Newest first across authors, as the sorted find returns them.
+	recent := []any{
+		Post{ID: primitive.NewObjectID(), UserID: "64b000000000000000000002", Title: "Bob's", CreatedAt: now},
+		Post{ID: primitive.NewObjectID(), UserID: "64b000000000000000000001", Title: "Alice's", CreatedAt: now.Add(-time.Minute)},
+		Post{ID: primitive.NewObjectID(), UserID: "64b000000000000000000002", Title: "Bob's older", CreatedAt: now.Add(-time.Hour)},
+	}
+
+	t.Run("newest first across users", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t, recent...))
+
+			w := serve(r, "GET", "/posts/recent?limit=3", "")
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var body struct {
+				Posts []Post `json:"posts"`
+				Limit int64  `json:"limit"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			var titles []string
+			for _, p := range body.Posts {
+				titles = append(titles, p.Title)
+			}
+			if want := []string{"Bob's", "Alice's", "Bob's older"}; !slices.Equal(titles, want) || body.Limit != 3 {
+				t.Errorf("posts = %v, limit %d; want %v, limit 3", titles, body.Limit, want)
+			}
+
+			find := startedCommand(t, mt, "find")
+			if sort := find.Lookup("sort").Document().String(); sort != `{"created_at": {"$numberInt":"-1"},"_id": {"$numberInt":"-1"}}` {
+				t.Errorf("sort = %s, want newest first", sort)
+			}
+			if got := find.Lookup("limit").AsInt64(); got != 3 {
+				t.Errorf("find limit = %d, want 3", got)
+			}
+			filter := find.Lookup("filter").Document()
+			if _, err := filter.LookupErr("user_id"); err == nil {
+				t.Errorf("filter %s is scoped to one user", filter)
+			}
+			if v, err := filter.LookupErr("deleted_at"); err != nil || v.Type != bson.TypeNull {
+				t.Errorf("filter %s does not exclude deleted posts", filter)
+			}
+			if !filter.Lookup("hidden", "$ne").Boolean() {
+				t.Errorf("filter %s does not exclude hidden posts", filter)
+			}
+			if filter.Lookup("published", "$ne").Boolean() {
+				t.Errorf("filter %s does not exclude scheduled posts", filter)
+			}
+		})
+	})
+
+	t.Run("limit is capped", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, func(cfg *Config) { cfg.MaxPageSize = 20 })
+			mt.AddMockResponses(findResponse(t))
+
+			if w := serve(r, "GET", "/posts/recent?limit=1000", ""); w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if got := startedCommand(t, mt, "find").Lookup("limit").AsInt64(); got != 20 {
+				t.Errorf("find limit = %d, want the cap of 20", got)
+			}
+		})
+	})
+}
+
+// evalGroup runs the accumulators of a single-group $group stage over docs,
+// covering the $sum, $min and $max forms getPostStats and getTopAuthors use.
+func evalGroup(t *testing.T, group bson.Raw, docs []bson.M) bson.M {
+	t.Helper()
+	elems, err := group.Elements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := bson.M{"_id": nil}
+	for _, elem := range elems {
+		if elem.Key() == "_id" {
+			continue
+		}
+		acc := elem.Value().Document().Index(0)
+		arg := acc.Value()
+		name, _ := arg.StringValueOK()
+		field, isField := strings.CutPrefix(name, "$")
+		var result any
+		for _, doc := range docs {
+			switch acc.Key() {
+			case "$sum":
+				var n int64
+				if isField {
+					n = int64(doc[field].(int32))
+				} else {
+					n = arg.AsInt64()
+				}
+				total, _ := result.(int64)
+				result = total + n
+			case "$min", "$max":
+				var less bool
+				switch v := doc[field].(type) {
+				case primitive.DateTime:
+					cur, _ := result.(primitive.DateTime)
+					less = v < cur
+				case string:
+					cur, _ := result.(string)
+					less = v < cur
+				}
+				if result == nil || (acc.Key() == "$min") == less {
+					result = doc[field]
+				}
+			default:
+				t.Fatalf("unsupported accumulator %s", acc.Key())
+			}
+		}
+		out[elem.Key()] = result
+	}
+	return out
+}
+
+func TestGetPostStats(t *testing.T) {
+	const user = "64b000000000000000000001"
+	first := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	posts := []Post{
+		{UserID: user, Likes: 4, CreatedAt: first.Add(48 * time.Hour)},
+		{UserID: user, Likes: 0, CreatedAt: first},
+		{UserID: user, Likes: 7, CreatedAt: first.Add(time.Hour)},
+	}
+
+	type stats struct {
+		UserID      string     `json:"user_id"`
+		TotalPosts  int64      `json:"total_posts"`
+		TotalLikes  int64      `json:"total_likes"`
+		FirstPostAt *time.Time `json:"first_post_at"`
+		LastPostAt  *time.Time `json:"last_post_at"`
+	}
+	decode := func(t *testing.T, w *httptest.ResponseRecorder) stats {
+		t.Helper()
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var got stats
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	// get asks for the user's stats twice: the first request shows the
+	// pipeline the handler sends, and the second is answered by running that
+	// pipeline's $group over posts, so the test checks the aggregation itself
+	// rather than a hand-made reply.
+	get := func(t *testing.T, mt *mtest.T, posts []Post) stats {
+		t.Helper()
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(findResponse(t))
+		empty := decode(t, serve(r, "GET", "/posts/stats/"+user, ""))
+
+		pipeline := startedCommand(t, mt, "aggregate").Lookup("pipeline").Array()
+		match := pipeline.Index(0).Value().Document().Lookup("$match").Document()
+		if match.Lookup("user_id").StringValue() != user {
+			t.Errorf("$match = %s, want the user's posts", match)
+		}
+		for _, key := range []string{"deleted_at", "hidden", "published"} {
+			if _, err := match.LookupErr(key); err != nil {
+				t.Errorf("$match = %s does not filter on %s", match, key)
+			}
+		}
+		if len(posts) == 0 {
+			return empty
+		}
+
+		var docs []bson.M
+		for _, p := range posts {
+			raw, err := bson.Marshal(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc bson.M
+			if err := bson.Unmarshal(raw, &doc); err != nil {
+				t.Fatal(err)
+			}
+			docs = append(docs, doc)
+		}
+		group := pipeline.Index(1).Value().Document().Lookup("$group").Document()
+		mt.AddMockResponses(findResponse(t, evalGroup(t, group, docs)))
+		return decode(t, serve(r, "GET", "/posts/stats/"+user, ""))
+	}
+
+	t.Run("aggregates the user's posts", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			got := get(t, mt, posts)
+			if got.UserID != user || got.TotalPosts != 3 || got.TotalLikes != 11 {
+				t.Errorf("stats = %+v, want 3 posts and 11 likes", got)
+			}
+			if got.FirstPostAt == nil || !got.FirstPostAt.Equal(first) {
+				t.Errorf("first_post_at = %v, want %v", got.FirstPostAt, first)
+			}
+			if want := first.Add(48 * time.Hour); got.LastPostAt == nil || !got.LastPostAt.Equal(want) {
+				t.Errorf("last_post_at = %v, want %v", got.LastPostAt, want)
+			}
+		})
+	})
+
+	t.Run("user without posts", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			got := get(t, mt, nil)
+			if got.TotalPosts != 0 || got.TotalLikes != 0 || got.FirstPostAt != nil || got.LastPostAt != nil {
+				t.Errorf("stats = %+v, want zeros and nulls", got)
+			}
+		})
+	})
+}
+
+func TestIndexesGateReadiness(t *testing.T) {
+	// createIndexes counts the index builds the mock was asked for.
+	createIndexes := func(mt *mtest.T) int {
+		n := 0
+		for _, ev := range mt.GetAllStartedEvents() {
+			if ev.CommandName == "createIndexes" {
+				n++
+			}
+		}
+		return n
+	}
+	t.Cleanup(func() { indexesReady.Store(false) })
+
+	t.Run("failed index keeps the service starting", func(t *testing.T) {
+		indexesReady.Store(false)
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+				Code: 11000, Name: "DuplicateKey", Message: "E11000 duplicate key error",
+			}))
+			for range 20 {
+				mt.AddMockResponses(mtest.CreateSuccessResponse())
+			}
+
+			err := prepareIndexes(testConfig(t))
+			if err == nil || !strings.Contains(err.Error(), "cannot create index") {
+				t.Fatalf("prepareIndexes = %v, want the index error that stops main", err)
+			}
+			if indexesReady.Load() {
+				t.Error("ready after a failed index build")
+			}
+			w := serve(newTestRouter(t, nil), "GET", "/healthz", "")
+			if w.Code != 503 || !strings.Contains(w.Body.String(), `"starting"`) {
+				t.Errorf("healthz = %d %s, want 503 starting", w.Code, w.Body)
+			}
+		})
+	})
+
+	t.Run("ready once every index is built", func(t *testing.T) {
+		indexesReady.Store(false)
+		var logs bytes.Buffer
+		previous := slog.Default()
+		slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+		t.Cleanup(func() { slog.SetDefault(previous) })
+
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			for range 20 {
+				mt.AddMockResponses(mtest.CreateSuccessResponse())
+			}
+			w := serve(newTestRouter(t, nil), "GET", "/healthz", "")
+			if w.Code != 503 {
+				t.Errorf("healthz before indexes = %d, want 503", w.Code)
+			}
+
+			if err := prepareIndexes(testConfig(t)); err != nil {
+				t.Fatalf("prepareIndexes: %v", err)
+			}
+			if !indexesReady.Load() {
+				t.Error("not ready after every index was built")
+			}
+			if built, logged := createIndexes(mt), strings.Count(logs.String(), "index ready"); built == 0 || logged != built {
+				t.Errorf("built %d indexes but logged %d", built, logged)
+			}
+		})
+	})
+}
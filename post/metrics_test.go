@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func inflight(t *testing.T) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := httpInflightRequests.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func TestInflightRequests(t *testing.T) {
+	const concurrent = 5
+	var entered sync.WaitGroup
+	entered.Add(concurrent)
+	release := make(chan struct{})
+
+	r := gin.New()
+	r.Use(jsonRecovery(), metricsMiddleware())
+	r.GET("/slow", func(c *gin.Context) {
+		entered.Done()
+		<-release
+		c.Status(204)
+	})
+	r.GET("/abort", func(c *gin.Context) { c.AbortWithStatus(403) })
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	base := inflight(t)
+
+	var done sync.WaitGroup
+	for range concurrent {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+		}()
+	}
+	entered.Wait()
+	if got := inflight(t) - base; got != concurrent {
+		t.Errorf("in flight = %v while %d requests wait, want %d", got, concurrent, concurrent)
+	}
+
+	close(release)
+	done.Wait()
+	if got := inflight(t) - base; got != 0 {
+		t.Errorf("in flight = %v after the requests finished, want 0", got)
+	}
+
+	for _, path := range []string{"/abort", "/panic"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code == 200 {
+			t.Errorf("%s status = 200", path)
+		}
+		if got := inflight(t) - base; got != 0 {
+			t.Errorf("in flight = %v after %s, want 0", got, path)
+		}
+	}
+}
+
+func TestUserServiceCallMetrics(t *testing.T) {
+	read := func(t *testing.T, outcome string) (calls float64, observed uint64) {
+		t.Helper()
+		var counter, histogram dto.Metric
+		if err := userServiceRequestsTotal.WithLabelValues("user_exists", outcome).Write(&counter); err != nil {
+			t.Fatal(err)
+		}
+		observer := userServiceRequestDuration.WithLabelValues("user_exists").(prometheus.Metric)
+		if err := observer.Write(&histogram); err != nil {
+			t.Fatal(err)
+		}
+		return counter.GetCounter().GetValue(), histogram.GetHistogram().GetSampleCount()
+	}
+
+	for _, tc := range []struct {
+		outcome string
+		handler http.HandlerFunc
+	}{
+		{"ok", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"exists":true}`)) }},
+		{"not_found", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"exists":false}`)) }},
+		{"error", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(502) }},
+		{"timeout", func(w http.ResponseWriter, r *http.Request) { time.Sleep(200 * time.Millisecond) }},
+	} {
+		t.Run(tc.outcome, func(t *testing.T) {
+			fakeUserServiceWith(t, tc.handler, func(cfg *Config) {
+				cfg.UserServiceRetries = 1
+				cfg.UserServiceTimeout = 50 * time.Millisecond
+			})
+			calls, observed := read(t, tc.outcome)
+
+			_, err := userService.checkUserExists(context.Background(), primitive.NewObjectID().Hex())
+			if wantErr := tc.outcome == "error" || tc.outcome == "timeout"; (err != nil) != wantErr {
+				t.Fatalf("checkUserExists error = %v, want error %t", err, wantErr)
+			}
+
+			afterCalls, afterObserved := read(t, tc.outcome)
+			if afterCalls-calls != 1 {
+				t.Errorf("%s counter rose by %v, want 1", tc.outcome, afterCalls-calls)
+			}
+			if afterObserved-observed != 1 {
+				t.Errorf("latency histogram got %d samples, want 1", afterObserved-observed)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func newLogger() *slog.Logger {
+	level := slog.LevelInfo
+	var invalidLevel string
+	if raw := os.Getenv("LOG_LEVEL"); raw != "" {
+		if err := level.UnmarshalText([]byte(strings.ToUpper(raw))); err != nil {
+			level = slog.LevelInfo
+			invalidLevel = raw
+		}
+	}
+
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})
+	logger := slog.New(requestIDHandler{Handler: handler})
+	if invalidLevel != "" {
+		logger.Warn("unknown LOG_LEVEL, defaulting to info", "log_level", invalidLevel)
+	}
+	return logger
+}
+
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" {
+			id = uuid.NewString()
+		}
+
+		c.Set("request_id", id)
+		c.Header(requestIDHeader, id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDKey{}, id))
+
+		c.Next()
+	}
+}
+
+// requestLogger logs every request. Ones slower than slowThreshold are raised
+// to WARN with their route; zero turns that off.
+func requestLogger(slowThreshold time.Duration, skipPrefixes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if hasAnyPrefix(c.Request.URL.Path, skipPrefixes) {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+
+		c.Next()
+
+		latency := time.Since(start)
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		msg := "request"
+		if slowThreshold > 0 && latency > slowThreshold {
+			level = slog.LevelWarn
+			msg = "slow request"
+		}
+		if status >= 500 {
+			level = slog.LevelError
+		}
+
+		slog.Log(c.Request.Context(), level, msg,
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", status,
+			"latency_ms", latency.Milliseconds(),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+// bodyLimit caps request bodies at maxBytes, or at the override for the
+// matched route. Bodies that declare a larger Content-Length are rejected up
+// front; others fail with *http.MaxBytesError when read past the limit.
+func bodyLimit(maxBytes int64, overrides map[string]int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := maxBytes
+		if override, ok := overrides[c.FullPath()]; ok {
+			limit = override
+		}
+
+		if c.Request.ContentLength > limit {
+			respondError(c, 413, codePayloadTooLarge, fmt.Sprintf("request body must be at most %d bytes", limit))
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// jsonRecovery turns a handler panic into the standard 500 envelope. The
+// panic value and stack go to the log only.
+func jsonRecovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		slog.ErrorContext(c.Request.Context(), "panic recovered",
+			"panic", fmt.Sprint(recovered),
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"stack", string(debug.Stack()),
+		)
+		respondError(c, 500, codeInternal, "internal server error")
+	})
+}
+
+func hasAnyPrefix(path string, prefixes []string) bool {
+	return slices.ContainsFunc(prefixes, func(prefix string) bool {
+		return strings.HasPrefix(path, prefix)
+	})
+}
+
+func parseAllowedOrigins(raw string) []string {
+	var origins []string
+	for _, origin := range strings.Split(raw, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+func cors(allowedOrigins []string) gin.HandlerFunc {
+	allowAll := slices.Contains(allowedOrigins, "*")
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		specific := slices.Contains(allowedOrigins, origin)
+		if !specific && !allowAll {
+			if preflight {
+				c.AbortWithStatus(403)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if specific {
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Set("Access-Control-Allow-Credentials", "true")
+		} else {
+			header.Set("Access-Control-Allow-Origin", "*")
+		}
+		header.Set("Access-Control-Expose-Headers", requestIDHeader+", ETag, Idempotent-Replayed, Location")
+
+		if preflight {
+			header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			if requested := c.GetHeader("Access-Control-Request-Headers"); requested != "" {
+				header.Set("Access-Control-Allow-Headers", requested)
+			}
+			header.Set("Access-Control-Max-Age", "600")
+			c.AbortWithStatus(204)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+const gzipMinLength = 1024
+
+var gzipWriterPool = sync.Pool{
+	New: func() any { return gzip.NewWriter(io.Discard) },
+}
+
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func gzipCompression(skipPaths ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodHead ||
+			!strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") ||
+			hasAnyPrefix(c.Request.URL.Path, skipPaths) {
+			c.Next()
+			return
+		}
+
+		// Put the real writer back even if a handler panics, so jsonRecovery
+		// further up the chain writes its envelope to the client rather than
+		// into the abandoned buffer.
+		original := c.Writer
+		buffered := &bufferedResponseWriter{ResponseWriter: original}
+		c.Writer = buffered
+		defer func() { c.Writer = original }()
+
+		c.Next()
+
+		body := buffered.body.Bytes()
+		header := original.Header()
+		header.Add("Vary", "Accept-Encoding")
+
+		if len(body) < gzipMinLength || header.Get("Content-Encoding") != "" {
+			if len(body) > 0 {
+				header.Set("Content-Length", strconv.Itoa(len(body)))
+			}
+			original.Write(body)
+			return
+		}
+
+		var compressed bytes.Buffer
+		gz := gzipWriterPool.Get().(*gzip.Writer)
+		gz.Reset(&compressed)
+		gz.Write(body)
+		gz.Close()
+		gzipWriterPool.Put(gz)
+
+		header.Set("Content-Encoding", "gzip")
+		header.Set("Content-Length", strconv.Itoa(compressed.Len()))
+		original.Write(compressed.Bytes())
+	}
+}
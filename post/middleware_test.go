@@ -0,0 +1,269 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestJSONRecoveryReturnsEnvelope(t *testing.T) {
+	r := gin.New()
+	r.Use(jsonRecovery(), gzipCompression())
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	for _, encoding := range []string{"", "gzip"} {
+		w := serve(r, "GET", "/panic", "", "Accept-Encoding", encoding)
+		if w.Code != 500 {
+			t.Fatalf("Accept-Encoding %q: status = %d, want 500", encoding, w.Code)
+		}
+		if code := errorCode(t, w); code != codeInternal {
+			t.Errorf("Accept-Encoding %q: code = %q, want %q", encoding, code, codeInternal)
+		}
+	}
+}
+
+func TestGzipCompression(t *testing.T) {
+	large := strings.Repeat(`{"title":"a post","content":"some content"},`, 100)
+	r := gin.New()
+	r.Use(gzipCompression("/metrics"))
+	r.GET("/large", func(c *gin.Context) { c.String(200, large) })
+	r.GET("/small", func(c *gin.Context) { c.String(200, "ok") })
+	r.GET("/metrics", func(c *gin.Context) { c.String(200, large) })
+
+	t.Run("large body", func(t *testing.T) {
+		w := serve(r, "GET", "/large", "", "Accept-Encoding", "gzip, deflate")
+		if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("Content-Encoding = %q, want gzip", got)
+		}
+		if got, want := w.Header().Get("Content-Length"), strconv.Itoa(w.Body.Len()); got != want {
+			t.Errorf("Content-Length = %s, want %s", got, want)
+		}
+		zr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plain) != large {
+			t.Error("decompressed body does not match")
+		}
+	})
+
+	for _, tc := range []struct{ name, path, encoding string }{
+		{"small body", "/small", "gzip"},
+		{"client without gzip", "/large", ""},
+		{"skipped path", "/metrics", "gzip"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(r, "GET", tc.path, "", "Accept-Encoding", tc.encoding)
+			if got := w.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding = %q, want none", got)
+			}
+			if w.Code != 200 || w.Body.Len() == 0 {
+				t.Errorf("status = %d, %d bytes; want the plain body", w.Code, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	const allowed = "https://app.example.com"
+	r := gin.New()
+	r.Use(cors([]string{allowed}))
+	r.GET("/", func(c *gin.Context) { c.String(200, "ok") })
+	r.OPTIONS("/", func(c *gin.Context) { c.String(200, "reached handler") })
+
+	t.Run("allowed origin", func(t *testing.T) {
+		w := serve(r, "GET", "/", "", "Origin", allowed)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != allowed {
+			t.Errorf("Allow-Origin = %q, want %q", got, allowed)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("Allow-Credentials = %q, want true", got)
+		}
+	})
+
+	t.Run("disallowed origin", func(t *testing.T) {
+		w := serve(r, "GET", "/", "", "Origin", "https://evil.example.com")
+		if w.Code != 200 {
+			t.Errorf("status = %d, want the request served", w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("Allow-Origin = %q, want none", got)
+		}
+	})
+
+	t.Run("preflight", func(t *testing.T) {
+		w := serve(r, "OPTIONS", "/", "",
+			"Origin", allowed,
+			"Access-Control-Request-Method", "DELETE",
+			"Access-Control-Request-Headers", "Authorization")
+		if w.Code != 204 {
+			t.Fatalf("status = %d, want 204", w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, "DELETE") {
+			t.Errorf("Allow-Methods = %q, want DELETE listed", got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Authorization" {
+			t.Errorf("Allow-Headers = %q, want Authorization", got)
+		}
+	})
+
+	t.Run("disallowed preflight", func(t *testing.T) {
+		w := serve(r, "OPTIONS", "/", "",
+			"Origin", "https://evil.example.com",
+			"Access-Control-Request-Method", "DELETE")
+		if w.Code != 403 {
+			t.Errorf("status = %d, want 403", w.Code)
+		}
+	})
+
+	t.Run("wildcard", func(t *testing.T) {
+		r := gin.New()
+		r.Use(cors([]string{"*"}))
+		r.GET("/", func(c *gin.Context) { c.String(200, "ok") })
+
+		w := serve(r, "GET", "/", "", "Origin", "https://anyone.example.com")
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("Allow-Origin = %q, want *", got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("Allow-Credentials = %q, want none with a wildcard", got)
+		}
+	})
+}
+
+func TestBodyLimit(t *testing.T) {
+	r := newTestRouter(t, func(cfg *Config) {
+		cfg.MaxBodyBytes = 64
+		cfg.BulkMaxBodyBytes = 256
+	})
+	token := bearer(t, "64b000000000000000000001", "")
+	post := `{"title":"` + strings.Repeat("x", 100) + `","content":"Body"}`
+
+	tests := []struct {
+		name, path, body string
+		chunked          bool
+		want             int
+	}{
+		{"create over the limit", "/posts", post, false, 413},
+		{"create over the limit without a length", "/posts", post, true, 413},
+		// Over the default limit but under the bulk one, so it reaches the
+		// handler and fails there for not being an array.
+		{"bulk under its own limit", "/posts/bulk", post, false, 400},
+		{"bulk over its own limit", "/posts/bulk", "[" + strings.Repeat(post+",", 3) + post + "]", false, 413},
+		{"bulk over its own limit without a length", "/posts/bulk", "[" + strings.Repeat(post+",", 3) + post + "]", true, 413},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", token)
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if code := errorCode(t, w); tt.want == 413 && code != codePayloadTooLarge {
+				t.Errorf("code = %q, want %q", code, codePayloadTooLarge)
+			}
+		})
+	}
+}
+
+// recordingHandler is a slog.Handler that keeps every record it is given.
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler      { return h }
+
+// captureLogs sends the default logger to a recordingHandler for one test.
+func captureLogs(t *testing.T) *recordingHandler {
+	h := &recordingHandler{}
+	previous := slog.Default()
+	slog.SetDefault(slog.New(h))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return h
+}
+
+func TestRequestLoggerSlowThreshold(t *testing.T) {
+	router := func(threshold time.Duration) *gin.Engine {
+		r := gin.New()
+		r.Use(requestLogger(threshold))
+		r.GET("/fast/:id", func(c *gin.Context) { c.Status(200) })
+		r.GET("/slow/:id", func(c *gin.Context) {
+			time.Sleep(40 * time.Millisecond)
+			c.Status(200)
+		})
+		return r
+	}
+	// logged serves path and returns the one record the logger wrote.
+	logged := func(t *testing.T, r *gin.Engine, path string) (slog.Record, map[string]slog.Value) {
+		t.Helper()
+		logs := captureLogs(t)
+		serve(r, "GET", path, "")
+		if len(logs.records) != 1 {
+			t.Fatalf("%s: logged %d records, want 1", path, len(logs.records))
+		}
+		rec := logs.records[0]
+		attrs := map[string]slog.Value{}
+		rec.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value
+			return true
+		})
+		return rec, attrs
+	}
+
+	t.Run("slow request warns", func(t *testing.T) {
+		rec, attrs := logged(t, router(20*time.Millisecond), "/slow/1")
+		if rec.Level != slog.LevelWarn || rec.Message != "slow request" {
+			t.Errorf("logged %s %q, want WARN slow request", rec.Level, rec.Message)
+		}
+		if got := attrs["route"].String(); got != "/slow/:id" {
+			t.Errorf("route = %q, want /slow/:id", got)
+		}
+		if got := attrs["latency_ms"].Int64(); got < 20 {
+			t.Errorf("latency_ms = %d, want at least the 20ms threshold", got)
+		}
+	})
+
+	t.Run("fast request stays at info", func(t *testing.T) {
+		rec, _ := logged(t, router(20*time.Millisecond), "/fast/1")
+		if rec.Level != slog.LevelInfo || rec.Message != "request" {
+			t.Errorf("logged %s %q, want INFO request", rec.Level, rec.Message)
+		}
+	})
+
+	t.Run("zero threshold disables the warning", func(t *testing.T) {
+		if rec, _ := logged(t, router(0), "/slow/1"); rec.Level != slog.LevelInfo {
+			t.Errorf("logged %s, want INFO with no threshold", rec.Level)
+		}
+	})
+}
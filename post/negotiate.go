@@ -0,0 +1,18 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// respondNegotiated writes xmlBody when the Accept header prefers XML and
+// jsonBody otherwise, including when no Accept header is sent.
+func respondNegotiated(c *gin.Context, status int, jsonBody, xmlBody any) {
+	c.Header("Vary", "Accept")
+	switch c.NegotiateFormat(binding.MIMEJSON, binding.MIMEXML, binding.MIMEXML2) {
+	case binding.MIMEXML, binding.MIMEXML2:
+		c.XML(status, xmlBody)
+	default:
+		c.JSON(status, jsonBody)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetPostsByUserIDNegotiatesFormat(t *testing.T) {
+	const user = "64b000000000000000000001"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"exists":true}`))
+	}))
+	post := Post{ID: primitive.NewObjectID(), UserID: user, Title: "Hello", Tags: []string{"go", "xml"}}
+
+	for _, tc := range []struct {
+		accept string
+		xml    bool
+	}{
+		{"application/xml", true},
+		{"text/xml", true},
+		{"application/xml;q=0.9, application/json;q=0.1", true},
+		{"application/json", false},
+		{"*/*", false},
+		{"text/html", false},
+		{"", false},
+	} {
+		t.Run(cmp.Or(tc.accept, "no accept"), func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				r := newTestRouter(t, nil)
+				mt.AddMockResponses(countResponse(1), findResponse(t, post))
+
+				var header []string
+				if tc.accept != "" {
+					header = []string{"Accept", tc.accept}
+				}
+				w := serve(r, "GET", "/posts/"+user+"?limit=5", "", header...)
+				if w.Code != 200 {
+					t.Fatalf("status = %d: %s", w.Code, w.Body)
+				}
+				if vary := w.Header().Get("Vary"); !strings.Contains(vary, "Accept") {
+					t.Errorf("Vary = %q, want Accept", vary)
+				}
+
+				contentType := w.Header().Get("Content-Type")
+				var got []Post
+				var limit int64
+				if tc.xml {
+					if !strings.Contains(contentType, "xml") {
+						t.Fatalf("Content-Type = %q, want XML", contentType)
+					}
+					var body postPageXML
+					if err := xml.Unmarshal(w.Body.Bytes(), &body); err != nil {
+						t.Fatalf("decode XML %s: %v", w.Body, err)
+					}
+					got, limit = body.Posts, body.Limit
+				} else {
+					if !strings.HasPrefix(contentType, "application/json") {
+						t.Fatalf("Content-Type = %q, want JSON", contentType)
+					}
+					var body struct {
+						Posts []Post `json:"posts"`
+						Limit int64  `json:"limit"`
+					}
+					if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+						t.Fatalf("decode JSON %s: %v", w.Body, err)
+					}
+					got, limit = body.Posts, body.Limit
+				}
+				if len(got) != 1 || got[0].ID != post.ID || !slices.Equal(got[0].Tags, post.Tags) || limit != 5 {
+					t.Errorf("posts = %+v, limit %d; want the tagged post and 5", got, limit)
+				}
+			})
+		})
+	}
+
+	t.Run("errors stay JSON", func(t *testing.T) {
+		w := serve(newTestRouter(t, nil), "GET", "/posts/"+user+"?limit=abc", "", "Accept", "application/xml")
+		if w.Code != 400 || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+			t.Errorf("status = %d, Content-Type %q; want a JSON 400", w.Code, w.Header().Get("Content-Type"))
+		}
+	})
+}
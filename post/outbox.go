@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	eventPostCreated = "post.created"
+	outboxBatchSize  = 100
+)
+
+// outboxCollection is nil when no broker is configured; posts are then
+// written without events.
+var outboxCollection *mongo.Collection
+
+type outboxEvent struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Type        string             `bson:"type"`
+	AggregateID primitive.ObjectID `bson:"aggregate_id"`
+	Payload     Post               `bson:"payload"`
+	CreatedAt   time.Time          `bson:"created_at"`
+	SentAt      *time.Time         `bson:"sent_at,omitempty"`
+}
+
+func newPostCreatedEvent(post Post) outboxEvent {
+	return outboxEvent{
+		ID:          primitive.NewObjectID(),
+		Type:        eventPostCreated,
+		AggregateID: post.ID,
+		Payload:     post,
+		CreatedAt:   time.Now().UTC(),
+	}
+}
+
+// insertWithOutbox writes post and its post.created event in one transaction
+// so an event exists exactly when the post does.
+func insertWithOutbox(ctx context.Context, post *Post) error {
+	session, err := mongoClient.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	post.ID = primitive.NewObjectID()
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		if _, err := postCollection.InsertOne(sc, post); err != nil {
+			return nil, err
+		}
+		if _, err := outboxCollection.InsertOne(sc, newPostCreatedEvent(*post)); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// insertEachWithOutbox writes every post with its event in a transaction of
+// its own, so a post that fails leaves the rest of the batch, and their
+// events, in place. It returns the failure message by index for the posts
+// that were not written.
+func insertEachWithOutbox(ctx context.Context, posts []*Post) map[int]string {
+	failed := map[int]string{}
+	for n, post := range posts {
+		err := insertWithOutbox(ctx, post)
+		if err == nil {
+			continue
+		}
+		var writeErr mongo.WriteException
+		if errors.As(err, &writeErr) && len(writeErr.WriteErrors) > 0 {
+			failed[n] = writeErr.WriteErrors[0].Message
+			continue
+		}
+		slog.ErrorContext(ctx, "cannot write post with outbox event", "error", err, "index", n)
+		failed[n] = "post could not be written"
+	}
+	return failed
+}
+
+// broker delivers events. publish returns only once the broker has
+// confirmed the event; tests swap in a fake.
+type broker interface {
+	connect() error
+	publish(ctx context.Context, event outboxEvent) error
+	close()
+}
+
+type outboxPublisher struct {
+	broker   broker
+	interval time.Duration
+}
+
+func newOutboxPublisher(cfg Config) *outboxPublisher {
+	return &outboxPublisher{
+		broker:   &amqpBroker{url: cfg.BrokerURL, exchange: cfg.BrokerExchange},
+		interval: cfg.OutboxPollInterval,
+	}
+}
+
+func (p *outboxPublisher) run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	defer p.broker.close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.drain(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("outbox publish failed", "error", err)
+				p.broker.close()
+			}
+		}
+	}
+}
+
+// drain publishes unsent events oldest first. An event is marked sent only
+// after the broker confirms it, so a crash in between re-sends it on the next
+// pass: delivery is at-least-once and consumers should dedupe on message ID.
+func (p *outboxPublisher) drain(ctx context.Context) error {
+	for {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		sent, err := p.drainBatch(ctx)
+		cancel()
+		if err != nil || sent < outboxBatchSize {
+			return err
+		}
+	}
+}
+
+func (p *outboxPublisher) drainBatch(ctx context.Context) (int, error) {
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(outboxBatchSize)
+	cursor, err := outboxCollection.Find(ctx, bson.M{"sent_at": nil}, findOpts)
+	if err != nil {
+		return 0, err
+	}
+
+	var events []outboxEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err := p.broker.connect(); err != nil {
+		return 0, err
+	}
+
+	for i, event := range events {
+		if err := p.broker.publish(ctx, event); err != nil {
+			return i, err
+		}
+
+		_, err := outboxCollection.UpdateOne(ctx,
+			bson.M{"_id": event.ID, "sent_at": nil},
+			bson.M{"$set": bson.M{"sent_at": time.Now().UTC()}},
+		)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
+
+// amqpBroker publishes to a RabbitMQ topic exchange with publisher confirms.
+type amqpBroker struct {
+	url      string
+	exchange string
+
+	conn    *amqp.Connection
+	channel *amqp.Channel
+}
+
+func (p *amqpBroker) publish(ctx context.Context, event outboxEvent) error {
+	body, err := json.Marshal(event.Payload)
+	if err != nil {
+		return err
+	}
+
+	confirm, err := p.channel.PublishWithDeferredConfirmWithContext(ctx, p.exchange, event.Type, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    event.ID.Hex(),
+		Type:         event.Type,
+		Timestamp:    event.CreatedAt,
+		Body:         body,
+	})
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return fmt.Errorf("broker rejected event %s", event.ID.Hex())
+	}
+	return nil
+}
+
+func (p *amqpBroker) connect() error {
+	if p.conn != nil && !p.conn.IsClosed() && p.channel != nil && !p.channel.IsClosed() {
+		return nil
+	}
+	p.close()
+
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		return err
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if err := channel.Confirm(false); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := channel.ExchangeDeclare(p.exchange, "topic", true, false, false, false, nil); err != nil {
+		conn.Close()
+		return err
+	}
+
+	p.conn, p.channel = conn, channel
+	return nil
+}
+
+func (p *amqpBroker) close() {
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.conn, p.channel = nil, nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// fakeBroker records published events and fails the ones listed in fail, or
+// every connect while down is set.
+type fakeBroker struct {
+	down      bool
+	fail      map[primitive.ObjectID]bool
+	published []primitive.ObjectID
+	closed    int
+}
+
+func (b *fakeBroker) connect() error {
+	if b.down {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (b *fakeBroker) publish(_ context.Context, event outboxEvent) error {
+	if b.fail[event.ID] {
+		return errors.New("nack")
+	}
+	b.published = append(b.published, event.ID)
+	return nil
+}
+
+func (b *fakeBroker) close() { b.closed++ }
+
+// withOutbox points the outbox at the mock collection for one test.
+func withOutbox(t *testing.T, mt *mtest.T) {
+	outboxCollection = mt.Coll
+	t.Cleanup(func() { outboxCollection = nil })
+}
+
+// commandNames lists the commands the handler sent, in order.
+func commandNames(mt *mtest.T) []string {
+	var names []string
+	for _, ev := range mt.GetAllStartedEvents() {
+		names = append(names, ev.CommandName)
+	}
+	return names
+}
+
+func TestCreatePostWritesOutboxEvent(t *testing.T) {
+	const author = "64b000000000000000000001"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"Alice"}`))
+	}))
+	body := `{"user_id":"` + author + `","title":"Hello","content":"World"}`
+	token := bearer(t, author, "")
+
+	t.Run("event committed with the post", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			withOutbox(t, mt)
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t), writeResponse(1), writeResponse(1), mtest.CreateSuccessResponse())
+
+			w := serve(r, "POST", "/posts", body, "Authorization", token)
+			if w.Code != 201 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if got, want := commandNames(mt), []string{"find", "insert", "insert", "commitTransaction"}; !slices.Equal(got, want) {
+				t.Fatalf("commands = %v, want %v", got, want)
+			}
+
+			inserts := commandsNamed(mt, "insert")
+			post := inserts[0].Lookup("documents", "0").Document()
+			event := inserts[1].Lookup("documents", "0").Document()
+			for _, cmd := range inserts {
+				if _, err := cmd.LookupErr("txnNumber"); err != nil {
+					t.Errorf("insert %s ran outside the transaction", cmd)
+				}
+			}
+			if got := event.Lookup("type").StringValue(); got != eventPostCreated {
+				t.Errorf("event type = %q, want %q", got, eventPostCreated)
+			}
+			if got, want := event.Lookup("aggregate_id").ObjectID(), post.Lookup("_id").ObjectID(); got != want {
+				t.Errorf("aggregate_id = %s, want the post's %s", got.Hex(), want.Hex())
+			}
+			if _, err := event.LookupErr("sent_at"); err == nil {
+				t.Error("new event already marked sent")
+			}
+
+			var created Post
+			if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+				t.Fatal(err)
+			}
+			if created.ID != post.Lookup("_id").ObjectID() {
+				t.Errorf("returned post %s, want the inserted one", created.ID.Hex())
+			}
+		})
+	})
+
+	t.Run("event failure drops the post", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			withOutbox(t, mt)
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(
+				findResponse(t),
+				writeResponse(1),
+				mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 121, Message: "Document failed validation"}),
+				mtest.CreateSuccessResponse(),
+			)
+
+			if w := serve(r, "POST", "/posts", body, "Authorization", token); w.Code != 500 {
+				t.Fatalf("status = %d, want 500: %s", w.Code, w.Body)
+			}
+			if got, want := commandNames(mt), []string{"find", "insert", "insert", "abortTransaction"}; !slices.Equal(got, want) {
+				t.Errorf("commands = %v, want %v", got, want)
+			}
+		})
+	})
+}
+
+func TestBulkCreatePostsWritesOutboxEventPerPost(t *testing.T) {
+	const alice = "64b000000000000000000001"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/exists":
+			json.NewEncoder(w).Encode(map[string]any{"results": map[string]bool{alice: true}})
+		case "/users/names":
+			json.NewEncoder(w).Encode(map[string]any{"names": map[string]string{alice: "Alice"}})
+		}
+	}))
+	admin := bearer(t, "64b0000000000000000000ad", roleAdmin)
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		withOutbox(t, mt)
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(
+			findResponse(t), findResponse(t),
+			// First post and its event commit.
+			writeResponse(1), writeResponse(1), mtest.CreateSuccessResponse(),
+			// The second post's insert fails, so its transaction aborts.
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 121, Message: "Document failed validation"}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		body := `[{"user_id":"` + alice + `","title":"First","content":"a"},
+			{"user_id":"` + alice + `","title":"Second","content":"b"}]`
+		w := serve(r, "POST", "/posts/bulk", body, "Authorization", admin)
+		if w.Code != 207 {
+			t.Fatalf("status = %d, want 207: %s", w.Code, w.Body)
+		}
+		var resp struct {
+			Results []struct {
+				Status string            `json:"status"`
+				Errors map[string]string `json:"errors"`
+			} `json:"results"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Results[0].Status != "created" || resp.Results[1].Status != "failed" || resp.Results[1].Errors["insert"] == "" {
+			t.Errorf("results = %+v, want the first created and the second failed", resp.Results)
+		}
+
+		want := []string{"find", "find", "insert", "insert", "commitTransaction", "insert", "abortTransaction"}
+		if got := commandNames(mt); !slices.Equal(got, want) {
+			t.Errorf("commands = %v, want %v", got, want)
+		}
+		for _, cmd := range commandsNamed(mt, "insert") {
+			if _, err := cmd.LookupErr("txnNumber"); err != nil {
+				t.Errorf("insert %s ran outside a transaction", cmd)
+			}
+			if n, _ := cmd.Lookup("documents").Array().Values(); len(n) != 1 {
+				t.Errorf("insert wrote %d documents, want one post or event at a time", len(n))
+			}
+		}
+	})
+}
+
+func TestOutboxPublisherDrain(t *testing.T) {
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	events := []any{
+		outboxEvent{ID: first, Type: eventPostCreated, AggregateID: primitive.NewObjectID(), CreatedAt: time.Now()},
+		outboxEvent{ID: second, Type: eventPostCreated, AggregateID: primitive.NewObjectID(), CreatedAt: time.Now()},
+	}
+
+	// marked returns the event IDs the publisher marked sent.
+	marked := func(t *testing.T, mt *mtest.T) []primitive.ObjectID {
+		t.Helper()
+		var ids []primitive.ObjectID
+		for _, cmd := range commandsNamed(mt, "update") {
+			update := cmd.Lookup("updates", "0").Document()
+			if v, err := update.LookupErr("q", "sent_at"); err != nil || v.Type != bson.TypeNull {
+				t.Errorf("update %s does not guard on sent_at", update)
+			}
+			if _, err := update.LookupErr("u", "$set", "sent_at"); err != nil {
+				t.Errorf("update %s does not set sent_at", update)
+			}
+			ids = append(ids, update.Lookup("q", "_id").ObjectID())
+		}
+		return ids
+	}
+
+	t.Run("marks published events sent", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			withOutbox(t, mt)
+			b := &fakeBroker{}
+			p := &outboxPublisher{broker: b, interval: time.Second}
+			mt.AddMockResponses(findResponse(t, events...), writeResponse(1), writeResponse(1))
+
+			if err := p.drain(context.Background()); err != nil {
+				t.Fatalf("drain: %v", err)
+			}
+			if want := []primitive.ObjectID{first, second}; !slices.Equal(b.published, want) || !slices.Equal(marked(t, mt), want) {
+				t.Errorf("published %v, marked %v; want both in order", b.published, marked(t, mt))
+			}
+			filter := startedCommand(t, mt, "find").Lookup("filter").Document()
+			if v, err := filter.LookupErr("sent_at"); err != nil || v.Type != bson.TypeNull {
+				t.Errorf("find filter %s, want only unsent events", filter)
+			}
+		})
+	})
+
+	t.Run("failed event is retried", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			withOutbox(t, mt)
+			b := &fakeBroker{fail: map[primitive.ObjectID]bool{second: true}}
+			p := &outboxPublisher{broker: b, interval: time.Second}
+			mt.AddMockResponses(findResponse(t, events...), writeResponse(1))
+
+			if err := p.drain(context.Background()); err == nil {
+				t.Fatal("drain succeeded with a rejected event")
+			}
+			if got := marked(t, mt); !slices.Equal(got, []primitive.ObjectID{first}) {
+				t.Errorf("marked %v, want only the confirmed event", got)
+			}
+
+			// The next pass finds the event still unsent and delivers it.
+			delete(b.fail, second)
+			mt.ClearEvents()
+			mt.AddMockResponses(findResponse(t, events[1]), writeResponse(1))
+			if err := p.drain(context.Background()); err != nil {
+				t.Fatalf("retry: %v", err)
+			}
+			if got := marked(t, mt); !slices.Equal(got, []primitive.ObjectID{second}) {
+				t.Errorf("retry marked %v, want %s", got, second.Hex())
+			}
+		})
+	})
+
+	t.Run("broker down marks nothing", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			withOutbox(t, mt)
+			p := &outboxPublisher{broker: &fakeBroker{down: true}, interval: time.Second}
+			mt.AddMockResponses(findResponse(t, events...))
+
+			if err := p.drain(context.Background()); err == nil {
+				t.Fatal("drain succeeded with the broker down")
+			}
+			if n := len(commandsNamed(mt, "update")); n != 0 {
+				t.Errorf("marked %d events sent with the broker down", n)
+			}
+		})
+	})
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+const pprofPrefix = "/debug/pprof"
+
+// registerPprof mounts the profiling handlers behind guards. Profiles expose
+// memory contents and command lines, so callers pass the admin check.
+func registerPprof(r *gin.Engine, guards ...gin.HandlerFunc) {
+	g := r.Group(pprofPrefix, guards...)
+	g.GET("/", gin.WrapF(pprof.Index))
+	g.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	g.GET("/profile", gin.WrapF(pprof.Profile))
+	g.GET("/symbol", gin.WrapF(pprof.Symbol))
+	g.POST("/symbol", gin.WrapF(pprof.Symbol))
+	g.GET("/trace", gin.WrapF(pprof.Trace))
+	g.GET("/:profile", gin.WrapF(pprof.Index))
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPprofRoutes(t *testing.T) {
+	admin := bearer(t, primitive.NewObjectID().Hex(), roleAdmin)
+	user := bearer(t, primitive.NewObjectID().Hex(), "")
+
+	t.Run("absent by default", func(t *testing.T) {
+		r := newTestRouter(t, nil)
+		for _, path := range []string{pprofPrefix + "/", pprofPrefix + "/heap", pprofPrefix + "/cmdline"} {
+			if w := serve(r, "GET", path, "", "Authorization", admin); w.Code != 404 {
+				t.Errorf("GET %s = %d, want 404", path, w.Code)
+			}
+		}
+	})
+
+	t.Run("admin only when enabled", func(t *testing.T) {
+		r := newTestRouter(t, func(cfg *Config) { cfg.EnablePprof = true })
+		path := pprofPrefix + "/cmdline"
+		if w := serve(r, "GET", path, ""); w.Code != 401 {
+			t.Errorf("anonymous: status = %d, want 401", w.Code)
+		}
+		if w := serve(r, "GET", path, "", "Authorization", user); w.Code != 403 {
+			t.Errorf("non-admin: status = %d, want 403", w.Code)
+		}
+		if w := serve(r, "GET", path, "", "Authorization", admin); w.Code != 200 || w.Body.Len() == 0 {
+			t.Errorf("admin: status = %d, want 200 with the command line", w.Code)
+		}
+		if w := serve(r, "GET", pprofPrefix+"/heap?debug=1", "", "Authorization", admin); w.Code != 200 {
+			t.Errorf("admin heap profile: status = %d, want 200", w.Code)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// projectableFields maps the JSON names clients may request in ?fields= to
+// the stored bson field names.
+var projectableFields = map[string]string{
+	"id":         "_id",
+	"user_id":    "user_id",
+	"user_name":  "user_name",
+	"title":      "title",
+	"content":    "content",
+	"slug":       "slug",
+	"tags":       "tags",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"likes":      "likes",
+	"version":    "version",
+	"publish_at": "publish_at",
+	"published":  "published",
+	"deleted_at": "deleted_at",
+	"expires_at": "expires_at",
+
+	"report_count": "report_count",
+	"hidden":       "hidden",
+}
+
+// parseFields turns a comma-separated ?fields= value into the JSON names to
+// keep and a Mongo projection. An empty value means the full document.
+func parseFields(raw string) ([]string, bson.M, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil, nil
+	}
+
+	fields := []string{"id"}
+	projection := bson.M{"_id": 1}
+	var unknown []string
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || slices.Contains(fields, name) {
+			continue
+		}
+		bsonName, ok := projectableFields[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		fields = append(fields, name)
+		projection[bsonName] = 1
+	}
+	if len(unknown) > 0 {
+		return nil, nil, fmt.Errorf("unknown fields: %s", strings.Join(unknown, ", "))
+	}
+	return fields, projection, nil
+}
+
+// projectPosts drops everything but fields from the JSON form of each post,
+// so zero values of unprojected fields are not sent back.
+func projectPosts(posts []Post, fields []string) ([]map[string]any, error) {
+	projected := make([]map[string]any, 0, len(posts))
+	for _, post := range posts {
+		raw, err := json.Marshal(post)
+		if err != nil {
+			return nil, err
+		}
+		var full map[string]any
+		if err := json.Unmarshal(raw, &full); err != nil {
+			return nil, err
+		}
+
+		doc := make(map[string]any, len(fields))
+		for _, field := range fields {
+			if v, ok := full[field]; ok {
+				doc[field] = v
+			}
+		}
+		projected = append(projected, doc)
+	}
+	return projected, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetPostsByUserIDFields(t *testing.T) {
+	const user = "64b000000000000000000001"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"exists":true}`))
+	}))
+
+	t.Run("titles only", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			post := Post{ID: primitive.NewObjectID(), Title: "Hello"}
+			mt.AddMockResponses(countResponse(1), findResponse(t, post))
+
+			w := serve(r, "GET", "/posts/"+user+"?fields=title", "")
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+
+			projection := startedCommand(t, mt, "find").Lookup("projection").Document()
+			elems, err := projection.Elements()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(elems) != 2 || projection.Lookup("_id").Int32() != 1 || projection.Lookup("title").Int32() != 1 {
+				t.Errorf("projection = %s, want _id and title", projection)
+			}
+
+			var resp struct {
+				Posts []map[string]any `json:"posts"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]any{"id": post.ID.Hex(), "title": "Hello"}
+			if len(resp.Posts) != 1 || len(resp.Posts[0]) != len(want) || resp.Posts[0]["id"] != want["id"] || resp.Posts[0]["title"] != want["title"] {
+				t.Errorf("posts = %v, want [%v]", resp.Posts, want)
+			}
+		})
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+
+			w := serve(r, "GET", "/posts/"+user+"?fields=title,password", "")
+			if w.Code != 400 {
+				t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+			}
+			if n := len(commandsNamed(mt, "find")); n != 0 {
+				t.Errorf("sent %d finds for a rejected projection", n)
+			}
+		})
+	})
+}
+
+func TestParseFields(t *testing.T) {
+	fields, projection, err := parseFields(" title , title,,tags ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"id", "title", "tags"}; !slices.Equal(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+	if len(projection) != 3 || projection["_id"] != 1 || projection["title"] != 1 || projection["tags"] != 1 {
+		t.Errorf("projection = %v", projection)
+	}
+
+	if fields, projection, err := parseFields(""); err != nil || fields != nil || projection != nil {
+		t.Errorf("parseFields(\"\") = %v, %v, %v; want the full document", fields, projection, err)
+	}
+	if _, _, err := parseFields("title,$where"); err == nil {
+		t.Error("accepted a field outside the allowlist")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	const burst = 3
+	limiter := newIPRateLimiter(1, burst)
+	r := gin.New()
+	r.POST("/", limiter.middleware(), func(c *gin.Context) { c.Status(201) })
+
+	var limited int
+	for i := range burst + 2 {
+		w := serve(r, "POST", "/", "")
+		switch {
+		case i < burst && w.Code != 201:
+			t.Errorf("request %d: status = %d, want 201 within the burst", i, w.Code)
+		case i >= burst:
+			if w.Code != 429 {
+				t.Errorf("request %d: status = %d, want 429", i, w.Code)
+				continue
+			}
+			limited++
+			if got := w.Header().Get("Retry-After"); got != "1" {
+				t.Errorf("request %d: Retry-After = %q, want 1", i, got)
+			}
+			if code := errorCode(t, w); code != codeRateLimited {
+				t.Errorf("request %d: code = %q, want %q", i, code, codeRateLimited)
+			}
+		}
+	}
+	if limited != 2 {
+		t.Errorf("limited %d requests, want 2", limited)
+	}
+
+	// Another client has its own bucket.
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, requestFrom("POST", "/", "203.0.113.9", ""))
+	if w.Code != 201 {
+		t.Errorf("other client: status = %d, want 201", w.Code)
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	limiter := newIPRateLimiter(2, 1)
+	now := time.Now()
+
+	if ok, _ := limiter.allow("a", now); !ok {
+		t.Fatal("first request refused")
+	}
+	ok, retryAfter := limiter.allow("a", now)
+	if ok || retryAfter != 500*time.Millisecond {
+		t.Fatalf("second request = %v, %v; want refused for 500ms", ok, retryAfter)
+	}
+	if ok, _ := limiter.allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("request after refill refused")
+	}
+}
+
+func TestRateLimiterEvictsIdle(t *testing.T) {
+	limiter := newIPRateLimiter(1, 1)
+	limiter.allow("old", time.Now().Add(-time.Hour))
+	limiter.allow("fresh", time.Now())
+
+	limiter.evictIdle(10 * time.Minute)
+
+	if _, ok := limiter.buckets["old"]; ok {
+		t.Error("idle bucket was kept")
+	}
+	if _, ok := limiter.buckets["fresh"]; !ok {
+		t.Error("active bucket was evicted")
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	r := gin.New()
+	r.POST("/", newIPRateLimiter(0, 0).middleware(), func(c *gin.Context) { c.Status(201) })
+	for i := range 10 {
+		if w := serve(r, "POST", "/", ""); w.Code != 201 {
+			t.Fatalf("request %d: status = %d, want 201", i, w.Code)
+		}
+	}
+}
+
+// requestFrom builds a request arriving from remoteIP, with xff as its
+// X-Forwarded-For header when set.
+func requestFrom(method, path, remoteIP, xff string) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remoteIP + ":40000"
+	if xff != "" {
+		req.Header.Set("X-Forwarded-For", xff)
+	}
+	return req
+}
+
+func TestRateLimitClientIP(t *testing.T) {
+	// One request per bucket: the first reaches auth (401), a second from the
+	// same client is limited.
+	limitOne := func(proxies ...string) func(*Config) {
+		return func(cfg *Config) {
+			cfg.RateLimitRPS = 0.001
+			cfg.RateLimitBurst = 1
+			cfg.TrustedProxies = proxies
+		}
+	}
+	status := func(r http.Handler, remoteIP, xff string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, requestFrom("POST", "/posts", remoteIP, xff))
+		return w.Code
+	}
+
+	t.Run("spoofed header from an untrusted client", func(t *testing.T) {
+		r := newTestRouter(t, limitOne())
+		if got := status(r, "198.51.100.7", "203.0.113.1"); got != 401 {
+			t.Fatalf("first request = %d, want 401", got)
+		}
+		if got := status(r, "198.51.100.7", "203.0.113.2"); got != 429 {
+			t.Errorf("request with a new X-Forwarded-For = %d, want 429", got)
+		}
+		if got := status(r, "198.51.100.7", ""); got != 429 {
+			t.Errorf("request without X-Forwarded-For = %d, want 429", got)
+		}
+	})
+
+	t.Run("clients behind a trusted proxy", func(t *testing.T) {
+		r := newTestRouter(t, limitOne("10.0.0.5"))
+		if got := status(r, "10.0.0.5", "203.0.113.1"); got != 401 {
+			t.Fatalf("first client = %d, want 401", got)
+		}
+		if got := status(r, "10.0.0.5", "203.0.113.2"); got != 401 {
+			t.Errorf("second client = %d, want 401 from its own bucket", got)
+		}
+		// The proxy appends the real address; what the client put in front
+		// of it does not count.
+		if got := status(r, "10.0.0.5", "192.0.2.99, 203.0.113.1"); got != 429 {
+			t.Errorf("first client with a forged prefix = %d, want 429", got)
+		}
+	})
+}
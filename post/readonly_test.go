@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestReadOnlyMode(t *testing.T) {
+	t.Cleanup(func() { readOnly.Store(false) })
+	const owner = "64b000000000000000000001"
+	postID := primitive.NewObjectID()
+	path := "/posts/" + postID.Hex()
+	admin := bearer(t, "64b0000000000000000000ad", roleAdmin)
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, func(cfg *Config) { cfg.ReadOnly = true })
+
+		for _, tc := range []struct{ method, path, body string }{
+			{"POST", "/posts", `{"title":"Hello","content":"World"}`},
+			{"PUT", path, `{"title":"New","content":"Body","version":1}`},
+			{"DELETE", path, ""},
+		} {
+			w := serve(r, tc.method, tc.path, tc.body, "Authorization", bearer(t, owner, ""))
+			if w.Code != 503 || errorCode(t, w) != codeReadOnly {
+				t.Errorf("%s %s: status = %d, body %s; want 503 %s", tc.method, tc.path, w.Code, w.Body, codeReadOnly)
+			}
+		}
+		if n := len(mt.GetAllStartedEvents()); n != 0 {
+			t.Fatalf("blocked writes sent %d commands", n)
+		}
+
+		post := Post{ID: postID, UserID: owner, Title: "Hello"}
+		mt.AddMockResponses(findResponse(t, post), findResponse(t, post))
+		if w := serve(r, "GET", "/posts/single/"+postID.Hex(), ""); w.Code != 200 {
+			t.Errorf("GET status = %d, want 200: %s", w.Code, w.Body)
+		}
+		if w := serve(r, "POST", "/posts/by-ids", `{"ids":["`+postID.Hex()+`"]}`); w.Code != 200 {
+			t.Errorf("POST /posts/by-ids status = %d, want 200: %s", w.Code, w.Body)
+		}
+
+		if w := serve(r, "PUT", "/admin/read-only", `{"enabled":false}`, "Authorization", bearer(t, owner, "")); w.Code != 403 {
+			t.Errorf("non-admin toggle status = %d, want 403", w.Code)
+		}
+		if w := serve(r, "PUT", "/admin/read-only", `{"enabled":false}`, "Authorization", admin); w.Code != 200 {
+			t.Fatalf("toggle status = %d: %s", w.Code, w.Body)
+		}
+		mt.AddMockResponses(findResponse(t, post), writeResponse(1), writeResponse(1))
+		if w := serve(r, "DELETE", path, "", "Authorization", bearer(t, owner, "")); w.Code != 200 {
+			t.Errorf("DELETE after leaving read-only = %d, want 200: %s", w.Code, w.Body)
+		}
+	})
+}
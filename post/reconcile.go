@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const reconcileBatchSize = 500
+
+var errOrphanCheck = errors.New("cannot check post authors against user-service")
+
+type orphanReport struct {
+	ScannedUsers  int      `json:"scanned_users"`
+	OrphanedUsers []string `json:"orphaned_users"`
+	SkippedUsers  int      `json:"skipped_users"`
+	DeletedCount  int64    `json:"deleted_count"`
+}
+
+func runOrphanReconciler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, bulkRequestTimeout)
+			report, err := reconcileOrphanedPosts(runCtx)
+			cancel()
+			if err != nil {
+				slog.Error("cannot reconcile orphaned posts", "error", err)
+				continue
+			}
+			if report.DeletedCount > 0 {
+				slog.Info("soft-deleted orphaned posts",
+					"users", len(report.OrphanedUsers),
+					"count", report.DeletedCount,
+				)
+			}
+		}
+	}
+}
+
+func reconcileOrphans(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), bulkRequestTimeout)
+	defer cancel()
+
+	report, err := reconcileOrphanedPosts(ctx)
+	if errors.Is(err, errOrphanCheck) {
+		respondUserServiceError(c, err)
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, report)
+}
+
+// reconcileOrphanedPosts soft-deletes live posts whose author no longer
+// exists in the user service. Already deleted posts are skipped, so running
+// it again only picks up new orphans.
+func reconcileOrphanedPosts(ctx context.Context) (orphanReport, error) {
+	report := orphanReport{OrphanedUsers: []string{}}
+
+	values, err := postCollection.Distinct(ctx, "user_id", bson.M{"deleted_at": nil})
+	if err != nil {
+		return report, err
+	}
+
+	userIDs := make([]string, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(string); ok && id != "" {
+			userIDs = append(userIDs, id)
+		}
+	}
+	report.ScannedUsers = len(userIDs)
+
+	for batch := range slices.Chunk(userIDs, reconcileBatchSize) {
+		exists, err := userService.fetchUsersExist(ctx, batch)
+		if err != nil {
+			return report, fmt.Errorf("%w: %w", errOrphanCheck, err)
+		}
+
+		// Only an explicit false counts as gone. If the answer leaves any id
+		// out, the whole batch waits for the next run rather than guessing.
+		var orphaned, unanswered []string
+		for _, id := range batch {
+			found, ok := exists[id]
+			switch {
+			case !ok:
+				unanswered = append(unanswered, id)
+			case !found:
+				orphaned = append(orphaned, id)
+			}
+		}
+		if len(unanswered) > 0 {
+			slog.WarnContext(ctx, "user-service left ids out of its answer, skipping batch",
+				"batch_size", len(batch), "unanswered", len(unanswered))
+			report.SkippedUsers += len(batch)
+			continue
+		}
+		if len(orphaned) == 0 {
+			continue
+		}
+
+		res, err := postCollection.UpdateMany(ctx,
+			bson.M{"user_id": bson.M{"$in": orphaned}, "deleted_at": nil},
+			bson.M{"$set": bson.M{"deleted_at": time.Now().UTC(), "deleted_reason": deletedAsOrphan}},
+		)
+		if err != nil {
+			return report, err
+		}
+		report.OrphanedUsers = append(report.OrphanedUsers, orphaned...)
+		report.DeletedCount += res.ModifiedCount
+		for _, id := range orphaned {
+			userService.cache.set(id, false)
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// existsAnswer serves /users/exists with results, whatever ids are asked for.
+func existsAnswer(t *testing.T, results map[string]bool) {
+	t.Helper()
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"results": results})
+	}))
+}
+
+func distinctResponse(values ...string) bson.D {
+	return bson.D{{Key: "ok", Value: 1}, {Key: "values", Value: values}}
+}
+
+func TestReconcileDeletesOnlyExplicitlyMissingUsers(t *testing.T) {
+	existsAnswer(t, map[string]bool{"alive": true, "gone": false})
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		mt.AddMockResponses(distinctResponse("alive", "gone"), writeResponse(3))
+
+		report, err := reconcileOrphanedPosts(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(report.OrphanedUsers, []string{"gone"}) || report.DeletedCount != 3 {
+			t.Errorf("report = %+v, want gone with 3 posts deleted", report)
+		}
+		if exists, ok := userService.cache.get("gone"); !ok || exists {
+			t.Errorf("cache for gone = %v, %v; want cached as missing", exists, ok)
+		}
+	})
+}
+
+func TestReconcileSkipsIncompleteAnswer(t *testing.T) {
+	// "silent" is left out of the answer entirely; that must not read as
+	// "does not exist".
+	existsAnswer(t, map[string]bool{"gone": false})
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		// No write response is queued: an UpdateMany would fail the run.
+		mt.AddMockResponses(distinctResponse("gone", "silent"))
+
+		report, err := reconcileOrphanedPosts(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.OrphanedUsers) != 0 || report.DeletedCount != 0 {
+			t.Errorf("report = %+v, want nothing deleted", report)
+		}
+		if report.SkippedUsers != 2 {
+			t.Errorf("skipped = %d, want 2", report.SkippedUsers)
+		}
+	})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxReportReasonLength = 500
+
+var reportsCollection *mongo.Collection
+
+type postReport struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PostID    primitive.ObjectID `bson:"post_id" json:"post_id"`
+	Reporter  string             `bson:"reporter" json:"reporter"`
+	Reason    string             `bson:"reason" json:"reason"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// reportPost records one report per user per post. The report that brings a
+// post's report_count to hideThreshold hides it from feeds; later reports do
+// not re-hide a post a moderator has unhidden.
+func reportPost(hideThreshold int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+		defer cancel()
+
+		objID, ok := parseObjectID(c, "postID")
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Reason string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			respondBindError(c, err)
+			return
+		}
+		reason := strings.TrimSpace(sanitizeText(input.Reason))
+		switch {
+		case reason == "":
+			respondFieldErrors(c, map[string]string{"reason": "reason is required"})
+			return
+		case utf8.RuneCountInString(reason) > maxReportReasonLength:
+			respondFieldErrors(c, map[string]string{"reason": fmt.Sprintf("reason must be at most %d characters", maxReportReasonLength)})
+			return
+		}
+
+		var post Post
+		err := postCollection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": nil},
+			options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&post)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			respondError(c, 404, codeNotFound, "post not found")
+			return
+		}
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+
+		report := postReport{
+			ID:        primitive.NewObjectID(),
+			PostID:    objID,
+			Reporter:  c.GetString(authSubjectKey),
+			Reason:    reason,
+			CreatedAt: time.Now().UTC(),
+		}
+		if _, err := reportsCollection.InsertOne(ctx, report); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				respondError(c, 409, codeConflict, "you have already reported this post")
+				return
+			}
+			respondInternalError(c, err)
+			return
+		}
+
+		var updated Post
+		err = postCollection.FindOneAndUpdate(ctx,
+			bson.M{"_id": objID},
+			bson.M{"$inc": bson.M{"report_count": 1}},
+			options.FindOneAndUpdate().
+				SetReturnDocument(options.After).
+				SetProjection(bson.M{"report_count": 1, "hidden": 1}),
+		).Decode(&updated)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+
+		if updated.ReportCount == hideThreshold && !updated.Hidden {
+			if _, err := postCollection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": bson.M{"hidden": true}}); err != nil {
+				respondInternalError(c, err)
+				return
+			}
+			updated.Hidden = true
+			slog.InfoContext(ctx, "post hidden after reports", "post_id", objID.Hex(), "report_count", updated.ReportCount)
+		}
+
+		c.JSON(201, gin.H{
+			"report":       report,
+			"report_count": updated.ReportCount,
+			"hidden":       updated.Hidden,
+		})
+	}
+}
+
+// listReportedPosts is the moderation queue: live posts with at least one
+// report, most reported first.
+func listReportedPosts(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondError(c, 400, codeBadRequest, err.Error())
+		return
+	}
+
+	filter := bson.M{"deleted_at": nil, "report_count": bson.M{"$gt": 0}}
+	total, err := postCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "report_count", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit).
+		SetSkip(offset)
+
+	cursor, err := postCollection.Find(ctx, filter, findOpts)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	posts := []Post{}
+	if err = cursor.All(ctx, &posts); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"posts":  posts,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// moderatePost applies a moderator decision. unhide also clears
+// report_count so the post leaves the queue; the stored reports stay, so the
+// same users cannot report it again.
+func moderatePost(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objID, ok := parseObjectID(c, "postID")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Action string `json:"action" binding:"required,oneof=hide unhide delete"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	var update bson.M
+	switch input.Action {
+	case "hide":
+		update = bson.M{"$set": bson.M{"hidden": true}}
+	case "unhide":
+		update = bson.M{"$unset": bson.M{"hidden": "", "report_count": ""}}
+	case "delete":
+		update = bson.M{"$set": bson.M{"deleted_at": time.Now().UTC(), "deleted_reason": deletedByModeration}}
+	}
+
+	var before Post
+	err := postCollection.FindOneAndUpdate(ctx, bson.M{"_id": objID, "deleted_at": nil}, update).Decode(&before)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondError(c, 404, codeNotFound, "post not found")
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	recordHistory(ctx, c, "moderate_"+input.Action, before)
+
+	c.JSON(200, gin.H{
+		"post_id": objID,
+		"action":  input.Action,
+	})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestReportPost(t *testing.T) {
+	const reporter = "64b000000000000000000002"
+	postID := primitive.NewObjectID()
+	path := "/posts/" + postID.Hex() + "/report"
+	token := bearer(t, reporter, "")
+	threshold := func(cfg *Config) { cfg.ReportHideThreshold = 3 }
+
+	// report sends one report, answering the count increment with count,
+	// and returns the response body.
+	report := func(t *testing.T, mt *mtest.T, count int) (code int, body struct {
+		ReportCount int  `json:"report_count"`
+		Hidden      bool `json:"hidden"`
+	}) {
+		t.Helper()
+		mt.AddMockResponses(
+			findResponse(t, Post{ID: postID}),
+			writeResponse(1),
+			findAndModifyResponse(t, Post{ID: postID, ReportCount: count}),
+			writeResponse(1),
+		)
+		w := serve(newTestRouter(t, threshold), "POST", path, `{"reason":"spam"}`, "Authorization", token)
+		if w.Code == 201 {
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, body
+	}
+
+	t.Run("records the report and counts it", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			code, body := report(t, mt, 1)
+			if code != 201 || body.ReportCount != 1 || body.Hidden {
+				t.Fatalf("status = %d, body = %+v; want 201 with one report, visible", code, body)
+			}
+			doc := startedCommand(t, mt, "insert").Lookup("documents", "0").Document()
+			if got := doc.Lookup("post_id").ObjectID(); got != postID {
+				t.Errorf("report post_id = %s, want %s", got.Hex(), postID.Hex())
+			}
+			if got := doc.Lookup("reporter").StringValue(); got != reporter {
+				t.Errorf("reporter = %q, want the caller %q", got, reporter)
+			}
+			inc := startedCommand(t, mt, "findAndModify").Lookup("update", "$inc", "report_count").Int32()
+			if inc != 1 {
+				t.Errorf("$inc report_count = %d, want 1", inc)
+			}
+			if n := len(commandsNamed(mt, "update")); n != 0 {
+				t.Errorf("sent %d updates below the threshold, want none", n)
+			}
+		})
+	})
+
+	t.Run("duplicate report is counted once", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			mt.AddMockResponses(
+				findResponse(t, Post{ID: postID}),
+				mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "duplicate key"}),
+			)
+			w := serve(newTestRouter(t, threshold), "POST", path, `{"reason":"spam again"}`, "Authorization", token)
+			if w.Code != 409 {
+				t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+			}
+			if n := len(commandsNamed(mt, "findAndModify")); n != 0 {
+				t.Errorf("incremented report_count %d times for a duplicate report", n)
+			}
+		})
+	})
+
+	t.Run("report at the threshold hides the post", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			code, body := report(t, mt, 3)
+			if code != 201 || body.ReportCount != 3 || !body.Hidden {
+				t.Fatalf("status = %d, body = %+v; want 201 and hidden", code, body)
+			}
+			update := startedCommand(t, mt, "update").Lookup("updates", "0").Document()
+			if got := update.Lookup("q", "_id").ObjectID(); got != postID {
+				t.Errorf("hid post %s, want %s", got.Hex(), postID.Hex())
+			}
+			if !update.Lookup("u", "$set", "hidden").Boolean() {
+				t.Errorf("update %s does not set hidden", update)
+			}
+		})
+	})
+
+	t.Run("reports past the threshold do not re-hide", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			code, body := report(t, mt, 4)
+			if code != 201 || body.Hidden {
+				t.Fatalf("status = %d, body = %+v; want 201, left visible", code, body)
+			}
+			if n := len(commandsNamed(mt, "update")); n != 0 {
+				t.Errorf("sent %d updates past the threshold, want none", n)
+			}
+		})
+	})
+
+	t.Run("unknown post", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			mt.AddMockResponses(findResponse(t))
+			w := serve(newTestRouter(t, threshold), "POST", path, `{"reason":"spam"}`, "Authorization", token)
+			if w.Code != 404 {
+				t.Errorf("status = %d, want 404", w.Code)
+			}
+			if n := len(commandsNamed(mt, "insert")); n != 0 {
+				t.Errorf("stored %d reports for a missing post", n)
+			}
+		})
+	})
+}
+
+func TestListReportedPosts(t *testing.T) {
+	admin := bearer(t, "64b0000000000000000000ad", roleAdmin)
+	reported := []any{
+		Post{ID: primitive.NewObjectID(), Title: "Worst", ReportCount: 7},
+		Post{ID: primitive.NewObjectID(), Title: "Bad", ReportCount: 2},
+	}
+
+	t.Run("most reported first", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			mt.AddMockResponses(countResponse(2), findResponse(t, reported...))
+
+			w := serve(newTestRouter(t, nil), "GET", "/admin/reports?limit=10", "", "Authorization", admin)
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var body struct {
+				Posts []Post `json:"posts"`
+				Total int64  `json:"total"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Total != 2 || len(body.Posts) != 2 || body.Posts[0].Title != "Worst" {
+				t.Errorf("body = %s", w.Body)
+			}
+
+			find := startedCommand(t, mt, "find")
+			filter := find.Lookup("filter").Document()
+			if v, err := filter.LookupErr("deleted_at"); err != nil || v.Type != bson.TypeNull {
+				t.Errorf("filter %s, want only live posts", filter)
+			}
+			if got := filter.Lookup("report_count", "$gt").Int32(); got != 0 {
+				t.Errorf("filter %s, want report_count > 0", filter)
+			}
+			if sort := find.Lookup("sort").Document().String(); sort != `{"report_count": {"$numberInt":"-1"},"_id": {"$numberInt":"-1"}}` {
+				t.Errorf("sort = %s, want most reported first", sort)
+			}
+		})
+	})
+
+	t.Run("admins only", func(t *testing.T) {
+		w := serve(newTestRouter(t, nil), "GET", "/admin/reports", "", "Authorization", bearer(t, "64b000000000000000000001", ""))
+		if w.Code != 403 {
+			t.Errorf("status = %d, want 403", w.Code)
+		}
+	})
+}
+
+func TestModeratePost(t *testing.T) {
+	const owner = "64b000000000000000000001"
+	admin := bearer(t, "64b0000000000000000000ad", roleAdmin)
+	postID := primitive.NewObjectID()
+	path := "/admin/posts/" + postID.Hex() + "/moderate"
+	before := Post{ID: postID, UserID: owner, Title: "Reported", ReportCount: 5, Hidden: true}
+
+	// moderate applies action as an admin and returns the update it sent.
+	moderate := func(t *testing.T, mt *mtest.T, action string) bson.Raw {
+		t.Helper()
+		mt.AddMockResponses(findAndModifyResponse(t, before), writeResponse(1))
+		w := serve(newTestRouter(t, nil), "POST", path, `{"action":"`+action+`"}`, "Authorization", admin)
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		cmd := startedCommand(t, mt, "findAndModify")
+		if got := cmd.Lookup("query", "_id").ObjectID(); got != postID {
+			t.Errorf("moderated post %s, want %s", got.Hex(), postID.Hex())
+		}
+		entry := startedCommand(t, mt, "insert").Lookup("documents", "0").Document()
+		if got := entry.Lookup("action").StringValue(); got != "moderate_"+action {
+			t.Errorf("history action = %q, want %q", got, "moderate_"+action)
+		}
+		return cmd.Lookup("update").Document()
+	}
+
+	t.Run("hide", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			if update := moderate(t, mt, "hide"); !update.Lookup("$set", "hidden").Boolean() {
+				t.Errorf("update = %s, want hidden set", update)
+			}
+		})
+	})
+
+	t.Run("unhide clears the queue entry", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			update := moderate(t, mt, "unhide")
+			for _, field := range []string{"hidden", "report_count"} {
+				if _, err := update.LookupErr("$unset", field); err != nil {
+					t.Errorf("update = %s, want %s unset", update, field)
+				}
+			}
+		})
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			update := moderate(t, mt, "delete")
+			if got := update.Lookup("$set", "deleted_reason").StringValue(); got != deletedByModeration {
+				t.Errorf("deleted_reason = %q, want %q", got, deletedByModeration)
+			}
+			if _, err := update.LookupErr("$set", "deleted_at"); err != nil {
+				t.Errorf("update = %s, want a soft delete", update)
+			}
+		})
+	})
+
+	t.Run("unknown action", func(t *testing.T) {
+		w := serve(newTestRouter(t, nil), "POST", path, `{"action":"ban"}`, "Authorization", admin)
+		if w.Code != 400 {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("unknown post", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			mt.AddMockResponses(findAndModifyResponse(t, nil))
+			w := serve(newTestRouter(t, nil), "POST", path, `{"action":"hide"}`, "Authorization", admin)
+			if w.Code != 404 {
+				t.Errorf("status = %d, want 404", w.Code)
+			}
+		})
+	})
+
+	t.Run("admins only", func(t *testing.T) {
+		w := serve(newTestRouter(t, nil), "POST", path, `{"action":"hide"}`, "Authorization", bearer(t, owner, ""))
+		if w.Code != 403 {
+			t.Errorf("status = %d, want 403", w.Code)
+		}
+	})
+}
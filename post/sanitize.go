@@ -0,0 +1,71 @@
+package main
+
+import (
+	"html"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+const (
+	contentPolicyStrict = "strict"
+	contentPolicyBasic  = "basic"
+)
+
+var (
+	plainTextPolicy = bluemonday.StrictPolicy()
+	contentPolicy   = bluemonday.StrictPolicy()
+
+	// contentAllowsHTML is set when contentPolicy keeps formatting tags, so
+	// content is stored as HTML rather than plain text.
+	contentAllowsHTML bool
+)
+
+// maxSanitizePasses bounds how many times stripToText decodes and re-strips
+// its input before giving up on finding plain text.
+const maxSanitizePasses = 4
+
+// sanitizeText strips all markup and stores plain text: "Tom & Jerry" rather
+// than "Tom &amp; Jerry".
+func sanitizeText(s string) string {
+	return stripToText(plainTextPolicy, s)
+}
+
+// sanitizeContent applies contentPolicy. Under the basic policy content is
+// HTML and its entities must stay escaped; otherwise it is plain text like
+// sanitizeText.
+func sanitizeContent(s string) string {
+	if contentAllowsHTML {
+		return contentPolicy.Sanitize(s)
+	}
+	return stripToText(contentPolicy, s)
+}
+
+// stripToText sanitizes s with a policy that keeps no tags and decodes the
+// entities it escaped. Decoding can turn entity-encoded markup such as
+// "&lt;script&gt;" into live tags, so the result is sanitized again until it
+// no longer changes. Input that is still changing after maxSanitizePasses is
+// stored escaped, which is always safe to render.
+func stripToText(p *bluemonday.Policy, s string) string {
+	for range maxSanitizePasses {
+		escaped := p.Sanitize(s)
+		decoded := html.UnescapeString(escaped)
+		if decoded == s {
+			return decoded
+		}
+		s = decoded
+	}
+	return p.Sanitize(s)
+}
+
+func newContentPolicy(name string) *bluemonday.Policy {
+	if name != contentPolicyBasic {
+		return bluemonday.StrictPolicy()
+	}
+
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "b", "strong", "i", "em", "u", "blockquote", "code", "pre", "ul", "ol", "li")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowStandardURLs()
+	p.RequireNoFollowOnLinks(true)
+	return p
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeTextKeepsPlainText(t *testing.T) {
+	tests := map[string]string{
+		`Tom & Jerry <3 'q'`:                  `Tom & Jerry <3 'q'`,
+		`<script>alert(1)</script>hello`:      `hello`,
+		`<b onclick="steal()">bold</b> "quo"`: `bold "quo"`,
+	}
+	for in, want := range tests {
+		if got := sanitizeText(in); got != want {
+			t.Errorf("sanitizeText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSanitizeContentPolicies(t *testing.T) {
+	savedPolicy, savedAllows := contentPolicy, contentAllowsHTML
+	defer func() { contentPolicy, contentAllowsHTML = savedPolicy, savedAllows }()
+
+	const in = `<p onmouseover="steal()">Fish &amp; chips</p><script>alert(1)</script>`
+
+	contentPolicy, contentAllowsHTML = newContentPolicy(contentPolicyStrict), false
+	if got, want := sanitizeContent(in), "Fish & chips"; got != want {
+		t.Errorf("strict: got %q, want %q", got, want)
+	}
+
+	contentPolicy, contentAllowsHTML = newContentPolicy(contentPolicyBasic), true
+	got := sanitizeContent(in)
+	if got != "<p>Fish &amp; chips</p>" {
+		t.Errorf("basic: got %q", got)
+	}
+	if strings.Contains(got, "script") || strings.Contains(got, "onmouseover") {
+		t.Errorf("basic: script or handler survived: %q", got)
+	}
+}
+
+func TestValidatePostCountsDecodedCharacters(t *testing.T) {
+	post := Post{UserID: "64b000000000000000000001", Title: strings.Repeat("&", maxTitleLength), Content: "x"}
+	if errs := validatePost(&post); len(errs) != 0 {
+		t.Errorf("validatePost: %v", errs)
+	}
+	if post.Title != strings.Repeat("&", maxTitleLength) {
+		t.Errorf("title stored as %q", post.Title[:20])
+	}
+}
+
+func TestSanitizeEntityEncodedMarkup(t *testing.T) {
+	savedPolicy, savedAllows := contentPolicy, contentAllowsHTML
+	defer func() { contentPolicy, contentAllowsHTML = savedPolicy, savedAllows }()
+
+	payloads := []string{
+		`&lt;script&gt;alert(1)&lt;/script&gt;`,
+		`&lt;img src=x onerror=alert(1)&gt;`,
+		`&amp;lt;script&amp;gt;alert(1)&amp;lt;/script&amp;gt;`,
+		`hi &lt;b onclick=alert(1)&gt;there&lt;/b&gt;`,
+	}
+	// Plain text must hold no markup at all; HTML content may keep allowed
+	// tags but nothing the payloads tried to smuggle in.
+	plain := func(s string) bool { return !strings.ContainsAny(s, "<>") }
+	safeHTML := func(s string) bool {
+		return !strings.Contains(s, "<script") && !strings.Contains(s, "<img") && !strings.Contains(s, "<b onclick")
+	}
+
+	for _, policy := range []string{contentPolicyStrict, contentPolicyBasic} {
+		contentPolicy, contentAllowsHTML = newContentPolicy(policy), policy == contentPolicyBasic
+		for _, payload := range payloads {
+			post := Post{UserID: "64b000000000000000000001", Title: "t " + payload, Content: "c " + payload}
+			validatePost(&post)
+			if !plain(post.Title) {
+				t.Errorf("%s: title %q from %q keeps markup", policy, post.Title, payload)
+			}
+			if ok := safeHTML(post.Content); !ok || (!contentAllowsHTML && !plain(post.Content)) {
+				t.Errorf("%s: content %q from %q keeps markup", policy, post.Content, payload)
+			}
+
+			tags, err := normalizeTags([]string{"g " + payload})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, tag := range tags {
+				if !plain(tag) {
+					t.Errorf("%s: tag %q from %q keeps markup", policy, tag, payload)
+				}
+			}
+		}
+	}
+}
+
+func TestSanitizeTextDecodesOnlyText(t *testing.T) {
+	tests := map[string]string{
+		`a &lt; b`:                   `a < b`,
+		`&lt;b&gt;bold&lt;/b&gt;`:    `bold`,
+		`&lt;3 &amp; &quot;hi&quot;`: `<3 & "hi"`,
+	}
+	for in, want := range tests {
+		if got := sanitizeText(in); got != want {
+			t.Errorf("sanitizeText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// visibleFilter matches posts that are live: not deleted, not hidden by
+// reports and not waiting on a future publish_at. Posts written before
+// scheduling existed have no published field and count as published.
+func visibleFilter() bson.M {
+	return bson.M{"deleted_at": nil, "hidden": bson.M{"$ne": true}, "published": bson.M{"$ne": false}}
+}
+
+// visibleTo reports whether the caller may read post by ID or slug. Posts
+// visibleFilter would skip, scheduled or hidden, are shown only to their
+// author or an admin.
+func visibleTo(c *gin.Context, post Post) bool {
+	scheduled := !post.Published && post.PublishAt != nil
+	return !(post.Hidden || scheduled) || isSelfOrAdmin(c, post.UserID)
+}
+
+func schedulePost(post *Post, now time.Time) {
+	if post.PublishAt == nil || !post.PublishAt.After(now) {
+		post.PublishAt = nil
+		post.Published = true
+		return
+	}
+	publishAt := post.PublishAt.UTC().Truncate(time.Millisecond)
+	post.PublishAt = &publishAt
+	post.Published = false
+}
+
+func runScheduledPublisher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			publishDuePosts(ctx)
+		}
+	}
+}
+
+func publishDuePosts(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	res, err := postCollection.UpdateMany(ctx,
+		bson.M{"published": false, "publish_at": bson.M{"$lte": time.Now().UTC()}},
+		bson.M{"$set": bson.M{"published": true}},
+	)
+	if err != nil {
+		slog.Error("cannot publish scheduled posts", "error", err)
+		return
+	}
+	if res.ModifiedCount > 0 {
+		slog.Info("published scheduled posts", "count", res.ModifiedCount)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestScheduledPostHiddenUntilPublished(t *testing.T) {
+	const author = "64b000000000000000000001"
+	postID := primitive.NewObjectID()
+	publishAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+	scheduled := Post{ID: postID, UserID: author, Title: "Soon", Slug: "soon", PublishAt: &publishAt}
+	published := scheduled
+	published.Published = true
+
+	for _, path := range []string{"/posts/single/" + postID.Hex(), "/posts/slug/soon"} {
+		t.Run(path, func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				r := newTestRouter(t, nil)
+				mt.AddMockResponses(findResponse(t, scheduled), findResponse(t, scheduled), findResponse(t, scheduled))
+
+				if w := serve(r, "GET", path, ""); w.Code != 404 {
+					t.Errorf("anonymous status before publish_at = %d, want 404", w.Code)
+				}
+				if w := serve(r, "GET", path, "", "Authorization", bearer(t, "64b000000000000000000002", "")); w.Code != 404 {
+					t.Errorf("other user status before publish_at = %d, want 404", w.Code)
+				}
+				if w := serve(r, "GET", path, "", "Authorization", bearer(t, author, "")); w.Code != 200 {
+					t.Errorf("author status before publish_at = %d, want 200", w.Code)
+				}
+
+				mt.AddMockResponses(writeResponse(1))
+				publishDuePosts(context.Background())
+				filter := startedCommand(t, mt, "update").Lookup("updates", "0", "q").Document()
+				if filter.Lookup("published").Boolean() {
+					t.Errorf("publisher filter %s does not select unpublished posts", filter)
+				}
+				if due := filter.Lookup("publish_at", "$lte").Time(); time.Since(due) > time.Second {
+					t.Errorf("publisher cutoff = %v, want now", due)
+				}
+
+				mt.AddMockResponses(findResponse(t, published))
+				if w := serve(r, "GET", path, ""); w.Code != 200 {
+					t.Errorf("anonymous status after publishing = %d, want 200", w.Code)
+				}
+			})
+		})
+	}
+}
+
+func TestHiddenPostVisibleOnlyToAuthorAndAdmin(t *testing.T) {
+	const author = "64b000000000000000000001"
+	postID := primitive.NewObjectID()
+	hidden := Post{ID: postID, UserID: author, Title: "Reported", Published: true, Hidden: true}
+
+	for _, tc := range []struct {
+		name, token string
+		want        int
+	}{
+		{"anonymous", "", 404},
+		{"other user", bearer(t, "64b000000000000000000002", ""), 404},
+		{"author", bearer(t, author, ""), 200},
+		{"admin", bearer(t, "64b0000000000000000000ad", roleAdmin), 200},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				r := newTestRouter(t, nil)
+				mt.AddMockResponses(findResponse(t, hidden))
+
+				var header []string
+				if tc.token != "" {
+					header = []string{"Authorization", tc.token}
+				}
+				if w := serve(r, "GET", "/posts/single/"+postID.Hex(), "", header...); w.Code != tc.want {
+					t.Errorf("status = %d, want %d", w.Code, tc.want)
+				}
+			})
+		})
+	}
+}
+
+func TestGetPostsByUserIDSkipsScheduled(t *testing.T) {
+	const author = "64b000000000000000000001"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"exists":true}`))
+	}))
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(countResponse(0), findResponse(t))
+
+		if w := serve(r, "GET", "/posts/"+author, ""); w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		published := startedCommand(t, mt, "find").Lookup("filter", "published", "$ne")
+		if published.Type.String() != "boolean" || published.Boolean() {
+			t.Errorf("feed filter published = %s, want {$ne: false}", published)
+		}
+	})
+}
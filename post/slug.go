@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/text/unicode/norm"
+)
+
+const maxSlugLength = 80
+
+func slugify(title string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range norm.NFD.String(strings.ToLower(html.UnescapeString(title))) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case r == 'đ':
+			r = 'd'
+		}
+
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+			continue
+		}
+		hyphen = true
+	}
+
+	slug := b.String()
+	if len(slug) > maxSlugLength {
+		slug = slug[:maxSlugLength]
+		if i := strings.LastIndexByte(slug, '-'); i > 0 {
+			slug = slug[:i]
+		}
+	}
+	if slug == "" {
+		return "post"
+	}
+	return slug
+}
+
+// allocateSlugs returns a slug for each title that is unused both in the
+// collection and within titles, appending -2, -3, ... on collision.
+func allocateSlugs(ctx context.Context, titles []string) ([]string, error) {
+	bases := make([]string, len(titles))
+	used := map[string]bool{}
+	queried := map[string]bool{}
+	for i, title := range titles {
+		bases[i] = slugify(title)
+		if queried[bases[i]] {
+			continue
+		}
+		queried[bases[i]] = true
+
+		pattern := "^" + regexp.QuoteMeta(bases[i]) + "(-[0-9]+)?$"
+		cursor, err := postCollection.Find(ctx, bson.M{"slug": bson.M{"$regex": pattern}},
+			options.Find().SetProjection(bson.M{"slug": 1}))
+		if err != nil {
+			return nil, err
+		}
+
+		var existing []struct {
+			Slug string `bson:"slug"`
+		}
+		if err := cursor.All(ctx, &existing); err != nil {
+			return nil, err
+		}
+		for _, e := range existing {
+			used[e.Slug] = true
+		}
+	}
+
+	slugs := make([]string, len(titles))
+	for i, base := range bases {
+		slug := base
+		for n := 2; used[slug]; n++ {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		used[slug] = true
+		slugs[i] = slug
+	}
+	return slugs, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSlugify(t *testing.T) {
+	for _, tc := range []struct{ title, want string }{
+		{"Hello, World!", "hello-world"},
+		{"  Multiple   spaces  ", "multiple-spaces"},
+		{"Crème brûlée", "creme-brulee"},
+		{"Đường phố Hà Nội", "duong-pho-ha-noi"},
+		{"Tom &amp; Jerry", "tom-jerry"},
+		{"Go 1.25 released", "go-1-25-released"},
+		{"!!!", "post"},
+		{"日本語", "post"},
+	} {
+		if got := slugify(tc.title); got != tc.want {
+			t.Errorf("slugify(%q) = %q, want %q", tc.title, got, tc.want)
+		}
+	}
+}
+
+func TestSlugifyTruncatesOnWordBoundary(t *testing.T) {
+	got := slugify(strings.Repeat("word ", 30))
+	if len(got) > maxSlugLength {
+		t.Errorf("len = %d, want at most %d", len(got), maxSlugLength)
+	}
+	if strings.HasSuffix(got, "-") || !strings.HasSuffix(got, "word") {
+		t.Errorf("slug %q was cut mid-word", got)
+	}
+}
+
+func TestAllocateSlugs(t *testing.T) {
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		type slugDoc struct {
+			Slug string `bson:"slug"`
+		}
+		// "hello" and "hello-2" are taken; "other" is free. The second
+		// "Hello" reuses the first lookup.
+		mt.AddMockResponses(
+			findResponse(t, slugDoc{"hello"}, slugDoc{"hello-2"}),
+			findResponse(t),
+		)
+
+		got, err := allocateSlugs(t.Context(), []string{"Hello", "Other", "hello!"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"hello-3", "other", "hello-4"}; !slices.Equal(got, want) {
+			t.Errorf("slugs = %v, want %v", got, want)
+		}
+		if n := len(mt.GetAllStartedEvents()); n != 2 {
+			t.Errorf("sent %d queries, want one per distinct slug", n)
+		}
+	})
+}
+
+func TestGetPostBySlug(t *testing.T) {
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(findResponse(t, Post{Slug: "hello-world", Title: "Hello, World!"}))
+
+		w := serve(r, "GET", "/posts/slug/hello-world", "")
+		if w.Code != 200 || !strings.Contains(w.Body.String(), `"slug":"hello-world"`) {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if got := startedCommand(t, mt, "find").Lookup("filter", "slug").StringValue(); got != "hello-world" {
+			t.Errorf("filter slug = %q", got)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t))
+
+			if w := serve(r, "GET", "/posts/slug/nope", ""); w.Code != 404 {
+				t.Errorf("status = %d, want 404", w.Code)
+			}
+		})
+	})
+}
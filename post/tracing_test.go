@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceContextPropagatesToUserService(t *testing.T) {
+	if _, err := setupTracing(context.Background(), "post-service", ""); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	// The caller's trace, as nginx or a client would send it.
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	wantTrace := "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	var upstream trace.SpanContext
+	var header string
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("traceparent")
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		upstream = trace.SpanContextFromContext(ctx)
+		w.Write([]byte(`{"exists":true}`))
+	}))
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(countResponse(0), findResponse(t))
+
+		userID := primitive.NewObjectID().Hex()
+		if w := serve(r, "GET", "/posts/"+userID, "", "traceparent", incoming); w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+	})
+
+	if header == "" {
+		t.Fatal("user service call carried no traceparent header")
+	}
+	if got := upstream.TraceID().String(); got != wantTrace {
+		t.Errorf("user service saw trace %s, want the caller's %s", got, wantTrace)
+	}
+
+	// The header names the outgoing client span, which must hang off the
+	// post service's server span for this request.
+	spans := map[trace.SpanID]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.SpanContext().SpanID()] = s
+	}
+	client, ok := spans[upstream.SpanID()]
+	if !ok {
+		t.Fatalf("traceparent %s names no recorded span", header)
+	}
+	if client.SpanKind() != trace.SpanKindClient {
+		t.Errorf("propagated span kind = %v, want client", client.SpanKind())
+	}
+	server, ok := spans[client.Parent().SpanID()]
+	if !ok || server.SpanKind() != trace.SpanKindServer {
+		t.Fatalf("client span's parent is not the request's server span")
+	}
+	if got := server.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("server span parent = %s, want the incoming span", got)
+	}
+}
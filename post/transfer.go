@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// transferPost reassigns a post to another existing user, copying that user's
+// current name onto it. The previous owner is kept in the history snapshot.
+func transferPost(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objID, ok := parseObjectID(c, "postID")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		NewUserID string `json:"new_user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	newUserID, err := normalizeUserID(input.NewUserID)
+	if err != nil {
+		respondFieldErrors(c, map[string]string{"new_user_id": "new_user_id must be a 24-character hex ObjectID"})
+		return
+	}
+
+	userName, exists, err := userService.lookupUserName(ctx, newUserID)
+	if err != nil {
+		respondUserServiceError(c, err)
+		return
+	}
+	if !exists {
+		respondError(c, 404, codeNotFound, "user does not exist")
+		return
+	}
+
+	set := bson.M{"user_id": newUserID, "updated_at": time.Now().UTC().Truncate(time.Millisecond)}
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if userName != "" {
+		set["user_name"] = userName
+	} else {
+		update["$unset"] = bson.M{"user_name": ""}
+	}
+
+	var before Post
+	err = postCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": objID, "deleted_at": nil, "user_id": bson.M{"$ne": newUserID}},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&before)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondTransferMiss(ctx, c, objID)
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	recordHistory(ctx, c, "transfer", before)
+
+	c.JSON(200, gin.H{
+		"post_id":      objID,
+		"from_user_id": before.UserID,
+		"to_user_id":   newUserID,
+		"to_user_name": userName,
+	})
+}
+
+// respondTransferMiss tells a missing post apart from one the target user
+// already owns.
+func respondTransferMiss(ctx context.Context, c *gin.Context, objID primitive.ObjectID) {
+	count, err := postCollection.CountDocuments(ctx, bson.M{"_id": objID, "deleted_at": nil}, options.Count().SetLimit(1))
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if count == 0 {
+		respondError(c, 404, codeNotFound, "post not found")
+		return
+	}
+	respondError(c, 409, codeConflict, "post already belongs to this user")
+}
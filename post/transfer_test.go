@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestTransferPost(t *testing.T) {
+	const alice, bob = "64b000000000000000000001", "64b000000000000000000002"
+	// Only bob exists in the user service.
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users/"+bob {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"name":"Bob"}`))
+	}))
+	admin := bearer(t, "64b0000000000000000000ad", roleAdmin)
+	postID := primitive.NewObjectID()
+	path := "/posts/" + postID.Hex() + "/transfer"
+	before := Post{ID: postID, UserID: alice, UserName: "Alice", Title: "Mine", Version: 2}
+
+	t.Run("moves the post to the new owner", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			mt.AddMockResponses(findAndModifyResponse(t, before), writeResponse(1))
+
+			w := serve(newTestRouter(t, nil), "POST", path, `{"new_user_id":"`+bob+`"}`, "Authorization", admin)
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var body struct {
+				From string `json:"from_user_id"`
+				To   string `json:"to_user_id"`
+				Name string `json:"to_user_name"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.From != alice || body.To != bob || body.Name != "Bob" {
+				t.Errorf("body = %s, want alice to Bob", w.Body)
+			}
+
+			cmd := startedCommand(t, mt, "findAndModify")
+			if got := cmd.Lookup("query", "user_id", "$ne").StringValue(); got != bob {
+				t.Errorf("query = %s, want posts bob does not already own", cmd.Lookup("query"))
+			}
+			set := cmd.Lookup("update", "$set").Document()
+			if set.Lookup("user_id").StringValue() != bob || set.Lookup("user_name").StringValue() != "Bob" {
+				t.Errorf("$set = %s, want bob's ID and name", set)
+			}
+			if inc := cmd.Lookup("update", "$inc", "version").Int32(); inc != 1 {
+				t.Errorf("$inc version = %d, want 1", inc)
+			}
+
+			entry := startedCommand(t, mt, "insert").Lookup("documents", "0").Document()
+			if got := entry.Lookup("action").StringValue(); got != "transfer" {
+				t.Errorf("history action = %q, want transfer", got)
+			}
+			if got := entry.Lookup("snapshot", "user_id").StringValue(); got != alice {
+				t.Errorf("history snapshot owner = %q, want the previous owner", got)
+			}
+		})
+	})
+
+	t.Run("target user must exist", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			w := serve(newTestRouter(t, nil), "POST", path, `{"new_user_id":"64b000000000000000000009"}`, "Authorization", admin)
+			if w.Code != 404 || errorCode(t, w) != codeNotFound {
+				t.Errorf("status = %d %s, want 404", w.Code, w.Body)
+			}
+			if got := commandNames(mt); len(got) != 0 {
+				t.Errorf("commands = %v, want none", got)
+			}
+		})
+	})
+
+	t.Run("malformed target", func(t *testing.T) {
+		w := serve(newTestRouter(t, nil), "POST", path, `{"new_user_id":"bob"}`, "Authorization", admin)
+		if w.Code != 400 || errorCode(t, w) != codeValidation {
+			t.Errorf("status = %d %s, want 400 validation_failed", w.Code, w.Body)
+		}
+	})
+
+	for _, tc := range []struct {
+		name  string
+		count int
+		code  int
+	}{
+		{"missing post", 0, 404},
+		{"already owned", 1, 409},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				mt.AddMockResponses(findAndModifyResponse(t, nil), countResponse(tc.count))
+				w := serve(newTestRouter(t, nil), "POST", path, `{"new_user_id":"`+bob+`"}`, "Authorization", admin)
+				if w.Code != tc.code {
+					t.Errorf("status = %d %s, want %d", w.Code, w.Body, tc.code)
+				}
+				if n := len(commandsNamed(mt, "insert")); n != 0 {
+					t.Errorf("wrote %d history entries for a failed transfer", n)
+				}
+			})
+		})
+	}
+
+	t.Run("admins only", func(t *testing.T) {
+		w := serve(newTestRouter(t, nil), "POST", path, `{"new_user_id":"`+bob+`"}`, "Authorization", bearer(t, alice, ""))
+		if w.Code != 403 {
+			t.Errorf("status = %d, want 403", w.Code)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// authorNames looks up display names for the existing users among userIDs in
+// a single user-service call. A failure is logged and leaves the names out;
+// the posts are still written and refreshUserName can fill them in later.
+func authorNames(ctx context.Context, userIDs []string, exists map[string]bool) map[string]string {
+	var ids []string
+	for _, id := range userIDs {
+		if exists[id] {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return map[string]string{}
+	}
+
+	names, err := userService.lookupUserNames(ctx, ids)
+	if err != nil {
+		slog.WarnContext(ctx, "cannot look up author names", "count", len(ids), "error", err)
+		return map[string]string{}
+	}
+	return names
+}
+
+// refreshUserName rewrites the user_name copied onto a user's posts with the
+// user service's current value. The user service calls it after a rename.
+func refreshUserName(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	userID, err := normalizeUserID(c.Param("userID"))
+	if err != nil {
+		respondError(c, 400, codeInvalidID, err.Error())
+		return
+	}
+	if !isSelfOrAdmin(c, userID) {
+		respondError(c, 403, codeForbidden, "only the user or an admin can refresh these posts")
+		return
+	}
+
+	userService.names.delete(userID)
+	name, found, err := userService.lookupUserName(ctx, userID)
+	if err != nil {
+		respondUserServiceError(c, err)
+		return
+	}
+	if !found {
+		respondError(c, 404, codeNotFound, "user does not exist")
+		return
+	}
+
+	res, err := postCollection.UpdateMany(ctx,
+		bson.M{"user_id": userID, "user_name": bson.M{"$ne": name}},
+		bson.M{"$set": bson.M{"user_name": name}},
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"user_id":        userID,
+		"user_name":      name,
+		"modified_count": res.ModifiedCount,
+	})
+}
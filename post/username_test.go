@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAuthorNamesMakesOneCall(t *testing.T) {
+	var calls atomic.Int32
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Method != "POST" || r.URL.Path != "/users/names" {
+			t.Errorf("unexpected call %s %s", r.Method, r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"names": map[string]string{"a": "Alice", "b": "Bob"}})
+	}))
+
+	ids := []string{"a", "b", "c", "d"}
+	exists := map[string]bool{"a": true, "b": true, "c": true}
+	names := authorNames(t.Context(), ids, exists)
+
+	if calls.Load() != 1 {
+		t.Errorf("user-service calls = %d, want 1", calls.Load())
+	}
+	if len(names) != 2 || names["a"] != "Alice" || names["b"] != "Bob" {
+		t.Errorf("names = %v", names)
+	}
+
+	// Everything found is now cached, so asking again stays local.
+	authorNames(t.Context(), []string{"a", "b"}, exists)
+	if calls.Load() != 1 {
+		t.Errorf("user-service calls after cached lookup = %d, want 1", calls.Load())
+	}
+}
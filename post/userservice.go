@@ -0,0 +1,528 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// userNamesBatchSize matches the user service's cap on POST /users/names.
+const userNamesBatchSize = 500
+
+var (
+	errUserServiceTimeout = errors.New("user-service request timed out")
+	errDecodeUserService  = errors.New("cannot decode user-service response")
+)
+
+var userService *userServiceClient
+
+type userServiceClient struct {
+	baseURL  string
+	http     *http.Client
+	cache    *userExistsCache
+	names    *ttlCache[string]
+	nameTTL  time.Duration
+	breaker  *circuitBreaker
+	attempts int
+	backoff  time.Duration
+}
+
+func newUserServiceClient(cfg Config, cache *userExistsCache) *userServiceClient {
+	// Every call goes to the same host, so keep enough idle connections for
+	// it instead of the default two per host.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = cfg.UserServiceIdleConns
+	transport.MaxIdleConnsPerHost = cfg.UserServiceIdleConns
+	transport.IdleConnTimeout = cfg.UserServiceIdleTTL
+	transport.ResponseHeaderTimeout = cfg.UserServiceTimeout
+
+	return &userServiceClient{
+		baseURL: cfg.UserServiceURL,
+		http: &http.Client{
+			Timeout:   cfg.UserServiceTimeout,
+			Transport: otelhttp.NewTransport(transport),
+		},
+		cache:    cache,
+		names:    newTTLCache[string](),
+		nameTTL:  cfg.UserCacheTTL,
+		breaker:  newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		attempts: cfg.UserServiceRetries,
+		backoff:  cfg.UserServiceBackoff,
+	}
+}
+
+type upstreamStatusError struct {
+	status int
+}
+
+func (e *upstreamStatusError) Error() string {
+	return fmt.Sprintf("user-service returned status %d", e.status)
+}
+
+func retryable(err error) bool {
+	var statusErr *upstreamStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status >= 500
+	}
+	return !errors.Is(err, errDecodeUserService)
+}
+
+type cacheEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+type ttlCache[V any] struct {
+	mu      sync.RWMutex
+	entries map[string]cacheEntry[V]
+}
+
+func newTTLCache[V any]() *ttlCache[V] {
+	return &ttlCache[V]{entries: make(map[string]cacheEntry[V])}
+}
+
+func (c *ttlCache[V]) get(key string) (V, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expiresAt) {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+func (c *ttlCache[V]) set(key string, value V, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	c.entries[key] = cacheEntry[V]{value: value, expiresAt: time.Now().Add(ttl)}
+	c.mu.Unlock()
+}
+
+func (c *ttlCache[V]) delete(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+type userExistsCache struct {
+	entries     *ttlCache[bool]
+	positiveTTL time.Duration
+	negativeTTL time.Duration
+}
+
+func newUserExistsCache(positiveTTL, negativeTTL time.Duration) *userExistsCache {
+	return &userExistsCache{
+		entries:     newTTLCache[bool](),
+		positiveTTL: positiveTTL,
+		negativeTTL: negativeTTL,
+	}
+}
+
+func (c *userExistsCache) get(userID string) (bool, bool) {
+	return c.entries.get(userID)
+}
+
+func (c *userExistsCache) set(userID string, exists bool) {
+	ttl := c.negativeTTL
+	if exists {
+		ttl = c.positiveTTL
+	}
+	c.entries.set(userID, exists, ttl)
+}
+
+func (c *userExistsCache) delete(userID string) {
+	c.entries.delete(userID)
+}
+
+func (u *userServiceClient) reachable(ctx context.Context) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.baseURL+"/ping", nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := u.http.Do(req)
+	if err != nil {
+		return false
+	}
+	defer drainAndClose(resp.Body)
+
+	return resp.StatusCode == 200
+}
+
+func (u *userServiceClient) checkUserExists(ctx context.Context, userID string) (bool, error) {
+	if exists, ok := u.cache.get(userID); ok {
+		return exists, nil
+	}
+
+	if err := u.breaker.allow(); err != nil {
+		return false, err
+	}
+
+	exists, err := u.fetchUserExists(ctx, userID)
+	u.breaker.record(err)
+	if err != nil {
+		u.cache.delete(userID)
+		return false, err
+	}
+
+	u.cache.set(userID, exists)
+	return exists, nil
+}
+
+func (u *userServiceClient) fetchUserExists(ctx context.Context, userID string) (bool, error) {
+	var exists bool
+	err := u.withRetry(ctx, func() error {
+		var err error
+		start := time.Now()
+		exists, err = u.fetchUserExistsOnce(ctx, userID)
+		observeUserServiceCall("user_exists", start, exists, err)
+		return err
+	})
+	return exists, err
+}
+
+func (u *userServiceClient) withRetry(ctx context.Context, call func() error) error {
+	delay := u.backoff
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || !retryable(err) || attempt >= u.attempts || ctx.Err() != nil {
+			return err
+		}
+
+		wait := delay/2 + rand.N(delay)
+		slog.WarnContext(ctx, "user-service call failed, retrying",
+			"attempt", attempt,
+			"retry_in", wait.String(),
+			"error", err,
+		)
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return errUserServiceTimeout
+			}
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+func (u *userServiceClient) fetchUserExistsOnce(ctx context.Context, userID string) (bool, error) {
+	url := fmt.Sprintf("%s/users/exists/%s", u.baseURL, userID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	if id := requestIDFromContext(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+
+	resp, err := u.http.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return false, errUserServiceTimeout
+		}
+		return false, err
+	}
+	defer drainAndClose(resp.Body)
+
+	switch {
+	case resp.StatusCode == 400 || resp.StatusCode == 404:
+		return false, nil
+	case resp.StatusCode != 200:
+		return false, &upstreamStatusError{status: resp.StatusCode}
+	}
+
+	var result struct {
+		ID     string `json:"id"`
+		Exists bool   `json:"exists"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("%w: %v", errDecodeUserService, err)
+	}
+
+	return result.Exists, nil
+}
+
+func (u *userServiceClient) checkUsersExist(ctx context.Context, userIDs []string) (map[string]bool, error) {
+	results := make(map[string]bool, len(userIDs))
+	var missing []string
+	for _, id := range userIDs {
+		if exists, ok := u.cache.get(id); ok {
+			results[id] = exists
+			continue
+		}
+		missing = append(missing, id)
+	}
+	if len(missing) == 0 {
+		return results, nil
+	}
+
+	fetched, err := u.fetchUsersExist(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range missing {
+		results[id] = fetched[id]
+		u.cache.set(id, fetched[id])
+	}
+	return results, nil
+}
+
+// fetchUsersExist asks the user service directly, skipping the cache. Callers
+// that act destructively on a "missing" answer should use it so a stale
+// negative entry cannot cost a real user their posts.
+func (u *userServiceClient) fetchUsersExist(ctx context.Context, userIDs []string) (map[string]bool, error) {
+	if err := u.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	var fetched map[string]bool
+	err := u.withRetry(ctx, func() error {
+		var err error
+		start := time.Now()
+		fetched, err = u.fetchUsersExistOnce(ctx, userIDs)
+		observeUserServiceCall("users_exist", start, true, err)
+		return err
+	})
+	u.breaker.record(err)
+	return fetched, err
+}
+
+func (u *userServiceClient) fetchUsersExistOnce(ctx context.Context, userIDs []string) (map[string]bool, error) {
+	body, err := json.Marshal(map[string][]string{"ids": userIDs})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.baseURL+"/users/exists", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := requestIDFromContext(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+
+	resp, err := u.http.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return nil, errUserServiceTimeout
+		}
+		return nil, err
+	}
+	defer drainAndClose(resp.Body)
+
+	if resp.StatusCode != 200 {
+		return nil, &upstreamStatusError{status: resp.StatusCode}
+	}
+
+	var result struct {
+		Results map[string]bool `json:"results"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("%w: %v", errDecodeUserService, err)
+	}
+
+	return result.Results, nil
+}
+
+// lookupUserName returns the user's display name, or found=false when the
+// user does not exist.
+func (u *userServiceClient) lookupUserName(ctx context.Context, userID string) (name string, found bool, err error) {
+	if name, ok := u.names.get(userID); ok {
+		return name, true, nil
+	}
+
+	if err := u.breaker.allow(); err != nil {
+		return "", false, err
+	}
+
+	err = u.withRetry(ctx, func() error {
+		var err error
+		start := time.Now()
+		name, found, err = u.fetchUserOnce(ctx, userID)
+		observeUserServiceCall("get_user", start, found, err)
+		return err
+	})
+	u.breaker.record(err)
+	if err != nil {
+		return "", false, err
+	}
+
+	u.cache.set(userID, found)
+	if found {
+		u.names.set(userID, name, u.nameTTL)
+	}
+	return name, found, nil
+}
+
+// lookupUserNames is the batch form of lookupUserName: uncached names are
+// fetched with one request per userNamesBatchSize ids. Users that do not exist are
+// left out of the result.
+func (u *userServiceClient) lookupUserNames(ctx context.Context, userIDs []string) (map[string]string, error) {
+	names := make(map[string]string, len(userIDs))
+	var missing []string
+	for _, id := range userIDs {
+		if name, ok := u.names.get(id); ok {
+			names[id] = name
+			continue
+		}
+		missing = append(missing, id)
+	}
+	if len(missing) == 0 {
+		return names, nil
+	}
+
+	if err := u.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	for batch := range slices.Chunk(missing, userNamesBatchSize) {
+		var fetched map[string]string
+		err := u.withRetry(ctx, func() error {
+			var err error
+			start := time.Now()
+			fetched, err = u.fetchUserNamesOnce(ctx, batch)
+			observeUserServiceCall("user_names", start, true, err)
+			return err
+		})
+		u.breaker.record(err)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range batch {
+			name, found := fetched[id]
+			u.cache.set(id, found)
+			if found {
+				u.names.set(id, name, u.nameTTL)
+				names[id] = name
+			}
+		}
+	}
+	return names, nil
+}
+
+func (u *userServiceClient) fetchUserNamesOnce(ctx context.Context, userIDs []string) (map[string]string, error) {
+	body, err := json.Marshal(map[string][]string{"ids": userIDs})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.baseURL+"/users/names", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := requestIDFromContext(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+
+	resp, err := u.http.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return nil, errUserServiceTimeout
+		}
+		return nil, err
+	}
+	defer drainAndClose(resp.Body)
+
+	if resp.StatusCode != 200 {
+		return nil, &upstreamStatusError{status: resp.StatusCode}
+	}
+
+	var result struct {
+		Names map[string]string `json:"names"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("%w: %v", errDecodeUserService, err)
+	}
+
+	return result.Names, nil
+}
+
+func (u *userServiceClient) fetchUserOnce(ctx context.Context, userID string) (string, bool, error) {
+	url := fmt.Sprintf("%s/users/%s", u.baseURL, userID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", false, err
+	}
+	if id := requestIDFromContext(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+
+	resp, err := u.http.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return "", false, errUserServiceTimeout
+		}
+		return "", false, err
+	}
+	defer drainAndClose(resp.Body)
+
+	switch {
+	case resp.StatusCode == 400 || resp.StatusCode == 404:
+		return "", false, nil
+	case resp.StatusCode != 200:
+		return "", false, &upstreamStatusError{status: resp.StatusCode}
+	}
+
+	var result struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", false, fmt.Errorf("%w: %v", errDecodeUserService, err)
+	}
+
+	return result.Name, true, nil
+}
+
+// drainAndClose reads off what is left of body so the connection can go back
+// to the idle pool.
+func drainAndClose(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, 64<<10))
+	body.Close()
+}
+
+func respondUserServiceError(c *gin.Context, err error) {
+	if errors.Is(err, errCircuitOpen) {
+		respondError(c, 503, codeUnavailable, "user-service is unavailable")
+		return
+	}
+	if errors.Is(err, errUserServiceTimeout) {
+		respondError(c, 504, codeUpstreamTimeout, "user-service timed out")
+		return
+	}
+	respondError(c, 502, codeUpstreamUnavailable, "cannot connect to user-service")
+}
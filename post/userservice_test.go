@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowHandler answers only after delay, or gives up when the client does.
+func slowHandler(delay time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+			w.Write([]byte(`{"exists":true}`))
+		case <-r.Context().Done():
+		}
+	})
+}
+
+func TestCheckUserExistsTimesOut(t *testing.T) {
+	fakeUserServiceWith(t, slowHandler(time.Second), func(cfg *Config) {
+		cfg.UserServiceTimeout = 20 * time.Millisecond
+	})
+
+	start := time.Now()
+	_, err := userService.checkUserExists(t.Context(), "64b000000000000000000001")
+	if !errors.Is(err, errUserServiceTimeout) {
+		t.Fatalf("err = %v, want errUserServiceTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("took %v, want the call bounded by the timeout", elapsed)
+	}
+}
+
+func TestUserServiceErrorStatuses(t *testing.T) {
+	t.Run("timeout is 504", func(t *testing.T) {
+		fakeUserServiceWith(t, slowHandler(time.Second), func(cfg *Config) {
+			cfg.UserServiceTimeout = 20 * time.Millisecond
+		})
+		r := newTestRouter(t, nil)
+
+		w := serve(r, "GET", "/posts/64b000000000000000000001", "")
+		if w.Code != 504 || errorCode(t, w) != codeUpstreamTimeout {
+			t.Errorf("status = %d, body %s; want 504", w.Code, w.Body)
+		}
+	})
+
+	t.Run("connection failure is 502", func(t *testing.T) {
+		srv := fakeUserService(t, http.NotFoundHandler())
+		srv.Close()
+		r := newTestRouter(t, nil)
+
+		w := serve(r, "GET", "/posts/64b000000000000000000001", "")
+		if w.Code != 502 || errorCode(t, w) != codeUpstreamUnavailable {
+			t.Errorf("status = %d, body %s; want 502", w.Code, w.Body)
+		}
+	})
+}
+
+func TestUserExistsCache(t *testing.T) {
+	const alive, gone = "64b000000000000000000001", "64b000000000000000000002"
+
+	var calls atomic.Int32
+	fakeUserServiceWith(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		fmt.Fprintf(w, `{"exists":%t}`, strings.HasSuffix(r.URL.Path, alive))
+	}), func(cfg *Config) {
+		cfg.UserCacheTTL = time.Hour
+		cfg.UserCacheNegativeTTL = 20 * time.Millisecond
+	})
+
+	for range 2 {
+		if exists, err := userService.checkUserExists(t.Context(), alive); err != nil || !exists {
+			t.Fatalf("checkUserExists(alive) = %v, %v", exists, err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("calls after two positive lookups = %d, want 1", n)
+	}
+
+	calls.Store(0)
+	for range 2 {
+		if exists, err := userService.checkUserExists(t.Context(), gone); err != nil || exists {
+			t.Fatalf("checkUserExists(gone) = %v, %v", exists, err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("calls after two negative lookups = %d, want 1", n)
+	}
+
+	// The negative entry has the shorter TTL and expires first.
+	time.Sleep(30 * time.Millisecond)
+	userService.checkUserExists(t.Context(), gone)
+	userService.checkUserExists(t.Context(), alive)
+	if n := calls.Load(); n != 2 {
+		t.Errorf("calls after negative TTL = %d, want 2", n)
+	}
+}
+
+func TestUserExistsCacheSkipsErrors(t *testing.T) {
+	const user = "64b000000000000000000001"
+
+	var calls atomic.Int32
+	fakeUserServiceWith(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(500)
+			return
+		}
+		w.Write([]byte(`{"exists":true}`))
+	}), func(cfg *Config) {
+		cfg.UserServiceRetries = 1
+	})
+
+	if _, err := userService.checkUserExists(t.Context(), user); err == nil {
+		t.Fatal("first call succeeded, want the 500 surfaced")
+	}
+	if exists, err := userService.checkUserExists(t.Context(), user); err != nil || !exists {
+		t.Fatalf("second call = %v, %v; want a fresh lookup", exists, err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("calls = %d, want 2", n)
+	}
+}
+
+func TestCheckUserExistsRetries(t *testing.T) {
+	const user = "64b000000000000000000001"
+
+	t.Run("fails twice then succeeds", func(t *testing.T) {
+		var calls atomic.Int32
+		fakeUserServiceWith(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= 2 {
+				w.WriteHeader(503)
+				return
+			}
+			w.Write([]byte(`{"exists":true}`))
+		}), func(cfg *Config) {
+			cfg.UserServiceRetries = 3
+		})
+
+		exists, err := userService.checkUserExists(t.Context(), user)
+		if err != nil || !exists {
+			t.Fatalf("checkUserExists = %v, %v; want true after retrying", exists, err)
+		}
+		if n := calls.Load(); n != 3 {
+			t.Errorf("calls = %d, want 3", n)
+		}
+	})
+
+	t.Run("4xx is not retried", func(t *testing.T) {
+		var calls atomic.Int32
+		fakeUserServiceWith(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(403)
+		}), func(cfg *Config) {
+			cfg.UserServiceRetries = 3
+		})
+
+		if _, err := userService.checkUserExists(t.Context(), user); err == nil {
+			t.Fatal("checkUserExists succeeded, want the 403 surfaced")
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("calls = %d, want 1", n)
+		}
+	})
+
+	t.Run("stops when the caller gives up", func(t *testing.T) {
+		var calls atomic.Int32
+		fakeUserServiceWith(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(503)
+		}), func(cfg *Config) {
+			cfg.UserServiceRetries = 10
+			cfg.UserServiceBackoff = 50 * time.Millisecond
+		})
+
+		ctx, cancel := context.WithTimeout(t.Context(), 60*time.Millisecond)
+		defer cancel()
+		if _, err := userService.checkUserExists(ctx, user); !errors.Is(err, errUserServiceTimeout) {
+			t.Fatalf("err = %v, want errUserServiceTimeout", err)
+		}
+		if n := calls.Load(); n >= 10 {
+			t.Errorf("calls = %d, want retries cut short by the deadline", n)
+		}
+	})
+}
+
+// The shared client keeps connections to the user service alive between
+// calls; a client per call pays for a new connection every time.
+func BenchmarkUserExistsPooledClient(b *testing.B) {
+	fakeUserService(b, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"exists":true}`))
+	}))
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := userService.fetchUserExistsOnce(b.Context(), "64b000000000000000000001"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUserExistsClientPerCall(b *testing.B) {
+	srv := fakeUserService(b, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"exists":true}`))
+	}))
+	cfg := testConfig(b)
+	cfg.UserServiceURL = srv.URL
+
+	b.ReportAllocs()
+	for b.Loop() {
+		client := newUserServiceClient(cfg, newUserExistsCache(0, 0))
+		if _, err := client.fetchUserExistsOnce(b.Context(), "64b000000000000000000001"); err != nil {
+			b.Fatal(err)
+		}
+		client.http.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxTags          = 10
+	maxTagLength     = 50
+	maxTTLSeconds    = 365 * 24 * 60 * 60
+	maxTitleLength   = 200
+	maxContentLength = 10000
+)
+
+func registerJSONFieldNames() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+}
+
+func respondBindError(c *gin.Context, err error) {
+	if respondBodyTooLarge(c, err) {
+		return
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		respondError(c, 400, codeBadRequest, err.Error())
+		return
+	}
+
+	fieldErrors := make(map[string]string, len(validationErrs))
+	for _, fe := range validationErrs {
+		fieldErrors[fe.Field()] = fieldErrorReason(fe)
+	}
+	respondFieldErrors(c, fieldErrors)
+}
+
+func fieldErrorReason(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", fe.Field())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters", fe.Field(), fe.Param())
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters", fe.Field(), fe.Param())
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", fe.Field())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", fe.Field(), fe.Param())
+	default:
+		return fmt.Sprintf("%s is invalid", fe.Field())
+	}
+}
+
+func normalizeUserID(userID string) (string, error) {
+	objID, err := primitive.ObjectIDFromHex(strings.TrimSpace(userID))
+	if err != nil {
+		return "", errors.New("user_id must be a 24-character hex ObjectID")
+	}
+	return objID.Hex(), nil
+}
+
+// paramAlias exposes the path parameter from under the name to as well. Gin
+// requires every GET route under /posts/ to name its first wildcard :userID,
+// so routes such as /posts/:userID/history use it to hand handlers a postID.
+func paramAlias(from, to string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Params = append(c.Params, gin.Param{Key: to, Value: c.Param(from)})
+	}
+}
+
+// parseObjectID reads the named path parameter as an ObjectID. On failure it
+// writes a 400 and returns false, and the caller should return.
+func parseObjectID(c *gin.Context, param string) (primitive.ObjectID, bool) {
+	objID, err := primitive.ObjectIDFromHex(c.Param(param))
+	if err != nil {
+		respondError(c, 400, codeInvalidID, fmt.Sprintf("%s must be a 24-character hex ObjectID", param))
+		return primitive.NilObjectID, false
+	}
+	return objID, true
+}
+
+func validatePost(post *Post) map[string]string {
+	post.Title = strings.TrimSpace(sanitizeText(post.Title))
+	post.Content = strings.TrimSpace(sanitizeContent(post.Content))
+
+	fieldErrors := map[string]string{}
+	switch {
+	case post.Title == "":
+		fieldErrors["title"] = "title is required"
+	case utf8.RuneCountInString(post.Title) > maxTitleLength:
+		fieldErrors["title"] = fmt.Sprintf("title must be at most %d characters", maxTitleLength)
+	}
+	switch {
+	case post.Content == "":
+		fieldErrors["content"] = "content is required"
+	case utf8.RuneCountInString(post.Content) > maxContentLength:
+		fieldErrors["content"] = fmt.Sprintf("content must be at most %d characters", maxContentLength)
+	}
+	if post.TTLSeconds < 0 || post.TTLSeconds > maxTTLSeconds {
+		fieldErrors["ttl_seconds"] = fmt.Sprintf("ttl_seconds must be between 0 and %d", maxTTLSeconds)
+	}
+	return fieldErrors
+}
+
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(sanitizeText(tag)))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("each tag must be at most %d characters", maxTagLength)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("tags must contain at most %d entries", maxTags)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestNormalizeUserID(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		ok       bool
+	}{
+		{"64b000000000000000000001", "64b000000000000000000001", true},
+		{" 64B0000000000000000000AB ", "64b0000000000000000000ab", true},
+		{"", "", false},
+		{"alice", "", false},
+		{"64b00000000000000000000", "", false},
+		{"64b00000000000000000000z", "", false},
+	} {
+		got, err := normalizeUserID(tc.in)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("normalizeUserID(%q) = %q, %v; want %q, ok=%t", tc.in, got, err, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	got, err := normalizeTags([]string{" Go ", "go", "DOCKER", "", "  ", "mongo"})
+	if err != nil || !slices.Equal(got, []string{"go", "docker", "mongo"}) {
+		t.Errorf("normalizeTags = %q, %v; want lowercased, trimmed and de-duplicated", got, err)
+	}
+
+	eleven := make([]string, maxTags+1)
+	for i := range eleven {
+		eleven[i] = fmt.Sprintf("tag%d", i)
+	}
+	if _, err := normalizeTags(eleven); err == nil {
+		t.Errorf("%d tags accepted, want at most %d", len(eleven), maxTags)
+	}
+	// Duplicates are dropped before the cap is checked.
+	if got, err := normalizeTags(append(eleven[:maxTags:maxTags], "TAG0")); err != nil || len(got) != maxTags {
+		t.Errorf("%d distinct tags plus a duplicate = %d, %v; want %d", maxTags, len(got), err, maxTags)
+	}
+	if _, err := normalizeTags([]string{strings.Repeat("x", maxTagLength+1)}); err == nil {
+		t.Error("over-long tag accepted")
+	}
+}
+
+func TestCreatePostNormalizesTags(t *testing.T) {
+	const author = "64b000000000000000000001"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"Alice"}`))
+	}))
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(findResponse(t), writeResponse(1))
+
+		body := `{"user_id":"` + author + `","title":"Hello","content":"World","tags":["Go"," go ","Docker"]}`
+		if w := serve(r, "POST", "/posts", body, "Authorization", bearer(t, author, "")); w.Code != 201 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		stored := startedCommand(t, mt, "insert").Lookup("documents", "0", "tags").Array()
+		values, _ := stored.Values()
+		var tags []string
+		for _, v := range values {
+			tags = append(tags, v.StringValue())
+		}
+		if want := []string{"go", "docker"}; !slices.Equal(tags, want) {
+			t.Errorf("stored tags = %q, want %q", tags, want)
+		}
+	})
+}
+
+func TestCreatePostRejectsNonHexUserID(t *testing.T) {
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected user-service call %s %s", r.Method, r.URL.Path)
+	}))
+	r := newTestRouter(t, nil)
+
+	body := `{"user_id":"alice","title":"Hello","content":"World"}`
+	w := serve(r, "POST", "/posts", body, "Authorization", bearer(t, "alice", ""))
+	if w.Code != 400 || errorCode(t, w) != codeValidation {
+		t.Fatalf("status = %d, body %s; want 400 validation_failed", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), `"user_id"`) {
+		t.Errorf("body %s does not name user_id", w.Body)
+	}
+}
+
+func TestValidatePostPreview(t *testing.T) {
+	const author = "64b000000000000000000001"
+	fakeUserService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"Alice"}`))
+	}))
+	token := bearer(t, author, "")
+
+	t.Run("valid post writes nothing", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			// "hello-world" is taken, so the preview shows the next slug.
+			mt.AddMockResponses(findResponse(t, Post{Slug: "hello-world"}))
+
+			body := `{"user_id":"` + author + `","title":"Hello World","content":"<script>alert(1)</script>Hi"}`
+			w := serve(r, "POST", "/posts/validate", body, "Authorization", token)
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Valid bool `json:"valid"`
+				Post  Post `json:"post"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if !resp.Valid || resp.Post.Slug != "hello-world-2" || resp.Post.UserName != "Alice" {
+				t.Errorf("preview = %s, want valid with slug hello-world-2 by Alice", w.Body)
+			}
+			if strings.Contains(resp.Post.Content, "<script") {
+				t.Errorf("content = %q, want it sanitized", resp.Post.Content)
+			}
+			if got := commandNames(mt); !slices.Equal(got, []string{"find"}) {
+				t.Errorf("commands = %v, want only the slug lookup", got)
+			}
+		})
+	})
+
+	t.Run("invalid post reports every field", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			body := `{"user_id":"` + author + `","title":"  ","content":"","tags":["` + strings.Repeat("x", 100) + `"]}`
+			w := serve(r, "POST", "/posts/validate", body, "Authorization", token)
+			if w.Code != 400 || errorCode(t, w) != codeValidation {
+				t.Fatalf("status = %d, body %s; want 400 validation_failed", w.Code, w.Body)
+			}
+			var resp struct {
+				Error APIError `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range []string{"title", "content", "tags"} {
+				if resp.Error.Fields[field] == "" {
+					t.Errorf("fields = %v, missing %s", resp.Error.Fields, field)
+				}
+			}
+			if got := commandNames(mt); len(got) != 0 {
+				t.Errorf("commands = %v, want none", got)
+			}
+		})
+	})
+}
+
+// TestMalformedIDs walks every route with an ID in its path, so new handlers
+// are held to the same 400 without being listed here.
+func TestMalformedIDs(t *testing.T) {
+	param := regexp.MustCompile(`:(postID|userID|id)\b`)
+	token := bearer(t, "64b0000000000000000000ad", roleAdmin)
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		checked := 0
+		for _, route := range r.Routes() {
+			if !param.MatchString(route.Path) {
+				continue
+			}
+			checked++
+			path := param.ReplaceAllString(route.Path, "not-an-id")
+			w := serve(r, route.Method, path, "{}", "Authorization", token)
+			if w.Code != 400 || errorCode(t, w) != codeInvalidID {
+				t.Errorf("%s %s: status = %d, body %s; want 400 %s", route.Method, path, w.Code, w.Body, codeInvalidID)
+			}
+		}
+		if checked == 0 {
+			t.Fatal("no routes take an ID")
+		}
+		if n := len(mt.GetAllStartedEvents()); n != 0 {
+			t.Errorf("sent %d commands for malformed IDs, want none", n)
+		}
+	})
+}
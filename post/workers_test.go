@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerGroupStopCancelsWorkers(t *testing.T) {
+	g := newWorkerGroup()
+	var stopped atomic.Int32
+	started := make(chan struct{}, 2)
+	for _, name := range []string{"first", "second"} {
+		g.start(name, func(ctx context.Context) {
+			started <- struct{}{}
+			<-ctx.Done()
+			stopped.Add(1)
+		})
+	}
+	<-started
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := g.stop(ctx); err != nil {
+		t.Fatalf("stop = %v, want nil", err)
+	}
+	if n := stopped.Load(); n != 2 {
+		t.Errorf("%d workers returned before stop did, want 2", n)
+	}
+}
+
+func TestWorkerGroupStopGivesUp(t *testing.T) {
+	g := newWorkerGroup()
+	release := make(chan struct{})
+	defer close(release)
+	// Ignores cancellation, as a stuck worker would.
+	g.start("stuck", func(context.Context) { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := g.stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("stop = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	authSubjectKey = "auth_subject"
+	authRoleKey    = "auth_role"
+	roleAdmin      = "admin"
+)
+
+type authClaims struct {
+	Role string `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func authRequired(secret []byte) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || tokenString == "" {
+			respondError(c, 401, codeUnauthorized, "missing bearer token")
+			return
+		}
+
+		var claims authClaims
+		_, err := jwt.ParseWithClaims(tokenString, &claims, func(*jwt.Token) (any, error) {
+			return secret, nil
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+		if err != nil {
+			respondError(c, 401, codeUnauthorized, "invalid token")
+			return
+		}
+		if claims.Subject == "" {
+			respondError(c, 401, codeUnauthorized, "token has no subject")
+			return
+		}
+
+		c.Set(authSubjectKey, claims.Subject)
+		c.Set(authRoleKey, claims.Role)
+		c.Next()
+	}
+}
+
+// adminOnly must run after authRequired.
+func adminOnly(c *gin.Context) {
+	if c.GetString(authRoleKey) != roleAdmin {
+		respondError(c, 403, codeForbidden, "admin role required")
+		return
+	}
+	c.Next()
+}
+
+func isSelfOrAdmin(c *gin.Context, userID string) bool {
+	return c.GetString(authSubjectKey) == userID || c.GetString(authRoleKey) == roleAdmin
+}
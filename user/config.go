@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	MongoURI            string
+	MongoDB             string
+	UserCollection      string
+	PostCollection      string
+	OutboxCollection    string // the post service's outbox; empty writes starter posts without events
+	MongoConnectRetries int
+	MongoMaxPoolSize    int
+	MongoMinPoolSize    int
+	MongoTLSCAFile      string
+	MongoTLSCertFile    string
+	Port                string
+	ShutdownTimeout     time.Duration
+	OTLPEndpoint        string
+	EnablePprof         bool
+	ReadOnly            bool
+	EnableSeed          bool
+	RequestTimeout      time.Duration
+	BulkRequestTimeout  time.Duration
+	IndexTimeout        time.Duration
+	SlowRequest         time.Duration
+	DefaultPageSize     int
+	MaxPageSize         int
+	MaxBodyBytes        int
+
+	PostServiceURL     string
+	PostServiceTimeout time.Duration
+
+	JWTSecret          string
+	CORSAllowedOrigins []string
+	RateLimitRPS       float64
+	RateLimitBurst     int
+	TrustedProxies     []string
+}
+
+func LoadConfig() (Config, error) {
+	var env envReader
+
+	cfg := Config{
+		MongoURI:            env.string("MONGO_URI", "mongodb://localhost:27017"),
+		MongoDB:             env.string("MONGO_DB", "TTTN"),
+		UserCollection:      env.string("USER_COLLECTION", "users"),
+		PostCollection:      env.string("POST_COLLECTION", "posts"),
+		OutboxCollection:    env.string("OUTBOX_COLLECTION", ""),
+		MongoConnectRetries: env.int("MONGO_CONNECT_RETRIES", 5),
+		MongoMaxPoolSize:    env.int("MONGO_MAX_POOL_SIZE", 100),
+		MongoMinPoolSize:    env.int("MONGO_MIN_POOL_SIZE", 0),
+		MongoTLSCAFile:      env.string("MONGO_TLS_CA_FILE", ""),
+		MongoTLSCertFile:    env.string("MONGO_TLS_CERT_KEY_FILE", ""),
+		Port:                env.string("PORT", "8080"),
+		ShutdownTimeout:     env.duration("SHUTDOWN_TIMEOUT", 10*time.Second),
+		OTLPEndpoint:        env.string("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		EnablePprof:         env.bool("ENABLE_PPROF", false),
+		ReadOnly:            env.bool("READ_ONLY", false),
+		EnableSeed:          env.bool("ENABLE_SEED", false),
+		RequestTimeout:      env.duration("REQUEST_TIMEOUT", 5*time.Second),
+		BulkRequestTimeout:  env.duration("BULK_REQUEST_TIMEOUT", 30*time.Second),
+		IndexTimeout:        env.duration("INDEX_TIMEOUT", time.Minute),
+		SlowRequest:         time.Duration(env.int("SLOW_REQUEST_MS", 2000)) * time.Millisecond,
+		DefaultPageSize:     env.int("DEFAULT_PAGE_SIZE", 20),
+		MaxPageSize:         env.int("MAX_PAGE_SIZE", 100),
+		MaxBodyBytes:        env.int("MAX_BODY_BYTES", 1<<20),
+
+		PostServiceURL:     env.string("POST_SERVICE_URL", "http://localhost:8081"),
+		PostServiceTimeout: env.duration("POST_SERVICE_TIMEOUT", 3*time.Second),
+
+		JWTSecret:          env.string("JWT_SECRET", ""),
+		CORSAllowedOrigins: parseAllowedOrigins(env.string("CORS_ALLOWED_ORIGINS", "")),
+		RateLimitRPS:       env.float("RATE_LIMIT_RPS", 5),
+		RateLimitBurst:     env.int("RATE_LIMIT_BURST", 10),
+		TrustedProxies:     env.addresses("TRUSTED_PROXIES"),
+	}
+
+	if strings.TrimSpace(cfg.MongoDB) == "" {
+		env.fail("MONGO_DB must not be empty")
+	}
+	if strings.TrimSpace(cfg.UserCollection) == "" {
+		env.fail("USER_COLLECTION must not be empty")
+	}
+	if strings.TrimSpace(cfg.PostCollection) == "" {
+		env.fail("POST_COLLECTION must not be empty")
+	}
+	if cfg.MongoConnectRetries < 1 {
+		env.fail("MONGO_CONNECT_RETRIES must be at least 1")
+	}
+	if cfg.MongoMaxPoolSize < 1 {
+		env.fail("MONGO_MAX_POOL_SIZE must be at least 1")
+	}
+	if !strings.HasPrefix(cfg.MongoURI, "mongodb://") && !strings.HasPrefix(cfg.MongoURI, "mongodb+srv://") {
+		env.fail("MONGO_URI must start with mongodb:// or mongodb+srv://")
+	}
+	if cfg.MongoMinPoolSize < 0 {
+		env.fail("MONGO_MIN_POOL_SIZE must not be negative")
+	}
+	if cfg.MongoMinPoolSize > cfg.MongoMaxPoolSize {
+		env.fail("MONGO_MIN_POOL_SIZE (%d) must not exceed MONGO_MAX_POOL_SIZE (%d)", cfg.MongoMinPoolSize, cfg.MongoMaxPoolSize)
+	}
+	if cfg.MaxPageSize < 1 {
+		env.fail("MAX_PAGE_SIZE must be at least 1")
+	}
+	if cfg.DefaultPageSize < 1 || cfg.DefaultPageSize > cfg.MaxPageSize {
+		env.fail("DEFAULT_PAGE_SIZE must be between 1 and MAX_PAGE_SIZE (%d)", cfg.MaxPageSize)
+	}
+	if cfg.SlowRequest < 0 {
+		env.fail("SLOW_REQUEST_MS must not be negative")
+	}
+	if cfg.RequestTimeout <= 0 {
+		env.fail("REQUEST_TIMEOUT must be positive")
+	}
+	if cfg.BulkRequestTimeout <= 0 {
+		env.fail("BULK_REQUEST_TIMEOUT must be positive")
+	}
+	if cfg.IndexTimeout <= 0 {
+		env.fail("INDEX_TIMEOUT must be positive")
+	}
+	if cfg.MaxBodyBytes < 1 {
+		env.fail("MAX_BODY_BYTES must be at least 1")
+	}
+	if cfg.JWTSecret == "" {
+		env.fail("JWT_SECRET must be set")
+	}
+	if cfg.PostServiceTimeout <= 0 {
+		env.fail("POST_SERVICE_TIMEOUT must be positive")
+	}
+
+	return cfg, env.err
+}
+
+type envReader struct {
+	err error
+}
+
+func (r *envReader) fail(format string, args ...any) {
+	r.err = errors.Join(r.err, fmt.Errorf(format, args...))
+}
+
+func (r *envReader) string(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func (r *envReader) int(key string, fallback int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		r.fail("%s must be an integer, got %q", key, raw)
+		return fallback
+	}
+	return n
+}
+
+func (r *envReader) bool(key string, fallback bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		r.fail("%s must be true or false, got %q", key, raw)
+		return fallback
+	}
+	return b
+}
+
+func (r *envReader) float(key string, fallback float64) float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		r.fail("%s must be a number, got %q", key, raw)
+		return fallback
+	}
+	return f
+}
+
+func (r *envReader) duration(key string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		r.fail("%s must be a duration, got %q", key, raw)
+		return fallback
+	}
+	return d
+}
+
+// addresses reads a comma-separated list of IP addresses and CIDR ranges.
+func (r *envReader) addresses(key string) []string {
+	var out []string
+	for _, addr := range strings.Split(os.Getenv(key), ",") {
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+		if net.ParseIP(addr) == nil {
+			if _, _, err := net.ParseCIDR(addr); err != nil {
+				r.fail("%s must list IP addresses or CIDR ranges, got %q", key, addr)
+				continue
+			}
+		}
+		out = append(out, addr)
+	}
+	return out
+}
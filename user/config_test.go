@@ -0,0 +1,83 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	for _, key := range []string{"MONGO_URI", "MONGO_DB", "PORT", "POST_SERVICE_URL", "POST_SERVICE_TIMEOUT", "REQUEST_TIMEOUT", "BULK_REQUEST_TIMEOUT", "INDEX_TIMEOUT"} {
+		t.Setenv(key, "")
+	}
+	cfg := testConfig(t)
+
+	if cfg.MongoURI != "mongodb://localhost:27017" || cfg.MongoDB != "TTTN" {
+		t.Errorf("mongo = %q/%q", cfg.MongoURI, cfg.MongoDB)
+	}
+	if cfg.Port != "8080" {
+		t.Errorf("Port = %q, want 8080", cfg.Port)
+	}
+	if cfg.PostServiceURL != "http://localhost:8081" || cfg.PostServiceTimeout != 3*time.Second {
+		t.Errorf("post service = %q, %v", cfg.PostServiceURL, cfg.PostServiceTimeout)
+	}
+	if cfg.RequestTimeout != 5*time.Second {
+		t.Errorf("RequestTimeout = %v, want 5s", cfg.RequestTimeout)
+	}
+	if cfg.BulkRequestTimeout != 30*time.Second || cfg.IndexTimeout != time.Minute {
+		t.Errorf("BulkRequestTimeout/IndexTimeout = %v/%v, want 30s/1m", cfg.BulkRequestTimeout, cfg.IndexTimeout)
+	}
+}
+
+func TestLoadConfigOverrides(t *testing.T) {
+	t.Setenv("MONGO_URI", "mongodb+srv://cluster.example.com")
+	t.Setenv("PORT", "9000")
+	t.Setenv("TRUSTED_PROXIES", "172.28.0.10, 10.0.0.0/8")
+	t.Setenv("BULK_REQUEST_TIMEOUT", "2m")
+	t.Setenv("OUTBOX_COLLECTION", "outbox")
+	t.Setenv("INDEX_TIMEOUT", "5m")
+	t.Setenv("POST_SERVICE_URL", "http://post-service:8081")
+	t.Setenv("POST_SERVICE_TIMEOUT", "750ms")
+	t.Setenv("ENABLE_SEED", "true")
+	cfg := testConfig(t)
+
+	if cfg.MongoURI != "mongodb+srv://cluster.example.com" || cfg.Port != "9000" {
+		t.Errorf("mongo/port = %q/%q", cfg.MongoURI, cfg.Port)
+	}
+	if cfg.PostServiceURL != "http://post-service:8081" || cfg.PostServiceTimeout != 750*time.Millisecond {
+		t.Errorf("post service = %q, %v", cfg.PostServiceURL, cfg.PostServiceTimeout)
+	}
+	if !cfg.EnableSeed {
+		t.Error("EnableSeed = false, want true")
+	}
+	if want := []string{"172.28.0.10", "10.0.0.0/8"}; !slices.Equal(cfg.TrustedProxies, want) {
+		t.Errorf("TrustedProxies = %q, want %q", cfg.TrustedProxies, want)
+	}
+	if cfg.BulkRequestTimeout != 2*time.Minute || cfg.IndexTimeout != 5*time.Minute {
+		t.Errorf("BulkRequestTimeout/IndexTimeout = %v/%v, want 2m/5m", cfg.BulkRequestTimeout, cfg.IndexTimeout)
+	}
+	if cfg.OutboxCollection != "outbox" {
+		t.Errorf("OutboxCollection = %q, want outbox", cfg.OutboxCollection)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("MONGO_URI", "localhost:27017")
+	t.Setenv("POST_SERVICE_TIMEOUT", "soon")
+	t.Setenv("MAX_PAGE_SIZE", "lots")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.1, nginx")
+	t.Setenv("BULK_REQUEST_TIMEOUT", "0s")
+
+	_, err := LoadConfig()
+	if err == nil {
+		t.Fatal("LoadConfig succeeded, want an error")
+	}
+	// Every problem is reported at once, not just the first.
+	for _, key := range []string{"JWT_SECRET", "MONGO_URI", "POST_SERVICE_TIMEOUT", "MAX_PAGE_SIZE", "TRUSTED_PROXIES", "BULK_REQUEST_TIMEOUT"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error does not mention %s: %v", key, err)
+		}
+	}
+}
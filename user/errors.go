@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	codeBadRequest          = "bad_request"
+	codeInvalidID           = "invalid_id"
+	codeValidation          = "validation_failed"
+	codeUnauthorized        = "unauthorized"
+	codeForbidden           = "forbidden"
+	codeNotFound            = "not_found"
+	codeMethodNotAllowed    = "method_not_allowed"
+	codeConflict            = "conflict"
+	codePayloadTooLarge     = "payload_too_large"
+	codeRateLimited         = "rate_limited"
+	codeReadOnly            = "read_only"
+	codeInternal            = "internal_error"
+	codeRequestTimeout      = "request_timeout"
+	codeUnavailable         = "service_unavailable"
+	codeUpstreamUnavailable = "upstream_unavailable"
+	codeUpstreamTimeout     = "upstream_timeout"
+)
+
+type APIError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+func respondError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": APIError{Code: code, Message: message}})
+}
+
+func respondFieldErrors(c *gin.Context, fields map[string]string) {
+	c.AbortWithStatusJSON(400, gin.H{"error": APIError{
+		Code:    codeValidation,
+		Message: "request validation failed",
+		Fields:  fields,
+	}})
+}
+
+// respondBodyTooLarge reports err as 413 if it came from a body cut off by
+// bodyLimit and returns whether it did.
+func respondBodyTooLarge(c *gin.Context, err error) bool {
+	var maxErr *http.MaxBytesError
+	if !errors.As(err, &maxErr) {
+		return false
+	}
+	respondError(c, 413, codePayloadTooLarge, fmt.Sprintf("request body must be at most %d bytes", maxErr.Limit))
+	return true
+}
+
+// methodNotAllowed answers a known path hit with the wrong method. Gin has
+// already set the Allow header by the time it runs.
+func methodNotAllowed(c *gin.Context) {
+	respondError(c, 405, codeMethodNotAllowed, fmt.Sprintf("%s is not allowed on %s", c.Request.Method, c.Request.URL.Path))
+}
+
+func respondInternalError(c *gin.Context, err error) {
+	slog.ErrorContext(c.Request.Context(), "request failed", "error", err)
+	if errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err) {
+		respondError(c, 504, codeRequestTimeout, "request timed out")
+		return
+	}
+	respondError(c, 500, codeInternal, "internal server error")
+}
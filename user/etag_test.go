@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetUserByIDETag(t *testing.T) {
+	userID := primitive.NewObjectID()
+	path := "/users/" + userID.Hex()
+	user := User{ID: userID, Name: "Alice"}
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		renamed := user
+		renamed.Name = "Alicia"
+		mt.AddMockResponses(findResponse(t, user), findResponse(t, user), findResponse(t, renamed))
+
+		first := serve(r, "GET", path, "")
+		if first.Code != 200 {
+			t.Fatalf("status = %d: %s", first.Code, first.Body)
+		}
+		etag := first.Header().Get("ETag")
+		if etag == "" {
+			t.Fatal("no ETag on a 200")
+		}
+
+		cached := serve(r, "GET", path, "", "If-None-Match", etag)
+		if cached.Code != 304 {
+			t.Fatalf("status = %d, want 304", cached.Code)
+		}
+		if cached.Body.Len() != 0 {
+			t.Errorf("304 carried a body: %s", cached.Body)
+		}
+
+		changed := serve(r, "GET", path, "", "If-None-Match", etag)
+		if changed.Code != 200 {
+			t.Fatalf("status after a rename = %d, want 200", changed.Code)
+		}
+		if changed.Header().Get("ETag") == etag {
+			t.Error("ETag did not change with the user")
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	healthOK          = "ok"
+	healthDegraded    = "degraded"
+	healthUnavailable = "unavailable"
+
+	healthCheckTimeout = time.Second
+)
+
+var healthSeverity = map[string]int{healthOK: 0, healthDegraded: 1, healthUnavailable: 2}
+
+// healthCheck reports one dependency as healthOK, healthDegraded or
+// healthUnavailable.
+type healthCheck func(ctx context.Context) string
+
+// runHealthChecks runs every check in parallel, each under its own timeout,
+// and returns the worst result alongside the per-check results.
+func runHealthChecks(ctx context.Context, checks map[string]healthCheck) (string, map[string]string) {
+	results := make(map[string]string, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			status := check(checkCtx)
+			mu.Lock()
+			results[name] = status
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	overall := healthOK
+	for _, status := range results {
+		if healthSeverity[status] > healthSeverity[overall] {
+			overall = status
+		}
+	}
+	return overall, results
+}
+
+func checkMongo(ctx context.Context) string {
+	if err := mongoClient.Ping(ctx, nil); err != nil {
+		return healthUnavailable
+	}
+	return healthOK
+}
+
+func healthz(c *gin.Context) {
+	if !indexesReady.Load() {
+		c.JSON(503, gin.H{"status": "starting"})
+		return
+	}
+
+	status, checks := runHealthChecks(c.Request.Context(), map[string]healthCheck{
+		"mongo": checkMongo,
+	})
+	code := 200
+	if status == healthUnavailable {
+		code = 503
+	}
+	c.JSON(code, gin.H{"status": status, "checks": checks})
+}
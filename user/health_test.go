@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestHealthzChecks(t *testing.T) {
+	indexesReady.Store(true)
+	t.Cleanup(func() { indexesReady.Store(false) })
+
+	for _, tc := range []struct {
+		name   string
+		ping   bson.D
+		code   int
+		status string
+	}{
+		{"mongo up", mtest.CreateSuccessResponse(), 200, healthOK},
+		{"mongo down", mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Name: "Unauthorized", Message: "not authorized"}),
+			503, healthUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				mt.AddMockResponses(tc.ping)
+
+				w := serve(newTestRouter(t, nil), "GET", "/healthz", "")
+				var body struct {
+					Status string            `json:"status"`
+					Checks map[string]string `json:"checks"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				want := map[string]string{"mongo": tc.status}
+				if w.Code != tc.code || body.Status != tc.status || !maps.Equal(body.Checks, want) {
+					t.Errorf("healthz = %d %s, want %d %q with checks %v", w.Code, w.Body, tc.code, tc.status, want)
+				}
+			})
+		})
+	}
+}
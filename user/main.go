@@ -1,136 +1,987 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-var userCollection *mongo.Collection
+var (
+	mongoClient    *mongo.Client
+	userCollection *mongo.Collection
+	postCollection *mongo.Collection
+
+	// requestTimeout bounds each handler's work; newRouter sets it from
+	// REQUEST_TIMEOUT.
+	requestTimeout = 5 * time.Second
+
+	// bulkRequestTimeout bounds handlers that work through a whole batch;
+	// newRouter sets it from BULK_REQUEST_TIMEOUT.
+	bulkRequestTimeout = 30 * time.Second
+
+	// defaultPageSize and maxPageSize bound list endpoints; newRouter sets
+	// them from DEFAULT_PAGE_SIZE and MAX_PAGE_SIZE.
+	defaultPageSize int64 = 20
+	maxPageSize     int64 = 100
+
+	// indexesReady flips once ensureIndexes succeeds; healthz reports 503
+	// until then.
+	indexesReady atomic.Bool
+)
+
+const (
+	maxBatchDelete    = 500
+	maxNameHistory    = 10
+	maxExistsQueryIDs = 200
+	maxNameLookupIDs  = 500
+	maxBulkUsers      = 500
+)
 
 type User struct {
-	ID   primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Name string             `bson:"name" json:"name"`
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" xml:"id,omitempty"`
+	Name        string             `bson:"name" json:"name" xml:"name"`
+	Email       string             `bson:"email" json:"email" xml:"email" binding:"required,email,max=254"`
+	NameHistory []nameChange       `bson:"name_history,omitempty" json:"name_history,omitempty" xml:"name_history>change,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at,omitempty" json:"created_at,omitzero" xml:"created_at,omitempty"`
+}
+
+type nameChange struct {
+	Name      string    `bson:"name" json:"name" xml:"name"`
+	ChangedAt time.Time `bson:"changed_at" json:"changed_at" xml:"changed_at"`
 }
 
 func main() {
-	r := gin.Default()
-	mongoURI := os.Getenv("MONGO_URI")
-	if mongoURI == "" {
-		mongoURI = "mongodb://localhost:27017"
+	slog.SetDefault(newLogger())
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		panic(err)
 	}
 
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(mongoURI))
+	shutdownTracing, err := setupTracing(context.Background(), "user-service", cfg.OTLPEndpoint)
 	if err != nil {
 		panic(err)
 	}
-	defer client.Disconnect(context.TODO())
 
-	userCollection = client.Database("TTTN").Collection("users")
+	client, err := connectMongo(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	mongoClient = client
+	userCollection = client.Database(cfg.MongoDB).Collection(cfg.UserCollection)
+	postCollection = client.Database(cfg.MongoDB).Collection(cfg.PostCollection)
+	if cfg.OutboxCollection != "" {
+		outboxCollection = client.Database(cfg.MongoDB).Collection(cfg.OutboxCollection)
+	}
+	slog.Info("using mongo collection", "database", cfg.MongoDB, "collection", cfg.UserCollection)
+	if err := prepareIndexes(cfg); err != nil {
+		panic(err)
+	}
+
+	postService = newPostServiceClient(cfg.PostServiceURL, cfg.PostServiceTimeout)
+
+	// Workers outlive the signal context: they are stopped only after the
+	// server has drained, so work queued by the last requests still runs.
+	workers := newWorkerGroup()
+
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: newRouter(cfg, workers),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("listen failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	slog.Info("shutting down user-service")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("server shutdown failed", "error", err)
+	}
+	if err := workers.stop(shutdownCtx); err != nil {
+		slog.Error("background workers did not stop", "error", err)
+	}
+	if err := client.Disconnect(shutdownCtx); err != nil {
+		slog.Error("mongo disconnect failed", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("tracing shutdown failed", "error", err)
+	}
+}
+
+func newRouter(cfg Config, workers *workerGroup) *gin.Engine {
+	registerJSONFieldNames()
+
+	requestTimeout = cfg.RequestTimeout
+	bulkRequestTimeout = cfg.BulkRequestTimeout
+	defaultPageSize = int64(cfg.DefaultPageSize)
+	maxPageSize = int64(cfg.MaxPageSize)
+	readOnly.Store(cfg.ReadOnly)
+
+	r := gin.New()
+	// Only proxies listed in TRUSTED_PROXIES may name the client in
+	// X-Forwarded-For or X-Real-IP; from anyone else those headers are
+	// ignored, so clients cannot pick their own rate-limit bucket.
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		slog.Error("ignoring TRUSTED_PROXIES", "error", err)
+		r.SetTrustedProxies(nil)
+	}
+	r.HandleMethodNotAllowed = true
+	r.NoMethod(methodNotAllowed)
+	r.Use(
+		otelgin.Middleware("user-service"),
+		requestID(),
+		requestLogger(cfg.SlowRequest, pprofPrefix),
+		metricsMiddleware(),
+		jsonRecovery(),
+		cors(cfg.CORSAllowedOrigins),
+		gzipCompression("/metrics", pprofPrefix),
+		bodyLimit(int64(cfg.MaxBodyBytes), nil),
+		readOnlyGuard(map[string]bool{"/users/exists": true, "/users/names": true}),
+	)
+
+	auth := authRequired([]byte(cfg.JWTSecret))
+
+	limiter := newIPRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst)
+	workers.start("rate-limit-eviction", func(ctx context.Context) {
+		limiter.runEviction(ctx, time.Minute, 10*time.Minute)
+	})
+	rateLimit := limiter.middleware()
 
 	r.GET("/ping", func(c *gin.Context) {
 		c.String(200, "user pong")
 	})
+	r.GET("/healthz", healthz)
+	r.GET("/version", versionInfo)
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	if cfg.EnablePprof {
+		registerPprof(r, auth, adminOnly)
+	}
 
 	r.GET("/users", getAllUsers)
-	r.POST("/users", createUser)
-	r.DELETE("/users/:id", deleteUser)
+	r.GET("/users/count", countUsers)
+	r.GET("/users/search", searchUsers)
+	r.GET("/users/:id", getUserByID)
+	r.POST("/users", rateLimit, auth, createUser)
+	r.POST("/users/bulk", rateLimit, auth, adminOnly, bulkCreateUsers)
+	r.PUT("/users/:id", auth, updateUser)
+	r.POST("/users/:id/rename", auth, updateUser)
+	r.DELETE("/users/:id", auth, deleteUser)
 	r.GET("/users/exists/:id", checkUserExists)
+	r.GET("/users/exists", checkUsersExistQuery)
+	r.POST("/users/exists", checkUsersExist)
+	r.POST("/users/names", lookupUserNames)
+	r.POST("/users/delete-batch", auth, adminOnly, deleteUsersBatch)
+	if cfg.EnableSeed {
+		r.POST("/admin/seed", auth, adminOnly, seedDemoData)
+	}
+	r.GET("/admin/read-only", auth, adminOnly, getReadOnly)
+	r.PUT("/admin/read-only", auth, adminOnly, setReadOnly)
+
+	return r
+}
+
+func connectMongo(cfg Config) (*mongo.Client, error) {
+	clientOpts := options.Client().
+		ApplyURI(cfg.MongoURI).
+		SetMaxPoolSize(uint64(cfg.MongoMaxPoolSize)).
+		SetMinPoolSize(uint64(cfg.MongoMinPoolSize)).
+		SetPoolMonitor(mongoPoolMonitor()).
+		SetMonitor(mongoTracingMonitor())
+	if cfg.MongoTLSCAFile != "" || cfg.MongoTLSCertFile != "" {
+		tlsConfig, err := mongoTLSConfig(cfg.MongoTLSCAFile, cfg.MongoTLSCertFile)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts.SetTLSConfig(tlsConfig)
+	}
+	slog.Info("mongo connection pool configured",
+		"max_pool_size", cfg.MongoMaxPoolSize,
+		"min_pool_size", cfg.MongoMinPoolSize,
+	)
+
+	client, err := mongo.Connect(context.TODO(), clientOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := cfg.MongoConnectRetries
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		err = client.Ping(ctx, nil)
+		cancel()
+		if err == nil {
+			return client, nil
+		}
+		if attempt >= attempts {
+			client.Disconnect(context.TODO())
+			return nil, fmt.Errorf("cannot ping mongo after %d attempts: %w", attempt, err)
+		}
+
+		slog.Warn("mongo ping failed, retrying",
+			"attempt", attempt,
+			"max_attempts", attempts,
+			"retry_in", backoff.String(),
+			"error", err,
+		)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+// prepareIndexes builds every index and only then marks the service ready.
+// main opens its port after this returns, so no request is served, and
+// healthz stays "starting", while an index is missing.
+func prepareIndexes(cfg Config) error {
+	if err := ensureIndexes(cfg); err != nil {
+		return err
 	}
-	r.Run(":" + port)
+	indexesReady.Store(true)
+	return nil
+}
+
+func ensureIndexes(cfg Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.IndexTimeout)
+	defer cancel()
+
+	emailIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().
+			SetName("users_email_unique").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"email": bson.M{"$type": "string"}}),
+	}
+	createdIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}},
+		Options: options.Index().SetName("users_created"),
+	}
+	return errors.Join(
+		createIndex(ctx, userCollection, emailIndex),
+		createIndex(ctx, userCollection, createdIndex),
+	)
+}
+
+func createIndex(ctx context.Context, coll *mongo.Collection, model mongo.IndexModel) error {
+	name, err := coll.Indexes().CreateOne(ctx, model)
+	if err != nil {
+		return fmt.Errorf("cannot create index on %s: %w", coll.Name(), err)
+	}
+	slog.Info("index ready", "collection", coll.Name(), "index", name)
+	return nil
 }
 
 func getAllUsers(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
 	defer cancel()
 
-	cursor, err := userCollection.Find(ctx, bson.M{})
+	limit, offset, err := parsePagination(c)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondError(c, 400, codeBadRequest, err.Error())
+		return
+	}
+
+	created := bson.M{}
+	for _, bound := range []struct{ param, op string }{
+		{"created_after", "$gt"},
+		{"created_before", "$lt"},
+	} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			respondError(c, 400, codeBadRequest, bound.param+" must be an RFC3339 timestamp")
+			return
+		}
+		created[bound.op] = t.UTC()
+	}
+
+	// Users created before created_at existed have no value and only show up
+	// when neither bound is given.
+	filter := bson.M{}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(limit).
+		SetSkip(offset)
+
+	cursor, err := userCollection.Find(ctx, filter, findOpts)
+	if err != nil {
+		respondInternalError(c, err)
 		return
 	}
 	defer cursor.Close(ctx)
 
-	var users []User
+	users := []User{}
 	if err = cursor.All(ctx, &users); err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondInternalError(c, err)
+		return
+	}
+	respondNegotiated(c, 200, gin.H{
+		"users":  users,
+		"limit":  limit,
+		"offset": offset,
+	}, userListXML{Limit: limit, Offset: offset, Users: users})
+}
+
+type userListXML struct {
+	XMLName xml.Name `xml:"users"`
+	Limit   int64    `xml:"limit,attr"`
+	Offset  int64    `xml:"offset,attr"`
+	Users   []User   `xml:"user"`
+}
+
+func countUsers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	count, err := userCollection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"count": count})
+}
+
+func searchUsers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		respondError(c, 400, codeBadRequest, "name is required")
+		return
+	}
+	if utf8.RuneCountInString(name) > 100 {
+		respondError(c, 400, codeBadRequest, "name must be at most 100 characters")
+		return
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondError(c, 400, codeBadRequest, err.Error())
+		return
+	}
+
+	filter := bson.M{"name": bson.M{"$regex": "^" + regexp.QuoteMeta(name), "$options": "i"}}
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(limit).
+		SetSkip(offset)
+
+	cursor, err := userCollection.Find(ctx, filter, findOpts)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	users := []User{}
+	if err = cursor.All(ctx, &users); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"users":  users,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func parsePagination(c *gin.Context) (int64, int64, error) {
+	limit := defaultPageSize
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return 0, 0, errors.New("limit must be an integer")
+		}
+		limit = clampPageSize(v)
+	}
+
+	var offset int64
+	if raw := c.Query("offset"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+		offset = v
+	}
+
+	return limit, offset, nil
+}
+
+func clampPageSize(limit int64) int64 {
+	return min(max(limit, 1), maxPageSize)
+}
+
+func getUserByID(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objID, ok := parseObjectID(c, "id")
+	if !ok {
 		return
 	}
-	c.JSON(200, users)
+
+	var user User
+	err := userCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondError(c, 404, codeNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	respondWithETag(c, user)
 }
 
 func createUser(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
 	defer cancel()
 
+	welcome, err := strconv.ParseBool(c.DefaultQuery("welcome", "false"))
+	if err != nil {
+		respondError(c, 400, codeBadRequest, "welcome must be true or false")
+		return
+	}
+
+	// Decode without binding so the name and email checks below can
+	// report together.
 	var newUser User
-	if err := c.ShouldBindJSON(&newUser); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+	if err := json.NewDecoder(c.Request.Body).Decode(&newUser); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if fieldErrors := newUserFieldErrors(&newUser); fieldErrors != nil {
+		respondFieldErrors(c, fieldErrors)
 		return
 	}
 	newUser.ID = primitive.NewObjectID()
+	newUser.NameHistory = nil
+	newUser.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
 
-	_, err := userCollection.InsertOne(ctx, newUser)
+	if welcome {
+		err = insertUserWithWelcomePost(ctx, newUser)
+	} else {
+		_, err = userCollection.InsertOne(ctx, newUser)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		respondError(c, 409, codeConflict, "email already exists")
+		return
+	}
+	if isTransactionUnsupported(err) {
+		respondError(c, 503, codeUnavailable, "welcome posts require MongoDB to run as a replica set")
+		return
+	}
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondInternalError(c, err)
 		return
 	}
+	c.Header("Location", "/users/"+newUser.ID.Hex())
 	c.JSON(201, newUser)
 }
 
+type bulkResult struct {
+	Index  int                `json:"index"`
+	Status string             `json:"status"`
+	ID     primitive.ObjectID `json:"id,omitzero"`
+	Errors map[string]string  `json:"errors,omitempty"`
+}
 
-func deleteUser(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func bulkCreateUsers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), bulkRequestTimeout)
+	defer cancel()
+
+	var batch []User
+	if err := json.NewDecoder(c.Request.Body).Decode(&batch); err != nil {
+		if respondBodyTooLarge(c, err) {
+			return
+		}
+		respondError(c, 400, codeBadRequest, "body must be a JSON array of users")
+		return
+	}
+	if len(batch) == 0 {
+		respondError(c, 400, codeBadRequest, "batch must not be empty")
+		return
+	}
+	if len(batch) > maxBulkUsers {
+		respondError(c, 400, codeBadRequest, fmt.Sprintf("batch must contain at most %d users", maxBulkUsers))
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	results := make([]bulkResult, len(batch))
+	var docs []any
+	var docIndexes []int
+	for i := range batch {
+		user := &batch[i]
+		results[i] = bulkResult{Index: i, Status: "failed"}
+		if fieldErrors := newUserFieldErrors(user); fieldErrors != nil {
+			results[i].Errors = fieldErrors
+			continue
+		}
+		user.ID = primitive.NewObjectID()
+		user.NameHistory = nil
+		user.CreatedAt = now
+		docs = append(docs, user)
+		docIndexes = append(docIndexes, i)
+	}
+
+	if len(docs) > 0 {
+		failed := map[int]map[string]string{}
+		_, err := userCollection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		var bulkErr mongo.BulkWriteException
+		switch {
+		case errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0:
+			for _, we := range bulkErr.WriteErrors {
+				if mongo.IsDuplicateKeyError(we) {
+					failed[we.Index] = map[string]string{"email": "email already exists"}
+					continue
+				}
+				failed[we.Index] = map[string]string{"insert": we.Message}
+			}
+		case err != nil:
+			respondInternalError(c, err)
+			return
+		}
+
+		for n, i := range docIndexes {
+			if fieldErrors, ok := failed[n]; ok {
+				results[i].Errors = fieldErrors
+				continue
+			}
+			results[i].Status = "created"
+			results[i].ID = batch[i].ID
+		}
+	}
+
+	created := 0
+	for _, r := range results {
+		if r.Status == "created" {
+			created++
+		}
+	}
+
+	status := 201
+	if created < len(results) {
+		status = 207
+	}
+	c.JSON(status, gin.H{
+		"created": created,
+		"failed":  len(results) - created,
+		"results": results,
+	})
+}
+
+func insertUserWithWelcomePost(ctx context.Context, user User) error {
+	session, err := mongoClient.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	content := fmt.Sprintf("Hi %s, this is your first post. Edit or delete it whenever you like.", cmp.Or(user.Name, "there"))
+	post := newStarterPost(primitive.NewObjectID(), user, "Welcome!", content, time.Now())
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		if _, err := userCollection.InsertOne(sc, user); err != nil {
+			return nil, err
+		}
+		return nil, writeStarterPost(sc, post)
+	})
+	return err
+}
+
+// isTransactionUnsupported reports whether err comes from running a
+// transaction against a standalone mongod.
+func isTransactionUnsupported(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 20
+}
+
+func updateUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
 	defer cancel()
 
-	idParam := c.Param("id")
-	objID, err := primitive.ObjectIDFromHex(idParam)
+	objID, ok := parseObjectID(c, "id")
+	if !ok {
+		return
+	}
+	if !isSelfOrAdmin(c, objID.Hex()) {
+		respondError(c, 403, codeForbidden, "only the user or an admin can rename this account")
+		return
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	name, err := normalizeUserName(input.Name)
 	if err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		respondFieldErrors(c, map[string]string{"name": err.Error()})
+		return
+	}
+
+	var updated User
+	err = userCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": objID},
+		renameUpdate(name),
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondError(c, 404, codeNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// Posts keep a copy of the author's name; a failed refresh only leaves
+	// them stale until the next rename or a manual refresh.
+	if err := postService.refreshUserName(ctx, objID.Hex(), c.GetHeader("Authorization")); err != nil {
+		slog.ErrorContext(ctx, "cannot refresh author name on posts", "user_id", objID.Hex(), "error", err)
+	}
+	c.JSON(200, updated)
+}
+
+// renameUpdate sets the new name and appends the previous one to
+// name_history, keeping the last maxNameHistory entries. It is a pipeline so
+// "$name" still refers to the old value.
+func renameUpdate(name string) mongo.Pipeline {
+	previous := bson.A{bson.M{"name": "$name", "changed_at": time.Now().UTC()}}
+	return mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"name": name,
+		"name_history": bson.M{"$slice": bson.A{
+			bson.M{"$concatArrays": bson.A{bson.M{"$ifNull": bson.A{"$name_history", bson.A{}}}, previous}},
+			-maxNameHistory,
+		}},
+	}}}}
+}
+
+func deleteUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objID, ok := parseObjectID(c, "id")
+	if !ok {
+		return
+	}
+	if !isSelfOrAdmin(c, objID.Hex()) {
+		respondError(c, 403, codeForbidden, "only the user or an admin can delete this account")
 		return
 	}
 
 	res, err := userCollection.DeleteOne(ctx, bson.M{"_id": objID})
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondInternalError(c, err)
 		return
 	}
 	if res.DeletedCount == 0 {
-		c.JSON(404, gin.H{"error": "user not found"})
+		respondError(c, 404, codeNotFound, "user not found")
+		return
+	}
+
+	if err := postService.deletePostsByUser(ctx, objID.Hex(), c.GetHeader("Authorization")); err != nil {
+		respondError(c, 502, codeUpstreamUnavailable, "user deleted but cannot delete posts via post-service")
 		return
 	}
 	c.JSON(200, gin.H{"message": "deleted successfully"})
 }
 
-func checkUserExists(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func deleteUsersBatch(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), bulkRequestTimeout)
 	defer cancel()
 
-	idParam := c.Param("id")
-	objID, err := primitive.ObjectIDFromHex(idParam)
+	var body struct {
+		IDs []string `json:"ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if len(body.IDs) > maxBatchDelete {
+		respondError(c, 400, codeBadRequest, fmt.Sprintf("ids must contain at most %d entries", maxBatchDelete))
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
 	if err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		respondError(c, 400, codeBadRequest, "dryRun must be true or false")
+		return
+	}
+
+	invalid := []string{}
+	objIDs := make([]primitive.ObjectID, 0, len(body.IDs))
+	for _, id := range body.IDs {
+		objID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			invalid = append(invalid, id)
+			continue
+		}
+		objIDs = append(objIDs, objID)
+	}
+
+	// Look the users up first so posts are only cascaded for accounts that
+	// actually existed.
+	var found []User
+	if len(objIDs) > 0 {
+		filter := bson.M{"_id": bson.M{"$in": objIDs}}
+		cursor, err := userCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		if err := cursor.All(ctx, &found); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+	}
+
+	deletedIDs := make([]primitive.ObjectID, 0, len(found))
+	for _, u := range found {
+		deletedIDs = append(deletedIDs, u.ID)
+	}
+
+	if dryRun {
+		c.JSON(200, gin.H{
+			"dry_run":            true,
+			"would_delete_count": len(deletedIDs),
+			"invalid_ids":        invalid,
+		})
+		return
+	}
+
+	var deletedCount int64
+	if len(deletedIDs) > 0 {
+		res, err := userCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": deletedIDs}})
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		deletedCount = res.DeletedCount
+	}
+
+	cascadeFailed := []string{}
+	for _, id := range deletedIDs {
+		if err := postService.deletePostsByUser(ctx, id.Hex(), c.GetHeader("Authorization")); err != nil {
+			slog.ErrorContext(ctx, "cannot delete posts for deleted user", "user_id", id.Hex(), "error", err)
+			cascadeFailed = append(cascadeFailed, id.Hex())
+		}
+	}
+
+	status := 200
+	if len(cascadeFailed) > 0 {
+		status = 207
+	}
+	c.JSON(status, gin.H{
+		"deleted_count":           deletedCount,
+		"invalid_ids":             invalid,
+		"post_cleanup_failed_ids": cascadeFailed,
+	})
+}
+
+func checkUserExists(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	objID, ok := parseObjectID(c, "id")
+	if !ok {
 		return
 	}
 
 	count, err := userCollection.CountDocuments(ctx, bson.M{"_id": objID})
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondInternalError(c, err)
 		return
 	}
 
 	c.JSON(200, gin.H{
-		"id":     idParam,
+		"id":     objID.Hex(),
 		"exists": count > 0,
 	})
 }
+
+func checkUsersExist(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	var body struct {
+		IDs []string `json:"ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	results, err := usersExist(ctx, body.IDs)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"results": results})
+}
+
+// checkUsersExistQuery is the GET form of checkUsersExist, taking
+// ?ids=a,b,c so responses can be cached and show up in access logs.
+func checkUsersExistQuery(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	var ids []string
+	for _, id := range strings.Split(c.Query("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		respondError(c, 400, codeBadRequest, "ids is required")
+		return
+	}
+	if len(ids) > maxExistsQueryIDs {
+		respondError(c, 413, codePayloadTooLarge, fmt.Sprintf("ids must contain at most %d entries", maxExistsQueryIDs))
+		return
+	}
+
+	results, err := usersExist(ctx, ids)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"results": results})
+}
+
+// lookupUserNames returns the names of many users in one query, so callers
+// rendering a list of authors need not fetch each user. IDs that are malformed
+// or match no user are left out of names.
+func lookupUserNames(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	var body struct {
+		IDs []string `json:"ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if len(body.IDs) > maxNameLookupIDs {
+		respondError(c, 413, codePayloadTooLarge, fmt.Sprintf("ids must contain at most %d entries", maxNameLookupIDs))
+		return
+	}
+
+	objIDs := make([]primitive.ObjectID, 0, len(body.IDs))
+	for _, id := range body.IDs {
+		if objID, err := primitive.ObjectIDFromHex(id); err == nil {
+			objIDs = append(objIDs, objID)
+		}
+	}
+
+	names := make(map[string]string, len(objIDs))
+	if len(objIDs) > 0 {
+		findOpts := options.Find().SetProjection(bson.M{"_id": 1, "name": 1})
+		cursor, err := userCollection.Find(ctx, bson.M{"_id": bson.M{"$in": objIDs}}, findOpts)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		defer cursor.Close(ctx)
+
+		var found []User
+		if err := cursor.All(ctx, &found); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		for _, user := range found {
+			names[user.ID.Hex()] = user.Name
+		}
+	}
+
+	c.JSON(200, gin.H{"names": names})
+}
+
+func usersExist(ctx context.Context, ids []string) (map[string]bool, error) {
+	results := make(map[string]bool, len(ids))
+	requested := make(map[primitive.ObjectID][]string, len(ids))
+	objIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		results[id] = false
+		objID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			continue
+		}
+		if _, seen := requested[objID]; !seen {
+			objIDs = append(objIDs, objID)
+		}
+		requested[objID] = append(requested[objID], id)
+	}
+
+	if len(objIDs) == 0 {
+		return results, nil
+	}
+
+	findOpts := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := userCollection.Find(ctx, bson.M{"_id": bson.M{"$in": objIDs}}, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var found []User
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	for _, user := range found {
+		for _, id := range requested[user.ID] {
+			results[id] = true
+		}
+	}
+
+	return results, nil
+}
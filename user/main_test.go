@@ -0,0 +1,911 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRenameRequiresSelfOrAdmin(t *testing.T) {
+	r := newTestRouter(t, nil)
+	const target = "64b000000000000000000001"
+	other := bearer(t, "64b000000000000000000002", "")
+
+	for _, route := range []struct{ method, path string }{
+		{"PUT", "/users/" + target},
+		{"POST", "/users/" + target + "/rename"},
+	} {
+		w := serve(r, route.method, route.path, `{"name":"Mallory"}`, "Authorization", other)
+		if w.Code != 403 {
+			t.Errorf("%s %s: status = %d, want 403", route.method, route.path, w.Code)
+		}
+	}
+}
+
+func TestLookupUserNames(t *testing.T) {
+	alice, bob := primitive.NewObjectID(), primitive.NewObjectID()
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(findResponse(t, User{ID: alice, Name: "alice"}))
+
+		body := `{"ids":["` + alice.Hex() + `","` + bob.Hex() + `","bad"]}`
+		w := serve(r, "POST", "/users/names", body)
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var resp struct {
+			Names map[string]string `json:"names"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Names) != 1 || resp.Names[alice.Hex()] != "alice" {
+			t.Errorf("names = %v, want only alice", resp.Names)
+		}
+	})
+}
+
+func TestLookupUserNamesCapsBatch(t *testing.T) {
+	r := newTestRouter(t, nil)
+	ids := make([]string, maxNameLookupIDs+1)
+	for i := range ids {
+		ids[i] = `"` + primitive.NewObjectID().Hex() + `"`
+	}
+	w := serve(r, "POST", "/users/names", `{"ids":[`+strings.Join(ids, ",")+`]}`)
+	if w.Code != 413 {
+		t.Errorf("status = %d, want 413", w.Code)
+	}
+}
+
+func TestDeleteUserCascadesToPosts(t *testing.T) {
+	user := primitive.NewObjectID()
+	token := bearer(t, user.Hex(), "")
+
+	t.Run("deletes posts", func(t *testing.T) {
+		var cascaded string
+		fakePostService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "DELETE" {
+				cascaded = r.URL.Path
+			}
+			if r.Header.Get("Authorization") != token {
+				t.Errorf("Authorization = %q, want the caller's token", r.Header.Get("Authorization"))
+			}
+			w.Write([]byte(`{"deleted_count":2}`))
+		}))
+
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(writeResponse(1))
+
+			w := serve(r, "DELETE", "/users/"+user.Hex(), "", "Authorization", token)
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if want := "/posts/by-user/" + user.Hex(); cascaded != want {
+				t.Errorf("cascade path = %q, want %q", cascaded, want)
+			}
+		})
+	})
+
+	t.Run("post service fails", func(t *testing.T) {
+		fakePostService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(500)
+		}))
+
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(writeResponse(1))
+
+			w := serve(r, "DELETE", "/users/"+user.Hex(), "", "Authorization", token)
+			if w.Code != 502 {
+				t.Errorf("status = %d, want 502", w.Code)
+			}
+		})
+	})
+
+	t.Run("missing user skips cascade", func(t *testing.T) {
+		fakePostService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("unexpected post-service call %s %s", r.Method, r.URL.Path)
+		}))
+
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(writeResponse(0))
+
+			w := serve(r, "DELETE", "/users/"+user.Hex(), "", "Authorization", token)
+			if w.Code != 404 {
+				t.Errorf("status = %d, want 404", w.Code)
+			}
+		})
+	})
+}
+
+func TestDeleteUsersBatchDryRun(t *testing.T) {
+	existing, gone := primitive.NewObjectID(), primitive.NewObjectID()
+	fakePostService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("dry run called the post service: %s %s", r.Method, r.URL.Path)
+	}))
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(findResponse(t, User{ID: existing}))
+
+		body := `{"ids":["` + existing.Hex() + `","` + gone.Hex() + `","nope"]}`
+		w := serve(r, "POST", "/users/delete-batch?dryRun=true", body, "Authorization", bearer(t, primitive.NewObjectID().Hex(), roleAdmin))
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+
+		var resp struct {
+			DryRun           bool     `json:"dry_run"`
+			WouldDeleteCount int      `json:"would_delete_count"`
+			InvalidIDs       []string `json:"invalid_ids"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if !resp.DryRun || resp.WouldDeleteCount != 1 || !slices.Equal(resp.InvalidIDs, []string{"nope"}) {
+			t.Errorf("response = %+v, want a dry run of 1 with nope invalid", resp)
+		}
+		for _, ev := range mt.GetAllStartedEvents() {
+			if ev.CommandName == "delete" {
+				t.Error("dry run deleted users")
+			}
+		}
+	})
+}
+
+func TestCheckUsersExist(t *testing.T) {
+	alice, ghost := primitive.NewObjectID(), primitive.NewObjectID()
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(findResponse(t, User{ID: alice}))
+
+		body := `{"ids":["` + alice.Hex() + `","` + ghost.Hex() + `","not-hex"]}`
+		w := serve(r, "POST", "/users/exists", body)
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var resp struct {
+			Results map[string]bool `json:"results"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]bool{alice.Hex(): true, ghost.Hex(): false, "not-hex": false}
+		if !maps.Equal(resp.Results, want) {
+			t.Errorf("results = %v, want %v", resp.Results, want)
+		}
+	})
+}
+
+func TestCheckUsersExistAllInvalidSkipsQuery(t *testing.T) {
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+
+		w := serve(r, "POST", "/users/exists", `{"ids":["nope"]}`)
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		if n := len(mt.GetAllStartedEvents()); n != 0 {
+			t.Errorf("sent %d commands, want none", n)
+		}
+	})
+}
+
+func TestCheckUsersExistQuery(t *testing.T) {
+	alice, ghost := primitive.NewObjectID(), primitive.NewObjectID()
+
+	t.Run("results", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t, User{ID: alice}))
+
+			w := serve(r, "GET", "/users/exists?ids="+alice.Hex()+",%20"+ghost.Hex()+",,not-hex", "")
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Results map[string]bool `json:"results"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]bool{alice.Hex(): true, ghost.Hex(): false, "not-hex": false}
+			if !maps.Equal(resp.Results, want) {
+				t.Errorf("results = %v, want %v", resp.Results, want)
+			}
+		})
+	})
+
+	r := newTestRouter(t, nil)
+	for _, tc := range []struct {
+		name, query string
+		want        int
+	}{
+		{"missing", "", 400},
+		{"only commas", "?ids=,,", 400},
+		{"over the cap", "?ids=" + strings.Repeat(ghost.Hex()+",", maxExistsQueryIDs) + ghost.Hex(), 413},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := serve(r, "GET", "/users/exists"+tc.query, ""); w.Code != tc.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestCountUsersAfterCreate(t *testing.T) {
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		count := func() int64 {
+			t.Helper()
+			w := serve(r, "GET", "/users/count", "")
+			if w.Code != 200 {
+				t.Fatalf("count status = %d: %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Count int64 `json:"count"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			return resp.Count
+		}
+
+		mt.AddMockResponses(countResponse(2), writeResponse(1), countResponse(3))
+
+		before := count()
+		w := serve(r, "POST", "/users", `{"name":"Dana","email":"dana@example.com"}`,
+			"Authorization", bearer(t, primitive.NewObjectID().Hex(), ""))
+		if w.Code != 201 {
+			t.Fatalf("create status = %d: %s", w.Code, w.Body)
+		}
+		if after := count(); after != before+1 {
+			t.Errorf("count went from %d to %d, want +1", before, after)
+		}
+	})
+}
+
+func TestGetAllUsers(t *testing.T) {
+	// list runs GET /users with query and returns the find command it sent.
+	list := func(t *testing.T, query string) bson.Raw {
+		t.Helper()
+		var find bson.Raw
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, func(cfg *Config) { cfg.MaxPageSize = 50 })
+			mt.AddMockResponses(findResponse(t, User{ID: primitive.NewObjectID(), Name: "Alice"}))
+
+			w := serve(r, "GET", "/users"+query, "")
+			if w.Code != 200 {
+				t.Fatalf("%q: status = %d: %s", query, w.Code, w.Body)
+			}
+			var body struct {
+				Users  []User `json:"users"`
+				Limit  int64  `json:"limit"`
+				Offset int64  `json:"offset"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			find = startedCommand(t, mt, "find")
+			if body.Limit != find.Lookup("limit").AsInt64() || len(body.Users) != 1 {
+				t.Errorf("%q: body = %s, want one user and the limit sent", query, w.Body)
+			}
+			if sort := find.Lookup("sort").Document().String(); sort != `{"created_at": {"$numberInt":"1"},"_id": {"$numberInt":"1"}}` {
+				t.Errorf("%q: sort = %s, want oldest first", query, sort)
+			}
+		})
+		return find
+	}
+	after := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("pagination", func(t *testing.T) {
+		find := list(t, "?limit=10&offset=20")
+		if limit, skip := find.Lookup("limit").AsInt64(), find.Lookup("skip").AsInt64(); limit != 10 || skip != 20 {
+			t.Errorf("limit %d skip %d, want 10 and 20", limit, skip)
+		}
+		if got := list(t, "?limit=1000").Lookup("limit").AsInt64(); got != 50 {
+			t.Errorf("limit = %d, want the cap of 50", got)
+		}
+	})
+
+	t.Run("no bounds", func(t *testing.T) {
+		if _, err := list(t, "").Lookup("filter").Document().LookupErr("created_at"); err == nil {
+			t.Error("filter has created_at without a bound")
+		}
+	})
+
+	for _, tc := range []struct {
+		name, query string
+		gt, lt      time.Time
+	}{
+		{"created_after", "?created_after=2024-05-01T07:00:00%2B07:00", after, time.Time{}},
+		{"created_before", "?created_before=2024-06-01T00:00:00Z", time.Time{}, before},
+		{"both bounds", "?created_after=2024-05-01T00:00:00Z&created_before=2024-06-01T00:00:00Z", after, before},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			created := list(t, tc.query).Lookup("filter", "created_at").Document()
+			for op, want := range map[string]time.Time{"$gt": tc.gt, "$lt": tc.lt} {
+				v, err := created.LookupErr(op)
+				switch {
+				case want.IsZero() && err == nil:
+					t.Errorf("created_at = %s, want no %s", created, op)
+				case !want.IsZero() && (err != nil || !v.Time().Equal(want)):
+					t.Errorf("created_at = %s, want %s %v", created, op, want)
+				}
+			}
+		})
+	}
+
+	t.Run("malformed input", func(t *testing.T) {
+		r := newTestRouter(t, nil)
+		for _, query := range []string{
+			"?created_after=yesterday",
+			"?created_before=2024-06-01",
+			"?created_after=2024-05-01T00:00:00Z&created_before=June",
+			"?limit=ten",
+			"?offset=-1",
+		} {
+			if w := serve(r, "GET", "/users"+query, ""); w.Code != 400 || errorCode(t, w) != codeBadRequest {
+				t.Errorf("%q: status = %d %s, want 400", query, w.Code, w.Body)
+			}
+		}
+	})
+
+	t.Run("created_at set on creation", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			mt.AddMockResponses(writeResponse(1))
+			w := serve(newTestRouter(t, nil), "POST", "/users", `{"name":"Dana","email":"dana@example.com"}`,
+				"Authorization", bearer(t, primitive.NewObjectID().Hex(), ""))
+			if w.Code != 201 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if d := time.Since(insertedDocs(mt)[0].Lookup("created_at").Time()); d < 0 || d > time.Minute {
+				t.Errorf("created_at %v ago, want just now", d)
+			}
+		})
+	})
+}
+
+func TestCreateUserLocation(t *testing.T) {
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(writeResponse(1))
+
+		w := serve(r, "POST", "/users", `{"name":"Dana","email":"dana@example.com"}`,
+			"Authorization", bearer(t, primitive.NewObjectID().Hex(), ""))
+		if w.Code != 201 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var created User
+		if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+			t.Fatal(err)
+		}
+		location := w.Header().Get("Location")
+		if want := "/users/" + created.ID.Hex(); location != want {
+			t.Fatalf("Location = %q, want %q", location, want)
+		}
+
+		// Following the header reaches the new user.
+		mt.AddMockResponses(findResponse(t, created))
+		if w := serve(r, "GET", location, ""); w.Code != 200 || !strings.Contains(w.Body.String(), created.ID.Hex()) {
+			t.Errorf("GET %s = %d %s, want the created user", location, w.Code, w.Body)
+		}
+	})
+}
+
+func TestCreateUserWithWelcomePost(t *testing.T) {
+	const path = "/users?welcome=true"
+	body := `{"name":"Dana","email":"dana@example.com"}`
+	token := bearer(t, primitive.NewObjectID().Hex(), "")
+
+	commands := func(mt *mtest.T) []string {
+		var names []string
+		for _, ev := range mt.GetAllStartedEvents() {
+			names = append(names, ev.CommandName)
+		}
+		return names
+	}
+
+	t.Run("commits both inserts", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(writeResponse(1), writeResponse(1), mtest.CreateSuccessResponse())
+
+			if w := serve(r, "POST", path, body, "Authorization", token); w.Code != 201 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if got, want := commands(mt), []string{"insert", "insert", "commitTransaction"}; !slices.Equal(got, want) {
+				t.Errorf("commands = %v, want %v", got, want)
+			}
+		})
+	})
+
+	t.Run("post insert failure rolls back", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(
+				writeResponse(1),
+				mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 121, Message: "Document failed validation"}),
+				mtest.CreateSuccessResponse(),
+			)
+
+			if w := serve(r, "POST", path, body, "Authorization", token); w.Code != 500 {
+				t.Fatalf("status = %d, want 500: %s", w.Code, w.Body)
+			}
+			if got, want := commands(mt), []string{"insert", "insert", "abortTransaction"}; !slices.Equal(got, want) {
+				t.Errorf("commands = %v, want %v", got, want)
+			}
+		})
+	})
+
+	t.Run("standalone mongod", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(
+				mtest.CreateCommandErrorResponse(mtest.CommandError{
+					Code: 20, Name: "IllegalOperation", Message: "Transaction numbers are only allowed on a replica set member or mongos",
+				}),
+				mtest.CreateSuccessResponse(),
+			)
+
+			if w := serve(r, "POST", path, body, "Authorization", token); w.Code != 503 {
+				t.Errorf("status = %d, want 503: %s", w.Code, w.Body)
+			}
+		})
+	})
+}
+
+func TestBulkCreateUsers(t *testing.T) {
+	admin := bearer(t, primitive.NewObjectID().Hex(), roleAdmin)
+
+	type result struct {
+		Index  int                `json:"index"`
+		Status string             `json:"status"`
+		ID     primitive.ObjectID `json:"id"`
+		Errors map[string]string  `json:"errors"`
+	}
+	// bulk posts body as an admin, answering the insert with reply.
+	bulk := func(t *testing.T, mt *mtest.T, body string, reply bson.D) (int, []result, []bson.Raw) {
+		t.Helper()
+		mt.AddMockResponses(reply)
+		w := serve(newTestRouter(t, nil), "POST", "/users/bulk", body, "Authorization", admin)
+		var resp struct {
+			Results []result `json:"results"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode %s: %v", w.Body, err)
+		}
+		var inserted []bson.Raw
+		if cmds := mt.GetAllStartedEvents(); len(cmds) > 0 {
+			cmd := cmds[0].Command
+			if cmd.Lookup("ordered").Boolean() {
+				t.Error("insert is ordered, so one failure would stop the rest")
+			}
+			values, _ := cmd.Lookup("documents").Array().Values()
+			for _, v := range values {
+				inserted = append(inserted, v.Document())
+			}
+		}
+		return w.Code, resp.Results, inserted
+	}
+
+	t.Run("all valid", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			body := `[{"name":"Alice","email":"alice@example.com"},{"name":"Bob","email":"bob@example.com"}]`
+			code, results, inserted := bulk(t, mt, body, writeResponse(2))
+			if code != 201 || len(results) != 2 || len(inserted) != 2 {
+				t.Fatalf("status = %d, %d results, %d inserted; want 201, 2, 2", code, len(results), len(inserted))
+			}
+			for i, r := range results {
+				if r.Status != "created" || r.ID != inserted[i].Lookup("_id").ObjectID() {
+					t.Errorf("result %d = %+v, want created with the inserted ID", i, r)
+				}
+			}
+		})
+	})
+
+	t.Run("mixed batch", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			body := `[{"name":"Alice","email":"alice@example.com"},
+				{"name":"","email":"not-an-email"},
+				{"name":"Bob","email":"taken@example.com"},
+				{"name":"Carol","email":"carol@example.com"}]`
+			// The invalid item never reaches Mongo, so the duplicate is the
+			// second document sent.
+			reply := mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 1, Code: 11000, Message: "E11000 duplicate key error"})
+			code, results, inserted := bulk(t, mt, body, reply)
+			if code != 207 {
+				t.Fatalf("status = %d, want 207", code)
+			}
+			if len(inserted) != 3 {
+				t.Errorf("inserted %d documents, want the 3 valid ones", len(inserted))
+			}
+
+			var statuses []string
+			for i, r := range results {
+				if r.Index != i {
+					t.Errorf("result %d has index %d", i, r.Index)
+				}
+				statuses = append(statuses, r.Status)
+			}
+			if want := []string{"created", "failed", "failed", "created"}; !slices.Equal(statuses, want) {
+				t.Fatalf("statuses = %v, want %v", statuses, want)
+			}
+			if results[1].Errors["name"] == "" || results[1].Errors["email"] == "" {
+				t.Errorf("invalid item errors = %v, want name and email", results[1].Errors)
+			}
+			if got := results[2].Errors["email"]; got != "email already exists" {
+				t.Errorf("duplicate item errors = %v, want the email conflict", results[2].Errors)
+			}
+			if !results[1].ID.IsZero() || !results[2].ID.IsZero() {
+				t.Errorf("failed items carry IDs: %+v", results)
+			}
+		})
+	})
+
+	t.Run("admins only", func(t *testing.T) {
+		w := serve(newTestRouter(t, nil), "POST", "/users/bulk", `[{"name":"Alice","email":"alice@example.com"}]`,
+			"Authorization", bearer(t, primitive.NewObjectID().Hex(), ""))
+		if w.Code != 403 {
+			t.Errorf("status = %d, want 403", w.Code)
+		}
+	})
+}
+
+func TestSearchUsersByPrefix(t *testing.T) {
+	// search runs the handler for query and returns the regex it sent, with
+	// Mongo's "i" option folded in so Go can evaluate it.
+	search := func(t *testing.T, query string) *regexp.Regexp {
+		t.Helper()
+		var re *regexp.Regexp
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t))
+
+			w := serve(r, "GET", "/users/search?"+query, "")
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			name := startedCommand(t, mt, "find").Lookup("filter", "name").Document()
+			if opts := name.Lookup("$options").StringValue(); opts != "i" {
+				t.Errorf("$options = %q, want i", opts)
+			}
+			re = regexp.MustCompile("(?i)" + name.Lookup("$regex").StringValue())
+		})
+		return re
+	}
+
+	for _, tc := range []struct {
+		name, query, input string
+		match              bool
+	}{
+		{"prefix", "name=ali", "Alice", true},
+		{"not a prefix", "name=ice", "Alice", false},
+		{"case-insensitive", "name=ALI", "alice", true},
+		{"dot is literal", "name=a.c", "abc", false},
+		{"dot matches itself", "name=a.c", "a.c user", true},
+		{"metacharacters are literal", "name=" + url.QueryEscape("(a+)+$"), "aaaaaaaaaaaaaaaaaaaaaaaa!", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := search(t, tc.query).MatchString(tc.input); got != tc.match {
+				t.Errorf("%s against %q = %t, want %t", tc.query, tc.input, got, tc.match)
+			}
+		})
+	}
+
+	t.Run("limit is capped", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t))
+
+			serve(r, "GET", "/users/search?name=a&limit=100000", "")
+			if got := startedCommand(t, mt, "find").Lookup("limit").AsInt64(); got != maxPageSize {
+				t.Errorf("limit = %d, want %d", got, maxPageSize)
+			}
+		})
+	})
+
+	t.Run("name required", func(t *testing.T) {
+		r := newTestRouter(t, nil)
+		if w := serve(r, "GET", "/users/search?name=+", ""); w.Code != 400 {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+	})
+}
+
+func TestDeleteUsersBatch(t *testing.T) {
+	kept, gone, broken := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	admin := bearer(t, primitive.NewObjectID().Hex(), roleAdmin)
+
+	var mu sync.Mutex
+	var cascaded []string
+	fakePostService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method != "DELETE" || r.Header.Get("Authorization") != admin {
+			t.Errorf("cascade %s %s with Authorization %q", r.Method, r.URL.Path, r.Header.Get("Authorization"))
+		}
+		cascaded = append(cascaded, strings.TrimPrefix(r.URL.Path, "/posts/by-user/"))
+		if r.URL.Path == "/posts/by-user/"+broken.Hex() {
+			w.WriteHeader(500)
+		}
+	}))
+
+	type response struct {
+		DeletedCount  int64    `json:"deleted_count"`
+		WouldDelete   int64    `json:"would_delete_count"`
+		InvalidIDs    []string `json:"invalid_ids"`
+		CleanupFailed []string `json:"post_cleanup_failed_ids"`
+	}
+	run := func(t *testing.T, query, body string, found ...any) (int, response) {
+		t.Helper()
+		var resp response
+		var code int
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(findResponse(t, found...), writeResponse(len(found)))
+			w := serve(r, "POST", "/users/delete-batch"+query, body, "Authorization", admin)
+			code = w.Code
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %s: %v", w.Body, err)
+			}
+			if query == "" {
+				ids, _ := startedCommand(t, mt, "delete").Lookup("deletes", "0", "q", "_id", "$in").Array().Values()
+				if len(ids) != len(found) {
+					t.Errorf("deleted %d ids, want only the %d that exist", len(ids), len(found))
+				}
+			}
+		})
+		return code, resp
+	}
+
+	t.Run("mixed batch", func(t *testing.T) {
+		cascaded = nil
+		body := `{"ids":["` + kept.Hex() + `","` + gone.Hex() + `","not-an-id"]}`
+		code, resp := run(t, "", body, User{ID: kept})
+		if code != 200 || resp.DeletedCount != 1 || !slices.Equal(resp.InvalidIDs, []string{"not-an-id"}) || len(resp.CleanupFailed) != 0 {
+			t.Errorf("status %d, body %+v; want 1 deleted and not-an-id skipped", code, resp)
+		}
+		if !slices.Equal(cascaded, []string{kept.Hex()}) {
+			t.Errorf("cascaded to %v, want only the deleted user", cascaded)
+		}
+	})
+
+	t.Run("cascade partly fails", func(t *testing.T) {
+		cascaded = nil
+		body := `{"ids":["` + kept.Hex() + `","` + broken.Hex() + `"]}`
+		code, resp := run(t, "", body, User{ID: kept}, User{ID: broken})
+		if code != 207 || resp.DeletedCount != 2 || !slices.Equal(resp.CleanupFailed, []string{broken.Hex()}) {
+			t.Errorf("status %d, body %+v; want 207 naming %s", code, resp, broken.Hex())
+		}
+		if len(cascaded) != 2 {
+			t.Errorf("cascaded to %v, want both users", cascaded)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		cascaded = nil
+		code, resp := run(t, "?dryRun=true", `{"ids":["`+kept.Hex()+`"]}`, User{ID: kept})
+		if code != 200 || resp.WouldDelete != 1 || len(cascaded) != 0 {
+			t.Errorf("status %d, body %+v, cascaded %v; want a count and no deletes", code, resp, cascaded)
+		}
+	})
+
+	r := newTestRouter(t, nil)
+	body := `{"ids":["` + kept.Hex() + `"]}`
+	if w := serve(r, "POST", "/users/delete-batch", body, "Authorization", bearer(t, kept.Hex(), "")); w.Code != 403 {
+		t.Errorf("non-admin: status = %d, want 403", w.Code)
+	}
+	if w := serve(r, "POST", "/users/delete-batch", body); w.Code != 401 {
+		t.Errorf("anonymous: status = %d, want 401", w.Code)
+	}
+}
+
+// evalRename applies a renameUpdate pipeline to doc the way MongoDB would,
+// covering only the operators it uses, so the cap can be checked without a
+// server.
+func evalRename(t *testing.T, doc bson.M, pipeline mongo.Pipeline) bson.M {
+	t.Helper()
+	var eval func(expr any) any
+	eval = func(expr any) any {
+		switch e := expr.(type) {
+		case string:
+			if field, ok := strings.CutPrefix(e, "$"); ok {
+				return doc[field]
+			}
+			return e
+		case bson.A:
+			out := bson.A{}
+			for _, v := range e {
+				out = append(out, eval(v))
+			}
+			return out
+		case bson.M:
+			if args, ok := e["$ifNull"].(bson.A); ok {
+				if v := eval(args[0]); v != nil {
+					return v
+				}
+				return eval(args[1])
+			}
+			if args, ok := e["$concatArrays"].(bson.A); ok {
+				out := bson.A{}
+				for _, arr := range args {
+					out = append(out, eval(arr).(bson.A)...)
+				}
+				return out
+			}
+			if args, ok := e["$slice"].(bson.A); ok {
+				arr, n := eval(args[0]).(bson.A), args[1].(int)
+				if n < 0 && -n < len(arr) {
+					return arr[len(arr)+n:]
+				}
+				return arr
+			}
+			out := bson.M{}
+			for k, v := range e {
+				out[k] = eval(v)
+			}
+			return out
+		}
+		return expr
+	}
+
+	set := pipeline[0][0]
+	if set.Key != "$set" || len(pipeline) != 1 {
+		t.Fatalf("pipeline = %v, want a single $set stage", pipeline)
+	}
+	next := maps.Clone(doc)
+	for field, expr := range set.Value.(bson.M) {
+		next[field] = eval(expr)
+	}
+	return next
+}
+
+func TestRenameKeepsCappedHistory(t *testing.T) {
+	doc := bson.M{"name": "name 0"}
+	renames := maxNameHistory + 3
+	for i := 1; i <= renames; i++ {
+		doc = evalRename(t, doc, renameUpdate(fmt.Sprintf("name %d", i)))
+	}
+
+	history := doc["name_history"].(bson.A)
+	if len(history) != maxNameHistory {
+		t.Fatalf("after %d renames history has %d entries, want %d", renames, len(history), maxNameHistory)
+	}
+	// The oldest names fall off; the last maxNameHistory previous names stay
+	// in order, ending with the one just replaced.
+	for i, entry := range history {
+		want := fmt.Sprintf("name %d", renames-maxNameHistory+i)
+		if got := entry.(bson.M)["name"]; got != want {
+			t.Errorf("history[%d] = %v, want %q", i, got, want)
+		}
+		if _, ok := entry.(bson.M)["changed_at"].(time.Time); !ok {
+			t.Errorf("history[%d] has no changed_at", i)
+		}
+	}
+	if doc["name"] != fmt.Sprintf("name %d", renames) {
+		t.Errorf("name = %v, want the latest", doc["name"])
+	}
+}
+
+func TestRenameUserReturnsHistory(t *testing.T) {
+	user := primitive.NewObjectID()
+	fakePostService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		changed := time.Now().UTC().Truncate(time.Millisecond)
+		updated := User{ID: user, Name: "Dana B", Email: "dana@example.com", NameHistory: []nameChange{{Name: "Dana", ChangedAt: changed}}}
+		raw, err := bson.Marshal(updated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.Raw(raw)}))
+
+		w := serve(r, "POST", "/users/"+user.Hex()+"/rename", `{"name":" Dana  B "}`, "Authorization", bearer(t, user.Hex(), ""))
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var got User
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != "Dana B" || len(got.NameHistory) != 1 || got.NameHistory[0].Name != "Dana" {
+			t.Errorf("returned %+v, want the renamed user with its history", got)
+		}
+
+		sent := startedCommand(t, mt, "findAndModify")
+		if sent.Lookup("update").Type != bson.TypeArray {
+			t.Errorf("update %s is not a pipeline", sent.Lookup("update"))
+		}
+		if name := sent.Lookup("update", "0", "$set", "name").StringValue(); name != "Dana B" {
+			t.Errorf("new name = %q, want it normalized", name)
+		}
+	})
+}
+
+func TestIndexesGateReadiness(t *testing.T) {
+	// createIndexes counts the index builds the mock was asked for.
+	createIndexes := func(mt *mtest.T) int {
+		n := 0
+		for _, ev := range mt.GetAllStartedEvents() {
+			if ev.CommandName == "createIndexes" {
+				n++
+			}
+		}
+		return n
+	}
+	t.Cleanup(func() { indexesReady.Store(false) })
+
+	t.Run("failed index keeps the service starting", func(t *testing.T) {
+		indexesReady.Store(false)
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+				Code: 11000, Name: "DuplicateKey", Message: "E11000 duplicate key error",
+			}))
+			for range 20 {
+				mt.AddMockResponses(mtest.CreateSuccessResponse())
+			}
+
+			err := prepareIndexes(testConfig(t))
+			if err == nil || !strings.Contains(err.Error(), "cannot create index") {
+				t.Fatalf("prepareIndexes = %v, want the index error that stops main", err)
+			}
+			if indexesReady.Load() {
+				t.Error("ready after a failed index build")
+			}
+			w := serve(newTestRouter(t, nil), "GET", "/healthz", "")
+			if w.Code != 503 || !strings.Contains(w.Body.String(), `"starting"`) {
+				t.Errorf("healthz = %d %s, want 503 starting", w.Code, w.Body)
+			}
+		})
+	})
+
+	t.Run("ready once every index is built", func(t *testing.T) {
+		indexesReady.Store(false)
+		var logs bytes.Buffer
+		previous := slog.Default()
+		slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+		t.Cleanup(func() { slog.SetDefault(previous) })
+
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			for range 20 {
+				mt.AddMockResponses(mtest.CreateSuccessResponse())
+			}
+			w := serve(newTestRouter(t, nil), "GET", "/healthz", "")
+			if w.Code != 503 {
+				t.Errorf("healthz before indexes = %d, want 503", w.Code)
+			}
+
+			if err := prepareIndexes(testConfig(t)); err != nil {
+				t.Fatalf("prepareIndexes: %v", err)
+			}
+			if !indexesReady.Load() {
+				t.Error("not ready after every index was built")
+			}
+			if built, logged := createIndexes(mt), strings.Count(logs.String(), "index ready"); built == 0 || logged != built {
+				t.Errorf("built %d indexes but logged %d", built, logged)
+			}
+		})
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Total number of HTTP requests handled.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpInflightRequests = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_inflight_requests",
+		Help: "HTTP requests currently being handled.",
+	})
+
+	mongoPoolOpenConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mongo_pool_open_connections",
+		Help: "Connections currently open in the Mongo driver pool.",
+	})
+
+	mongoPoolInUseConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mongo_pool_in_use_connections",
+		Help: "Connections currently checked out of the Mongo driver pool.",
+	})
+)
+
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		// Deferred so the gauge comes back down even if the chain panics.
+		httpInflightRequests.Inc()
+		defer httpInflightRequests.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		httpRequestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+func mongoPoolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				mongoPoolOpenConnections.Inc()
+			case event.ConnectionClosed:
+				mongoPoolOpenConnections.Dec()
+			case event.GetSucceeded:
+				mongoPoolInUseConnections.Inc()
+			case event.ConnectionReturned:
+				mongoPoolInUseConnections.Dec()
+			}
+		},
+	}
+}
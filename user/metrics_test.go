@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func inflight(t *testing.T) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := httpInflightRequests.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func TestInflightRequests(t *testing.T) {
+	const concurrent = 5
+	var entered sync.WaitGroup
+	entered.Add(concurrent)
+	release := make(chan struct{})
+
+	r := gin.New()
+	r.Use(jsonRecovery(), metricsMiddleware())
+	r.GET("/slow", func(c *gin.Context) {
+		entered.Done()
+		<-release
+		c.Status(204)
+	})
+	r.GET("/abort", func(c *gin.Context) { c.AbortWithStatus(403) })
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	base := inflight(t)
+
+	var done sync.WaitGroup
+	for range concurrent {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+		}()
+	}
+	entered.Wait()
+	if got := inflight(t) - base; got != concurrent {
+		t.Errorf("in flight = %v while %d requests wait, want %d", got, concurrent, concurrent)
+	}
+
+	close(release)
+	done.Wait()
+	if got := inflight(t) - base; got != 0 {
+		t.Errorf("in flight = %v after the requests finished, want 0", got)
+	}
+
+	for _, path := range []string{"/abort", "/panic"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code == 200 {
+			t.Errorf("%s status = 200", path)
+		}
+		if got := inflight(t) - base; got != 0 {
+			t.Errorf("in flight = %v after %s, want 0", got, path)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// mongoTLSConfig builds the TLS settings for a Mongo deployment whose CA is
+// not in the system pool or that wants a client certificate. certKeyFile is
+// a single PEM holding both the certificate and its key, the same form
+// mongosh takes for --tlsCertificateKeyFile.
+func mongoTLSConfig(caFile, certKeyFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read MONGO_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("MONGO_TLS_CA_FILE %s contains no PEM certificates", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certKeyFile, certKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load MONGO_TLS_CERT_KEY_FILE: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetAllUsersNegotiatesFormat(t *testing.T) {
+	user := User{ID: primitive.NewObjectID(), Name: "Alice", Email: "alice@example.com"}
+
+	for _, tc := range []struct {
+		accept string
+		xml    bool
+	}{
+		{"application/xml", true},
+		{"text/xml", true},
+		{"application/xml;q=0.9, application/json;q=0.1", true},
+		{"application/json", false},
+		{"*/*", false},
+		{"text/html", false},
+		{"", false},
+	} {
+		t.Run(cmp.Or(tc.accept, "no accept"), func(t *testing.T) {
+			withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+				r := newTestRouter(t, nil)
+				mt.AddMockResponses(findResponse(t, user))
+
+				var header []string
+				if tc.accept != "" {
+					header = []string{"Accept", tc.accept}
+				}
+				w := serve(r, "GET", "/users?limit=5", "", header...)
+				if w.Code != 200 {
+					t.Fatalf("status = %d: %s", w.Code, w.Body)
+				}
+				if vary := w.Header().Get("Vary"); !strings.Contains(vary, "Accept") {
+					t.Errorf("Vary = %q, want Accept", vary)
+				}
+
+				contentType := w.Header().Get("Content-Type")
+				var got []User
+				var limit int64
+				if tc.xml {
+					if !strings.Contains(contentType, "xml") {
+						t.Fatalf("Content-Type = %q, want XML", contentType)
+					}
+					var body userListXML
+					if err := xml.Unmarshal(w.Body.Bytes(), &body); err != nil {
+						t.Fatalf("decode XML %s: %v", w.Body, err)
+					}
+					got, limit = body.Users, body.Limit
+				} else {
+					if !strings.HasPrefix(contentType, "application/json") {
+						t.Fatalf("Content-Type = %q, want JSON", contentType)
+					}
+					var body struct {
+						Users []User `json:"users"`
+						Limit int64  `json:"limit"`
+					}
+					if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+						t.Fatalf("decode JSON %s: %v", w.Body, err)
+					}
+					got, limit = body.Users, body.Limit
+				}
+				if len(got) != 1 || got[0].ID != user.ID || got[0].Email != user.Email || limit != 5 {
+					t.Errorf("users = %+v, limit %d; want Alice and 5", got, limit)
+				}
+			})
+		})
+	}
+
+	t.Run("errors stay JSON", func(t *testing.T) {
+		w := serve(newTestRouter(t, nil), "GET", "/users?limit=abc", "", "Accept", "application/xml")
+		if w.Code != 400 || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+			t.Errorf("status = %d, Content-Type %q; want a JSON 400", w.Code, w.Header().Get("Content-Type"))
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+var postService *postServiceClient
+
+type postServiceClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+func newPostServiceClient(baseURL string, timeout time.Duration) *postServiceClient {
+	return &postServiceClient{
+		baseURL: baseURL,
+		http: &http.Client{
+			Timeout:   timeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+}
+
+func (p *postServiceClient) deletePostsByUser(ctx context.Context, userID, authorization string) error {
+	url := fmt.Sprintf("%s/posts/by-user/%s", p.baseURL, userID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	if id := requestIDFromContext(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("post-service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// refreshUserName asks the post service to re-copy the user's current name
+// onto their posts.
+func (p *postServiceClient) refreshUserName(ctx context.Context, userID, authorization string) error {
+	url := fmt.Sprintf("%s/posts/by-user/%s/refresh-name", p.baseURL, userID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	if id := requestIDFromContext(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("post-service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
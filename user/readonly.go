@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readOnly rejects writes while set. It starts from READ_ONLY and admins can
+// flip it at runtime through /admin/read-only; each instance keeps its own.
+var readOnly atomic.Bool
+
+// readOnlyGuard answers 503 to mutating requests while readOnly is set. GET,
+// HEAD and OPTIONS always pass, as do the POST routes listed in reads, which
+// only query, and the toggle itself so the mode can be switched off again.
+func readOnlyGuard(reads map[string]bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !readOnly.Load() {
+			c.Next()
+			return
+		}
+
+		switch c.Request.Method {
+		case "GET", "HEAD", "OPTIONS":
+		default:
+			path := c.FullPath()
+			if path != "" && path != "/admin/read-only" && !reads[path] {
+				respondError(c, 503, codeReadOnly, "service is in read-only maintenance mode; writes are disabled")
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func getReadOnly(c *gin.Context) {
+	c.JSON(200, gin.H{"read_only": readOnly.Load()})
+}
+
+func setReadOnly(c *gin.Context) {
+	var input struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if readOnly.Swap(*input.Enabled) != *input.Enabled {
+		slog.WarnContext(c.Request.Context(), "read-only mode changed", "read_only", *input.Enabled, "by", c.GetString(authSubjectKey))
+	}
+	c.JSON(200, gin.H{"read_only": *input.Enabled})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestReadOnlyMode(t *testing.T) {
+	t.Cleanup(func() { readOnly.Store(false) })
+	userID := primitive.NewObjectID()
+	path := "/users/" + userID.Hex()
+	admin := bearer(t, "64b0000000000000000000ad", roleAdmin)
+	create := `{"name":"Alice","email":"alice@example.com"}`
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, func(cfg *Config) { cfg.ReadOnly = true })
+
+		for _, tc := range []struct{ method, path, body string }{
+			{"POST", "/users", create},
+			{"PUT", path, `{"name":"Alicia"}`},
+			{"DELETE", path, ""},
+		} {
+			w := serve(r, tc.method, tc.path, tc.body, "Authorization", admin)
+			if w.Code != 503 || errorCode(t, w) != codeReadOnly {
+				t.Errorf("%s %s: status = %d, body %s; want 503 %s", tc.method, tc.path, w.Code, w.Body, codeReadOnly)
+			}
+		}
+		if n := len(mt.GetAllStartedEvents()); n != 0 {
+			t.Fatalf("blocked writes sent %d commands", n)
+		}
+
+		mt.AddMockResponses(findResponse(t, User{ID: userID, Name: "Alice"}), findResponse(t))
+		if w := serve(r, "GET", path, ""); w.Code != 200 {
+			t.Errorf("GET status = %d, want 200: %s", w.Code, w.Body)
+		}
+		if w := serve(r, "POST", "/users/exists", `{"ids":["`+userID.Hex()+`"]}`); w.Code != 200 {
+			t.Errorf("POST /users/exists status = %d, want 200: %s", w.Code, w.Body)
+		}
+
+		if w := serve(r, "PUT", "/admin/read-only", `{"enabled":false}`, "Authorization", bearer(t, userID.Hex(), "")); w.Code != 403 {
+			t.Errorf("non-admin toggle status = %d, want 403", w.Code)
+		}
+		if w := serve(r, "PUT", "/admin/read-only", `{"enabled":false}`, "Authorization", admin); w.Code != 200 {
+			t.Fatalf("toggle status = %d: %s", w.Code, w.Body)
+		}
+		mt.AddMockResponses(writeResponse(1))
+		if w := serve(r, "POST", "/users", create, "Authorization", admin); w.Code != 201 {
+			t.Errorf("POST after leaving read-only = %d, want 201: %s", w.Code, w.Body)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type seedUser struct {
+	ID    string
+	Name  string
+	Email string
+	Posts []seedPost
+}
+
+type seedPost struct {
+	ID      string
+	Title   string
+	Content string
+}
+
+// seedUsers is the fixed demo data set. Users are keyed by email and posts by
+// their ObjectID, so seeding again only fills in what is missing.
+var seedUsers = []seedUser{
+	{ID: "5eed00000000000000000001", Name: "Alice Nguyen", Email: "alice@example.com", Posts: []seedPost{
+		{ID: "5eed00000000000000000101", Title: "Hello from Alice", Content: "First post on the demo instance."},
+		{ID: "5eed00000000000000000102", Title: "Weekend plans", Content: "Hiking if the weather holds."},
+	}},
+	{ID: "5eed00000000000000000002", Name: "Bao Tran", Email: "bao@example.com", Posts: []seedPost{
+		{ID: "5eed00000000000000000201", Title: "Docker networking notes", Content: "Bridge networks give each compose project its own DNS."},
+	}},
+	{ID: "5eed00000000000000000003", Name: "Chi Le", Email: "chi@example.com", Posts: []seedPost{
+		{ID: "5eed00000000000000000301", Title: "Reading list", Content: "Designing Data-Intensive Applications, again."},
+		{ID: "5eed00000000000000000302", Title: "Nginx tips", Content: "proxy_pass without a trailing slash keeps the request path."},
+	}},
+}
+
+func seedDemoData(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+	defer cancel()
+
+	usersCreated := []string{}
+	postsCreated := []string{}
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	for _, su := range seedUsers {
+		seedID, _ := primitive.ObjectIDFromHex(su.ID)
+
+		// Upsert by email so a demo user someone already created by hand is
+		// reused rather than colliding with the unique email index.
+		res, err := userCollection.UpdateOne(ctx,
+			bson.M{"email": su.Email},
+			bson.M{"$setOnInsert": bson.M{"_id": seedID, "name": su.Name, "created_at": now}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		if res.UpsertedCount > 0 {
+			usersCreated = append(usersCreated, su.ID)
+		}
+
+		var user User
+		if err := userCollection.FindOne(ctx, bson.M{"email": su.Email}).Decode(&user); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+
+		for _, sp := range su.Posts {
+			postID, _ := primitive.ObjectIDFromHex(sp.ID)
+			post := newStarterPost(postID, user, sp.Title, sp.Content, now)
+			// Seed posts go through the same path as welcome posts, so they get
+			// a slug and an outbox event too. A duplicate _id means an earlier
+			// run already created this one.
+			err := createStarterPost(ctx, post)
+			if mongo.IsDuplicateKeyError(err) {
+				continue
+			}
+			if isTransactionUnsupported(err) {
+				respondError(c, 503, codeUnavailable, "seeding with the outbox enabled requires MongoDB to run as a replica set")
+				return
+			}
+			if err != nil {
+				respondInternalError(c, err)
+				return
+			}
+			postsCreated = append(postsCreated, sp.ID)
+		}
+	}
+
+	c.JSON(200, gin.H{
+		"users_created": usersCreated,
+		"posts_created": postsCreated,
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSeedDemoData(t *testing.T) {
+	token := bearer(t, primitive.NewObjectID().Hex(), roleAdmin)
+	enableSeed := func(cfg *Config) { cfg.EnableSeed = true }
+
+	// seed queues the replies to one run: each user is upserted (created
+	// when upserted is set) and read back, then its posts are inserted,
+	// failing with a duplicate key when postsExist.
+	seed := func(t *testing.T, mt *mtest.T, upserted, postsExist bool) (users, posts []string) {
+		t.Helper()
+		for _, su := range seedUsers {
+			id, _ := primitive.ObjectIDFromHex(su.ID)
+			update := writeResponse(1)
+			if upserted {
+				update = mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1},
+					bson.E{Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 0}, {Key: "_id", Value: id}}}})
+			}
+			mt.AddMockResponses(update, findResponse(t, User{ID: id, Name: su.Name, Email: su.Email}))
+			for range su.Posts {
+				if postsExist {
+					mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "duplicate key"}))
+				} else {
+					mt.AddMockResponses(writeResponse(1))
+				}
+			}
+		}
+
+		w := serve(newTestRouter(t, enableSeed), "POST", "/admin/seed", "", "Authorization", token)
+		if w.Code != 200 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var body struct {
+			Users []string `json:"users_created"`
+			Posts []string `json:"posts_created"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return body.Users, body.Posts
+	}
+
+	t.Run("first run creates everything", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			users, posts := seed(t, mt, true, false)
+			if len(users) != len(seedUsers) || len(posts) != 5 {
+				t.Errorf("created %d users and %d posts, want %d and 5", len(users), len(posts), len(seedUsers))
+			}
+			for _, doc := range insertedDocs(mt) {
+				id := doc.Lookup("_id").ObjectID()
+				if slug := doc.Lookup("slug").StringValue(); slug == "" || slug[len(slug)-24:] != id.Hex() {
+					t.Errorf("post %s slug = %q, want one ending in its ID", id.Hex(), slug)
+				}
+			}
+		})
+	})
+
+	t.Run("second run is a no-op", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			users, posts := seed(t, mt, false, true)
+			if len(users) != 0 || len(posts) != 0 {
+				t.Errorf("created users %v and posts %v, want none", users, posts)
+			}
+		})
+	})
+
+	t.Run("not registered unless enabled", func(t *testing.T) {
+		if w := serve(newTestRouter(t, nil), "POST", "/admin/seed", "", "Authorization", token); w.Code != 404 {
+			t.Errorf("status = %d, want 404", w.Code)
+		}
+	})
+}
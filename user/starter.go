@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The user service writes starter posts, the welcome post and the demo seed
+// posts, straight into the post service's collection. The post service never
+// sees them go in, so everything here has to leave them looking as if they
+// had been created through POST /posts:
+//
+//   - title and content are plain text with all markup stripped, which is how
+//     the post service stores them under its default strict content policy;
+//   - slug is set and unique: the title's slug followed by the post's own
+//     ObjectID, so it cannot collide with a slug the post service allocated;
+//   - when OUTBOX_COLLECTION is set, a post.created event is written in the
+//     same transaction as the post, shaped like the post service's own.
+//
+// The tests in starter_test.go pin each of these.
+
+const eventPostCreated = "post.created"
+
+// outboxCollection is the post service's outbox. It is nil unless
+// OUTBOX_COLLECTION is set, and starter posts are then written without events.
+var outboxCollection *mongo.Collection
+
+var plainTextPolicy = bluemonday.StrictPolicy()
+
+// starterPost mirrors the post-service document shape.
+type starterPost struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	UserID    string             `bson:"user_id"`
+	UserName  string             `bson:"user_name,omitempty"`
+	Title     string             `bson:"title"`
+	Content   string             `bson:"content"`
+	Slug      string             `bson:"slug"`
+	CreatedAt time.Time          `bson:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at"`
+	Likes     int                `bson:"likes"`
+	Published bool               `bson:"published"`
+	Version   int                `bson:"version"`
+}
+
+// starterEvent mirrors the post service's outbox document.
+type starterEvent struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Type        string             `bson:"type"`
+	AggregateID primitive.ObjectID `bson:"aggregate_id"`
+	Payload     starterPost        `bson:"payload"`
+	CreatedAt   time.Time          `bson:"created_at"`
+}
+
+func newStarterPost(id primitive.ObjectID, user User, title, content string, now time.Time) starterPost {
+	now = now.UTC().Truncate(time.Millisecond)
+	title = stripMarkup(title)
+	return starterPost{
+		ID:        id,
+		UserID:    user.ID.Hex(),
+		UserName:  user.Name,
+		Title:     title,
+		Content:   stripMarkup(content),
+		Slug:      starterSlug(title, id),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Published: true,
+		Version:   1,
+	}
+}
+
+// writeStarterPost inserts post and, when the outbox is enabled, its
+// post.created event. The caller runs it inside a transaction whenever
+// outboxCollection is set.
+func writeStarterPost(ctx context.Context, post starterPost) error {
+	if _, err := postCollection.InsertOne(ctx, post); err != nil {
+		return err
+	}
+	if outboxCollection == nil {
+		return nil
+	}
+	_, err := outboxCollection.InsertOne(ctx, starterEvent{
+		ID:          primitive.NewObjectID(),
+		Type:        eventPostCreated,
+		AggregateID: post.ID,
+		Payload:     post,
+		CreatedAt:   time.Now().UTC(),
+	})
+	return err
+}
+
+// createStarterPost writes post on its own, in a transaction when the outbox
+// is enabled so the post and its event are kept or dropped together.
+func createStarterPost(ctx context.Context, post starterPost) error {
+	if outboxCollection == nil {
+		return writeStarterPost(ctx, post)
+	}
+
+	session, err := mongoClient.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		return nil, writeStarterPost(sc, post)
+	})
+	return err
+}
+
+// stripMarkup removes markup until none is left, so entity-encoded tags
+// cannot survive as text and turn back into markup when rendered.
+func stripMarkup(s string) string {
+	for range 4 {
+		decoded := html.UnescapeString(plainTextPolicy.Sanitize(s))
+		if decoded == s {
+			return decoded
+		}
+		s = decoded
+	}
+	return plainTextPolicy.Sanitize(s)
+}
+
+// starterSlug lowercases title, joins its ASCII letter and digit runs with
+// hyphens and appends id. Starter titles are fixed English text, so this
+// skips the post service's accent folding.
+func starterSlug(title string, id primitive.ObjectID) string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return r >= unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	return strings.Join(append(words, id.Hex()), "-")
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// insertedDocs returns the first document of every insert the handler sent,
+// in order.
+func insertedDocs(mt *mtest.T) []bson.Raw {
+	var docs []bson.Raw
+	for _, ev := range mt.GetAllStartedEvents() {
+		if ev.CommandName == "insert" {
+			docs = append(docs, ev.Command.Lookup("documents").Array().Index(0).Value().Document())
+		}
+	}
+	return docs
+}
+
+func TestNewStarterPost(t *testing.T) {
+	user := User{ID: primitive.NewObjectID(), Name: "Dana"}
+	id := primitive.NewObjectID()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.FixedZone("ICT", 7*3600))
+
+	post := newStarterPost(id, user, "<b>Hello</b> &lt;script&gt;alert(1)&lt;/script&gt;world",
+		"Hi <img src=x onerror=alert(1)>Dana &amp; friends", now)
+
+	if strings.ContainsAny(post.Title, "<>") || strings.ContainsAny(post.Content, "<>") {
+		t.Errorf("markup survived: title %q, content %q", post.Title, post.Content)
+	}
+	if post.Content != "Hi Dana & friends" {
+		t.Errorf("Content = %q, want plain text", post.Content)
+	}
+	if want := "hello-world-" + id.Hex(); post.Slug != want {
+		t.Errorf("Slug = %q, want %q", post.Slug, want)
+	}
+	if post.ID != id || post.UserID != user.ID.Hex() || post.UserName != "Dana" {
+		t.Errorf("owner = %v/%q/%q", post.ID, post.UserID, post.UserName)
+	}
+	if !post.Published || post.Version != 1 || post.Likes != 0 {
+		t.Errorf("published/version/likes = %t/%d/%d, want true/1/0", post.Published, post.Version, post.Likes)
+	}
+	if want := now.UTC().Truncate(time.Millisecond); !post.CreatedAt.Equal(want) || post.CreatedAt.Location() != time.UTC {
+		t.Errorf("CreatedAt = %v, want %v", post.CreatedAt, want)
+	}
+}
+
+func TestStarterSlug(t *testing.T) {
+	id := primitive.NewObjectID()
+	valid := regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	for _, title := range []string{"Welcome!", "Hello from Alice", "Docker networking notes", "!!!", "Xin chào"} {
+		slug := starterSlug(title, id)
+		if !valid.MatchString(slug) || !strings.HasSuffix(slug, "-"+id.Hex()) && slug != id.Hex() {
+			t.Errorf("starterSlug(%q) = %q", title, slug)
+		}
+	}
+	if a, b := starterSlug("Welcome!", primitive.NewObjectID()), starterSlug("Welcome!", primitive.NewObjectID()); a == b {
+		t.Errorf("two posts with the same title share slug %q", a)
+	}
+}
+
+func TestWelcomePostInvariants(t *testing.T) {
+	const path = "/users?welcome=true"
+	body := `{"name":"&lt;script&gt;x&lt;/script&gt; Dana","email":"dana@example.com"}`
+	token := bearer(t, primitive.NewObjectID().Hex(), "")
+
+	withOutbox := func(t *testing.T, mt *mtest.T) {
+		outboxCollection = mt.Coll
+		t.Cleanup(func() { outboxCollection = nil })
+	}
+
+	t.Run("without outbox", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(writeResponse(1), writeResponse(1), mtest.CreateSuccessResponse())
+
+			if w := serve(r, "POST", path, body, "Authorization", token); w.Code != 201 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			docs := insertedDocs(mt)
+			if len(docs) != 2 {
+				t.Fatalf("inserts = %d, want user and post", len(docs))
+			}
+			post := docs[1]
+			id := post.Lookup("_id").ObjectID()
+			if got, want := post.Lookup("slug").StringValue(), "welcome-"+id.Hex(); got != want {
+				t.Errorf("slug = %q, want %q", got, want)
+			}
+			if content := post.Lookup("content").StringValue(); strings.ContainsAny(content, "<>") {
+				t.Errorf("content kept markup from the user name: %q", content)
+			}
+		})
+	})
+
+	t.Run("event written in the transaction", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			withOutbox(t, mt)
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(writeResponse(1), writeResponse(1), writeResponse(1), mtest.CreateSuccessResponse())
+
+			if w := serve(r, "POST", path, body, "Authorization", token); w.Code != 201 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var names []string
+			for _, ev := range mt.GetAllStartedEvents() {
+				names = append(names, ev.CommandName)
+			}
+			if want := []string{"insert", "insert", "insert", "commitTransaction"}; !slices.Equal(names, want) {
+				t.Fatalf("commands = %v, want %v", names, want)
+			}
+			docs := insertedDocs(mt)
+			post, event := docs[1], docs[2]
+			if got := event.Lookup("type").StringValue(); got != eventPostCreated {
+				t.Errorf("event type = %q, want %q", got, eventPostCreated)
+			}
+			if got, want := event.Lookup("aggregate_id").ObjectID(), post.Lookup("_id").ObjectID(); got != want {
+				t.Errorf("aggregate_id = %v, want the post's %v", got, want)
+			}
+			if got, want := event.Lookup("payload", "slug").StringValue(), post.Lookup("slug").StringValue(); got != want {
+				t.Errorf("payload slug = %q, want %q", got, want)
+			}
+		})
+	})
+
+	t.Run("outbox failure rolls back", func(t *testing.T) {
+		withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+			withOutbox(t, mt)
+			r := newTestRouter(t, nil)
+			mt.AddMockResponses(
+				writeResponse(1),
+				writeResponse(1),
+				mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 121, Message: "Document failed validation"}),
+				mtest.CreateSuccessResponse(),
+			)
+
+			if w := serve(r, "POST", path, body, "Authorization", token); w.Code != 500 {
+				t.Fatalf("status = %d, want 500: %s", w.Code, w.Body)
+			}
+			if last := mt.GetAllStartedEvents(); last[len(last)-1].CommandName != "abortTransaction" {
+				t.Errorf("last command = %s, want abortTransaction", last[len(last)-1].CommandName)
+			}
+		})
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	minNameLength = 2
+	maxNameLength = 50
+)
+
+func registerJSONFieldNames() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+}
+
+func respondBindError(c *gin.Context, err error) {
+	if respondBodyTooLarge(c, err) {
+		return
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		respondError(c, 400, codeBadRequest, err.Error())
+		return
+	}
+
+	respondFieldErrors(c, fieldErrorMap(validationErrs))
+}
+
+// userFieldErrors checks u against the User binding tags, for users decoded
+// without ShouldBindJSON such as batch items. It returns nil when u is valid.
+func userFieldErrors(u *User) map[string]string {
+	var validationErrs validator.ValidationErrors
+	if err := binding.Validator.ValidateStruct(u); !errors.As(err, &validationErrs) {
+		return nil
+	}
+	return fieldErrorMap(validationErrs)
+}
+
+// newUserFieldErrors normalizes u's name and email in place and reports every
+// problem with them together, so a client fixing one field is not sent back
+// for the next. It returns nil when u is valid.
+func newUserFieldErrors(u *User) map[string]string {
+	u.Email = strings.ToLower(strings.TrimSpace(u.Email))
+	fieldErrors := userFieldErrors(u)
+	name, err := normalizeUserName(u.Name)
+	if err != nil {
+		if fieldErrors == nil {
+			fieldErrors = map[string]string{}
+		}
+		fieldErrors["name"] = err.Error()
+		return fieldErrors
+	}
+	u.Name = name
+	return fieldErrors
+}
+
+func fieldErrorMap(validationErrs validator.ValidationErrors) map[string]string {
+	fieldErrors := make(map[string]string, len(validationErrs))
+	for _, fe := range validationErrs {
+		fieldErrors[fe.Field()] = fieldErrorReason(fe)
+	}
+	return fieldErrors
+}
+
+func fieldErrorReason(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", fe.Field())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters", fe.Field(), fe.Param())
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters", fe.Field(), fe.Param())
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", fe.Field())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", fe.Field(), fe.Param())
+	default:
+		return fmt.Sprintf("%s is invalid", fe.Field())
+	}
+}
+
+// normalizeUserName trims the name and collapses inner runs of whitespace to
+// single spaces before checking its length.
+func normalizeUserName(raw string) (string, error) {
+	name := strings.Join(strings.Fields(raw), " ")
+	switch n := utf8.RuneCountInString(name); {
+	case n == 0:
+		return "", errors.New("name is required")
+	case n < minNameLength:
+		return "", fmt.Errorf("name must be at least %d characters", minNameLength)
+	case n > maxNameLength:
+		return "", fmt.Errorf("name must be at most %d characters", maxNameLength)
+	}
+	return name, nil
+}
+
+// parseObjectID reads the named path parameter as an ObjectID. On failure it
+// writes a 400 and returns false, and the caller should return.
+func parseObjectID(c *gin.Context, param string) (primitive.ObjectID, bool) {
+	objID, err := primitive.ObjectIDFromHex(c.Param(param))
+	if err != nil {
+		respondError(c, 400, codeInvalidID, fmt.Sprintf("%s must be a 24-character hex ObjectID", param))
+		return primitive.NilObjectID, false
+	}
+	return objID, true
+}
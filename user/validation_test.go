@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestNormalizeUserName(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		ok       bool
+	}{
+		{"Alice", "Alice", true},
+		{"  Alice Smith \n", "Alice Smith", true},
+		{"Alice \t  Smith", "Alice Smith", true},
+		{"Zoë", "Zoë", true},
+		{"", "", false},
+		{" \t\n ", "", false},
+		{" A ", "", false},
+		{strings.Repeat("é", maxNameLength), strings.Repeat("é", maxNameLength), true},
+		{strings.Repeat("é", maxNameLength+1), "", false},
+	} {
+		got, err := normalizeUserName(tc.in)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("normalizeUserName(%q) = %q, %v; want %q, ok=%t", tc.in, got, err, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestCreateUserNormalizesName(t *testing.T) {
+	token := bearer(t, "64b000000000000000000001", "")
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		mt.AddMockResponses(writeResponse(1))
+
+		w := serve(r, "POST", "/users", `{"name":"  Alice   Smith ","email":"alice@example.com"}`, "Authorization", token)
+		if w.Code != 201 {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		if got := startedCommand(t, mt, "insert").Lookup("documents", "0", "name").StringValue(); got != "Alice Smith" {
+			t.Errorf("stored name = %q, want %q", got, "Alice Smith")
+		}
+	})
+
+	r := newTestRouter(t, nil)
+	for _, name := range []string{"   ", strings.Repeat("x", maxNameLength+1)} {
+		w := serve(r, "POST", "/users", `{"name":"`+name+`","email":"alice@example.com"}`, "Authorization", token)
+		if w.Code != 400 || errorCode(t, w) != codeValidation || !strings.Contains(w.Body.String(), `"name"`) {
+			t.Errorf("name %q: status = %d, body %s; want 400 naming name", name, w.Code, w.Body)
+		}
+	}
+}
+
+func TestCreateUserReportsAllFieldErrors(t *testing.T) {
+	r := newTestRouter(t, nil)
+	w := serve(r, "POST", "/users", `{"name":"   ","email":"not-an-email"}`,
+		"Authorization", bearer(t, primitive.NewObjectID().Hex(), ""))
+	if w.Code != 400 || errorCode(t, w) != codeValidation {
+		t.Fatalf("status = %d, body %s; want 400 validation_failed", w.Code, w.Body)
+	}
+
+	var body struct {
+		Error APIError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, field := range []string{"name", "email"} {
+		if body.Error.Fields[field] == "" {
+			t.Errorf("fields = %v, missing %s", body.Error.Fields, field)
+		}
+	}
+}
+
+func TestRenameUserRejectsBlankName(t *testing.T) {
+	user := primitive.NewObjectID().Hex()
+	r := newTestRouter(t, nil)
+
+	w := serve(r, "POST", "/users/"+user+"/rename", `{"name":" \t "}`, "Authorization", bearer(t, user, ""))
+	if w.Code != 400 || errorCode(t, w) != codeValidation {
+		t.Fatalf("status = %d, body %s; want 400 validation_failed", w.Code, w.Body)
+	}
+}
+
+// TestMalformedIDs walks every route with an ID in its path, so new handlers
+// are held to the same 400 without being listed here.
+func TestMalformedIDs(t *testing.T) {
+	param := regexp.MustCompile(`:(postID|userID|id)\b`)
+	token := bearer(t, "64b0000000000000000000ad", roleAdmin)
+
+	withMockMongo(t, func(t *testing.T, mt *mtest.T) {
+		r := newTestRouter(t, nil)
+		checked := 0
+		for _, route := range r.Routes() {
+			if !param.MatchString(route.Path) {
+				continue
+			}
+			checked++
+			path := param.ReplaceAllString(route.Path, "not-an-id")
+			w := serve(r, route.Method, path, "{}", "Authorization", token)
+			if w.Code != 400 || errorCode(t, w) != codeInvalidID {
+				t.Errorf("%s %s: status = %d, body %s; want 400 %s", route.Method, path, w.Code, w.Body, codeInvalidID)
+			}
+		}
+		if checked == 0 {
+			t.Fatal("no routes take an ID")
+		}
+		if n := len(mt.GetAllStartedEvents()); n != 0 {
+			t.Errorf("sent %d commands for malformed IDs, want none", n)
+		}
+	})
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"cmp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Set at build time with -ldflags "-X main.version=... -X main.commit=... -X main.builtAt=...".
+var (
+	version string
+	commit  string
+	builtAt string
+)
+
+func versionInfo(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"version":  cmp.Or(version, "dev"),
+		"commit":   cmp.Or(commit, "unknown"),
+		"built_at": cmp.Or(builtAt, "unknown"),
+	})
+}
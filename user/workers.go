@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// workerGroup runs background loops under one context so shutdown can cancel
+// them together and wait for each to return.
+type workerGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newWorkerGroup() *workerGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workerGroup{ctx: ctx, cancel: cancel}
+}
+
+// start runs fn in its own goroutine. fn must return once its context is
+// cancelled.
+func (g *workerGroup) start(name string, fn func(ctx context.Context)) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		slog.Info("worker started", "worker", name)
+		fn(g.ctx)
+		slog.Info("worker stopped", "worker", name)
+	}()
+}
+
+// stop cancels every worker and waits for them, giving up when ctx ends.
+func (g *workerGroup) stop(ctx context.Context) error {
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}